@@ -60,7 +60,7 @@ type K8sOperations interface {
 	SetNamespaceLabels(namespace string, labels map[string]string) error
 	DeleteDeployEnvVars(namespace, name string, evNames []string) error
 	DeleteCronJobEnvVars(namespace, name string, evNames []string) error
-	CreateOrUpdateDeployEnvVars(namespace, name string, evs []*EnvVar) error
+	CreateOrUpdateDeployEnvVars(namespace, name string, evs []*EnvVar, description string) error
 	CreateOrUpdateCronJobEnvVars(namespace, name string, evs []*EnvVar) error
 	CreateOrUpdateDeploySecretEnvVars(namespace, name, secretName string, secrets []string) error
 	CreateOrUpdateCronJobSecretEnvVars(namespace, name, secretName string, secrets []string) error
@@ -322,7 +322,7 @@ func (ops *AppOperations) SetEnv(user *database.User, appName string, evs []*Env
 	if IsCronJob(app.ProcessType) {
 		err = ops.kops.CreateOrUpdateCronJobEnvVars(appName, appName, evs)
 	} else {
-		err = ops.kops.CreateOrUpdateDeployEnvVars(appName, appName, evs)
+		err = ops.kops.CreateOrUpdateDeployEnvVars(appName, appName, evs, "")
 	}
 
 	if err != nil {
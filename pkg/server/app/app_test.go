@@ -167,7 +167,7 @@ func (f *fakeK8sOperations) DeleteCronJobEnvVars(namespace, name string, evNames
 	return nil
 }
 
-func (*fakeK8sOperations) CreateOrUpdateDeployEnvVars(namespace, name string, evs []*EnvVar) error {
+func (*fakeK8sOperations) CreateOrUpdateDeployEnvVars(namespace, name string, evs []*EnvVar, description string) error {
 	return nil
 }
 
@@ -289,7 +289,7 @@ func (e *errK8sOperations) DeleteCronJobEnvVars(namespace, name string, evNames
 	return e.Err
 }
 
-func (e *errK8sOperations) CreateOrUpdateDeployEnvVars(namespace, name string, evs []*EnvVar) error {
+func (e *errK8sOperations) CreateOrUpdateDeployEnvVars(namespace, name string, evs []*EnvVar, description string) error {
 	return e.CreateOrUpdateDeployEnvVarsErr
 }
 
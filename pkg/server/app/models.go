@@ -23,21 +23,37 @@ type Autoscale struct {
 	Min                  int32
 }
 
+// CustomMetric is a per pod metric served by the custom metrics API (e.g.
+// queue depth), the autoscale keeps its average around TargetAverageValue
+type CustomMetric struct {
+	Name               string
+	TargetAverageValue string
+}
+
+type Toleration struct {
+	Key      string
+	Operator string
+	Value    string
+	Effect   string
+}
+
 type EnvVar struct {
 	Key   string `json:"key"`
 	Value string `json:"value"`
 }
 
 type App struct {
-	Name        string     `json:"name"`
-	Team        string     `json:"-"`
-	ProcessType string     `json:"processType"`
-	VirtualHost string     `json:"virtualHost"`
-	Limits      *Limits    `json:"-"`
-	Autoscale   *Autoscale `json:"-"`
-	EnvVars     []*EnvVar  `json:"envVars"`
-	Internal    bool       `json:"internal"`
-	Secrets     []string   `json:"secrets"`
+	Name         string                `json:"name"`
+	Team         string                `json:"-"`
+	ProcessType  string                `json:"processType"`
+	VirtualHost  string                `json:"virtualHost"`
+	Limits       *Limits               `json:"-"`
+	Quota        []*LimitRangeQuantity `json:"-"`
+	Autoscale    *Autoscale            `json:"-"`
+	CustomMetric *CustomMetric         `json:"-"`
+	EnvVars      []*EnvVar             `json:"envVars"`
+	Internal     bool                  `json:"internal"`
+	Secrets      []string              `json:"secrets"`
 }
 
 type Pod struct {
@@ -48,6 +64,39 @@ type Pod struct {
 	Ready    bool
 }
 
+type PodCondition struct {
+	Type    string
+	Status  bool
+	Reason  string
+	Message string
+}
+
+type PodMetric struct {
+	Name   string
+	CPU    string
+	Memory string
+}
+
+type Event struct {
+	Type    string
+	Reason  string
+	Message string
+	Count   int32
+	Age     int64
+}
+
+type NodeInfo struct {
+	Name   string
+	Zone   string
+	Region string
+}
+
+type ClusterInfo struct {
+	Provider      string
+	Nodes         int
+	InstanceTypes []string
+}
+
 type Address struct {
 	Hostname string
 }
@@ -57,6 +106,12 @@ type Status struct {
 	Pods []*Pod
 }
 
+type QuotaUsage struct {
+	Resource string
+	Used     string
+	Hard     string
+}
+
 type Info struct {
 	Team      string
 	Addresses []*Address
@@ -66,6 +121,12 @@ type Info struct {
 	Limits    *Limits
 }
 
+type AppMeta struct {
+	App      *App
+	Team     string
+	LastUser string
+}
+
 type AppListItem struct {
 	Team      string
 	Name      string
@@ -1,13 +1,26 @@
 package app
 
+import "time"
+
 type LogOptions struct {
-	Lines     int64
-	Follow    bool
-	PodName   string
-	Previous  bool
-	Container string
+	Lines        int64
+	Follow       bool
+	PodName      string
+	Previous     bool
+	Container    string
+	SinceSeconds *int64
+	SinceTime    *time.Time
+	Timestamps   bool
+	// LimitBytes caps the bytes read from the container log
+	LimitBytes *int64
+	// MaxLines ends the stream after that many lines, even when following
+	MaxLines int64
 }
 
 type PodListOptions struct {
 	PodName string
+	// OwnerKind and OwnerName keep only the pods whose controller matches
+	// them (e.g. ReplicaSet for deploy pods and Job for cron job pods)
+	OwnerKind string
+	OwnerName string
 }
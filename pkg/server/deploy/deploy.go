@@ -12,6 +12,7 @@ import (
 	"github.com/luizalabs/teresa/pkg/server/auth"
 	"github.com/luizalabs/teresa/pkg/server/database"
 	"github.com/luizalabs/teresa/pkg/server/exec"
+	"github.com/luizalabs/teresa/pkg/server/service"
 	"github.com/luizalabs/teresa/pkg/server/spec"
 	st "github.com/luizalabs/teresa/pkg/server/storage"
 	"github.com/luizalabs/teresa/pkg/server/teresa_errors"
@@ -33,7 +34,7 @@ type Operations interface {
 type K8sOperations interface {
 	CreateOrUpdateDeploy(deploySpec *spec.Deploy) error
 	CreateOrUpdateCronJob(cronJobSpec *spec.CronJob) error
-	ExposeDeploy(namespace, name, vHost, svcType string, w io.Writer) error
+	ExposeDeployWithOptions(namespace, name, vHost, svcType string, opts *service.ServiceOptions, w io.Writer) error
 	ReplicaSetListByLabel(namespace, label, value string) ([]*ReplicaSetListItem, error)
 	DeployRollbackToRevision(namespace, name, revision string) error
 	CreateOrUpdateConfigMap(namespace, name string, data map[string]string) error
@@ -168,7 +169,7 @@ func (ops *DeployOperations) createOrUpdateDeploy(a *app.App, confFiles *DeployC
 		return
 	}
 
-	if err := ops.exposeApp(a, w); err != nil {
+	if err := ops.exposeApp(a, deploySpec.ContainerPort, w); err != nil {
 		errChan <- err
 		log.WithError(err).Errorf("Exposing service %s", a.Name)
 	} else {
@@ -203,12 +204,13 @@ func (ops *DeployOperations) createOrUpdateCronJob(a *app.App, confFiles *Deploy
 	}
 }
 
-func (ops *DeployOperations) exposeApp(a *app.App, w io.Writer) error {
+func (ops *DeployOperations) exposeApp(a *app.App, containerPort int32, w io.Writer) error {
 	if a.ProcessType != app.ProcessTypeWeb {
 		return nil
 	}
 	svcType := ops.serviceType(a)
-	if err := ops.k8s.ExposeDeploy(a.Name, a.Name, a.VirtualHost, svcType, w); err != nil {
+	opts := &service.ServiceOptions{TargetPort: containerPort}
+	if err := ops.k8s.ExposeDeployWithOptions(a.Name, a.Name, a.VirtualHost, svcType, opts, w); err != nil {
 		return err
 	}
 	return nil // already exposed
@@ -13,6 +13,7 @@ import (
 	"github.com/luizalabs/teresa/pkg/server/auth"
 	"github.com/luizalabs/teresa/pkg/server/database"
 	"github.com/luizalabs/teresa/pkg/server/exec"
+	"github.com/luizalabs/teresa/pkg/server/service"
 	"github.com/luizalabs/teresa/pkg/server/spec"
 	st "github.com/luizalabs/teresa/pkg/server/storage"
 	"github.com/luizalabs/teresa/pkg/server/teresa_errors"
@@ -36,6 +37,7 @@ type fakeK8sOperations struct {
 	createCronJobReturn      error
 	hasSrvErr                error
 	exposeDeployWasCalled    bool
+	lastServiceOptions       *service.ServiceOptions
 	replicaSetListByLabelErr error
 	createConfigMapWasCalled bool
 }
@@ -55,8 +57,9 @@ func (f *fakeK8sOperations) CreateOrUpdateCronJob(cronJobSpec *spec.CronJob) err
 	return f.createCronJobReturn
 }
 
-func (f *fakeK8sOperations) ExposeDeploy(namespace, name, vHost, svcType string, w io.Writer) error {
+func (f *fakeK8sOperations) ExposeDeployWithOptions(namespace, name, vHost, svcType string, opts *service.ServiceOptions, w io.Writer) error {
 	f.exposeDeployWasCalled = true
+	f.lastServiceOptions = opts
 	return nil
 }
 
@@ -175,8 +178,8 @@ func TestCreateDeploy(t *testing.T) {
 	if fakeK8s.lastDeploySpec.SlugURL != expectedSlugURL {
 		t.Errorf("expected %s, got %s", expectedSlugURL, fakeK8s.lastDeploySpec.SlugURL)
 	}
-	if fakeK8s.lastDeploySpec.RevisionHistoryLimit != opts.RevisionHistoryLimit {
-		t.Errorf("expected %d, got %d", opts.RevisionHistoryLimit, fakeK8s.lastDeploySpec.RevisionHistoryLimit)
+	if *fakeK8s.lastDeploySpec.RevisionHistoryLimit != int32(opts.RevisionHistoryLimit) {
+		t.Errorf("expected %d, got %d", opts.RevisionHistoryLimit, *fakeK8s.lastDeploySpec.RevisionHistoryLimit)
 	}
 }
 
@@ -338,7 +341,7 @@ func TestExposeApp(t *testing.T) {
 			&Options{},
 		)
 		deployOperations := ops.(*DeployOperations)
-		deployOperations.exposeApp(&app.App{ProcessType: tc.appProcessType}, new(bytes.Buffer))
+		deployOperations.exposeApp(&app.App{ProcessType: tc.appProcessType}, spec.DefaultPort, new(bytes.Buffer))
 
 		if fakeK8s.exposeDeployWasCalled != tc.expectedExposeDeployWasCalled {
 			t.Errorf(
@@ -347,6 +350,9 @@ func TestExposeApp(t *testing.T) {
 				fakeK8s.exposeDeployWasCalled,
 			)
 		}
+		if fakeK8s.exposeDeployWasCalled && fakeK8s.lastServiceOptions.TargetPort != spec.DefaultPort {
+			t.Errorf("expected %d, got %d", spec.DefaultPort, fakeK8s.lastServiceOptions.TargetPort)
+		}
 	}
 }
 
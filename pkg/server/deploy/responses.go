@@ -11,6 +11,7 @@ type ReplicaSetListItem struct {
 	Description string
 	Age         int64
 	Current     bool
+	Image       string
 }
 
 type ByRevision []*dpb.ListResponse_Deploy
@@ -0,0 +1,183 @@
+package k8s
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/pkg/apis/apps/v1beta1"
+	k8s_extensions "k8s.io/client-go/pkg/apis/extensions/v1beta1"
+)
+
+const (
+	appsV1beta1GroupVersion         = "apps/v1beta1"
+	extensionsV1beta1GroupVersion   = "extensions/v1beta1"
+	autoscalingV1GroupVersion       = "autoscaling/v1"
+	autoscalingV2alpha1GroupVersion = "autoscaling/v2alpha1"
+	metricsV1beta1GroupVersion      = "metrics.k8s.io/v1beta1"
+)
+
+// groupVersionsTTL bounds how long the discovery results are kept, the
+// server may be upgraded during the life of the client
+const groupVersionsTTL = 10 * time.Minute
+
+// apiCandidates are the group versions that may serve resource, ordered
+// from the newest to the oldest
+type apiCandidates struct {
+	resource      string
+	groupVersions []string
+}
+
+var (
+	deployGroupVersions = apiCandidates{
+		resource:      "deployments",
+		groupVersions: []string{appsV1beta1GroupVersion, extensionsV1beta1GroupVersion},
+	}
+	customMetricGroupVersions = apiCandidates{
+		resource:      "horizontalpodautoscalers",
+		groupVersions: []string{autoscalingV2alpha1GroupVersion},
+	}
+	metricsGroupVersions = apiCandidates{
+		resource:      "pods",
+		groupVersions: []string{metricsV1beta1GroupVersion},
+	}
+)
+
+// groupVersionsCache keeps the server group versions and the resources
+// they serve for groupVersionsTTL
+type groupVersionsCache struct {
+	mu        sync.Mutex
+	expires   time.Time
+	gvs       map[string]bool
+	resources map[string]map[string]bool
+}
+
+// serves tells if the server has the group version and it serves the
+// resource, a group version may exist without some of its old resources
+func (c *groupVersionsCache) serves(kc *kubernetes.Clientset, gv, resource string) (bool, error) {
+	if c == nil {
+		c = new(groupVersionsCache)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Now().After(c.expires) {
+		c.gvs, c.resources = nil, make(map[string]map[string]bool)
+	}
+	if c.gvs == nil {
+		gvs, err := serverGroupVersions(kc)
+		if err != nil {
+			return false, err
+		}
+		c.gvs, c.expires = gvs, time.Now().Add(groupVersionsTTL)
+	}
+	if !c.gvs[gv] {
+		return false, nil
+	}
+	if c.resources[gv] == nil {
+		resources, err := serverResources(kc, gv)
+		if err != nil {
+			return false, err
+		}
+		c.resources[gv] = resources
+	}
+	return c.resources[gv][resource], nil
+}
+
+func serverGroupVersions(kc *kubernetes.Clientset) (map[string]bool, error) {
+	groups, err := kc.Discovery().ServerGroups()
+	if err != nil {
+		return nil, errors.Wrap(err, "get server groups failed")
+	}
+	gvs := make(map[string]bool)
+	for _, g := range groups.Groups {
+		for _, v := range g.Versions {
+			gvs[v.GroupVersion] = true
+		}
+	}
+	return gvs, nil
+}
+
+func serverResources(kc *kubernetes.Clientset, gv string) (map[string]bool, error) {
+	rl, err := kc.Discovery().ServerResourcesForGroupVersion(gv)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get %s resources failed", gv)
+	}
+	resources := make(map[string]bool)
+	for _, r := range rl.APIResources {
+		resources[r.Name] = true
+	}
+	return resources, nil
+}
+
+func (k *Client) preferredGroupVersion(kc *kubernetes.Clientset, candidates apiCandidates) (string, error) {
+	for _, gv := range candidates.groupVersions {
+		ok, err := k.groupVersions.serves(kc, gv, candidates.resource)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			return gv, nil
+		}
+	}
+	return "", ErrUnsupportedAPIVersion
+}
+
+func appsToExtensionsDeploy(d *v1beta1.Deployment) (*k8s_extensions.Deployment, error) {
+	b, err := json.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+	ed := new(k8s_extensions.Deployment)
+	if err := json.Unmarshal(b, ed); err != nil {
+		return nil, err
+	}
+	ed.TypeMeta = metav1.TypeMeta{APIVersion: extensionsV1beta1GroupVersion, Kind: "Deployment"}
+	return ed, nil
+}
+
+func extensionsToAppsDeploy(ed *k8s_extensions.Deployment) (*v1beta1.Deployment, error) {
+	b, err := json.Marshal(ed)
+	if err != nil {
+		return nil, err
+	}
+	d := new(v1beta1.Deployment)
+	if err := json.Unmarshal(b, d); err != nil {
+		return nil, err
+	}
+	d.TypeMeta = metav1.TypeMeta{APIVersion: appsV1beta1GroupVersion, Kind: "Deployment"}
+	return d, nil
+}
+
+// getDeploy gets the deploy from the same group version used by
+// CreateOrUpdateDeploy
+func (k *Client) getDeploy(kc *kubernetes.Clientset, namespace, name string) (*v1beta1.Deployment, error) {
+	gv, err := k.preferredGroupVersion(kc, deployGroupVersions)
+	if err != nil {
+		return nil, err
+	}
+	if gv == extensionsV1beta1GroupVersion {
+		ed, err := kc.ExtensionsV1beta1().Deployments(namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return extensionsToAppsDeploy(ed)
+	}
+	return kc.AppsV1beta1().Deployments(namespace).Get(name, metav1.GetOptions{})
+}
+
+// deleteDeploy deletes the deploy from the same group version used by
+// CreateOrUpdateDeploy
+func (k *Client) deleteDeploy(kc *kubernetes.Clientset, namespace, name string, opts *metav1.DeleteOptions) error {
+	gv, err := k.preferredGroupVersion(kc, deployGroupVersions)
+	if err != nil {
+		return err
+	}
+	if gv == extensionsV1beta1GroupVersion {
+		return kc.ExtensionsV1beta1().Deployments(namespace).Delete(name, opts)
+	}
+	return kc.AppsV1beta1().Deployments(namespace).Delete(name, opts)
+}
@@ -0,0 +1,394 @@
+package k8s
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/pkg/apis/apps/v1beta1"
+	asv1 "k8s.io/client-go/pkg/apis/autoscaling/v1"
+
+	"github.com/luizalabs/teresa/pkg/server/app"
+	"github.com/luizalabs/teresa/pkg/server/spec"
+)
+
+func newAPIGroupList(groupVersions ...string) *metav1.APIGroupList {
+	gl := &metav1.APIGroupList{}
+	for _, gv := range groupVersions {
+		parts := strings.SplitN(gv, "/", 2)
+		gl.Groups = append(gl.Groups, metav1.APIGroup{
+			Name: parts[0],
+			Versions: []metav1.GroupVersionForDiscovery{
+				{GroupVersion: gv, Version: parts[1]},
+			},
+		})
+	}
+	return gl
+}
+
+// groupVersionResources are the resources served by each group version on
+// the fake discovery
+var groupVersionResources = map[string][]string{
+	appsV1beta1GroupVersion:         {"deployments"},
+	extensionsV1beta1GroupVersion:   {"deployments", "ingresses", "replicasets"},
+	autoscalingV1GroupVersion:       {"horizontalpodautoscalers"},
+	autoscalingV2alpha1GroupVersion: {"horizontalpodautoscalers"},
+	metricsV1beta1GroupVersion:      {"nodes", "pods"},
+}
+
+// newDiscoveryHandler serves the discovery endpoints with the given group
+// versions and delegates any other request to next
+func newDiscoveryHandler(next func(w http.ResponseWriter, r *fakeRequest), groupVersions ...string) func(w http.ResponseWriter, r *fakeRequest) {
+	resources := make(map[string][]string)
+	for _, gv := range groupVersions {
+		resources[gv] = groupVersionResources[gv]
+	}
+	return newResourcesDiscoveryHandler(next, resources)
+}
+
+// newResourcesDiscoveryHandler is newDiscoveryHandler serving only the
+// given resources of each group version
+func newResourcesDiscoveryHandler(next func(w http.ResponseWriter, r *fakeRequest), resources map[string][]string) func(w http.ResponseWriter, r *fakeRequest) {
+	var groupVersions []string
+	for gv := range resources {
+		groupVersions = append(groupVersions, gv)
+	}
+	return func(w http.ResponseWriter, r *fakeRequest) {
+		switch r.Path {
+		case "/api":
+			writeJSON(w, http.StatusOK, &metav1.APIVersions{Versions: []string{"v1"}})
+		case "/apis":
+			writeJSON(w, http.StatusOK, newAPIGroupList(groupVersions...))
+		default:
+			gv := strings.TrimPrefix(r.Path, "/apis/")
+			names, found := resources[gv]
+			if !found {
+				next(w, r)
+				return
+			}
+			rl := &metav1.APIResourceList{GroupVersion: gv}
+			for _, name := range names {
+				rl.APIResources = append(rl.APIResources, metav1.APIResource{Name: name, Namespaced: true})
+			}
+			writeJSON(w, http.StatusOK, rl)
+		}
+	}
+}
+
+func TestPreferredGroupVersion(t *testing.T) {
+	var testCases = []struct {
+		resources map[string][]string
+		expected  string
+		err       error
+	}{
+		{
+			map[string][]string{
+				appsV1beta1GroupVersion:       {"deployments"},
+				extensionsV1beta1GroupVersion: {"deployments"},
+			},
+			appsV1beta1GroupVersion,
+			nil,
+		},
+		{
+			map[string][]string{extensionsV1beta1GroupVersion: {"deployments"}},
+			extensionsV1beta1GroupVersion,
+			nil,
+		},
+		{
+			map[string][]string{extensionsV1beta1GroupVersion: {"ingresses"}},
+			"",
+			ErrUnsupportedAPIVersion,
+		},
+		{
+			map[string][]string{},
+			"",
+			ErrUnsupportedAPIVersion,
+		},
+	}
+
+	for _, tc := range testCases {
+		srv := newFakeAPIServer(newResourcesDiscoveryHandler(func(w http.ResponseWriter, r *fakeRequest) {
+			writeStatus(w, http.StatusNotFound, metav1.StatusReasonNotFound)
+		}, tc.resources))
+		c := srv.Client()
+		kc, err := c.buildClient()
+		if err != nil {
+			t.Fatal("got unexpected error:", err)
+		}
+		gv, err := c.preferredGroupVersion(kc, deployGroupVersions)
+		srv.Close()
+		if err != tc.err {
+			t.Errorf("got %v; want %v", err, tc.err)
+		}
+		if gv != tc.expected {
+			t.Errorf("got %s; want %s", gv, tc.expected)
+		}
+	}
+}
+
+func TestCreateOrUpdateDeployPicksGroupVersion(t *testing.T) {
+	var testCases = []struct {
+		groupVersions []string
+		expectedPath  string
+	}{
+		{
+			[]string{appsV1beta1GroupVersion, extensionsV1beta1GroupVersion},
+			"/apis/apps/v1beta1/namespaces/teresa/deployments",
+		},
+		{
+			[]string{extensionsV1beta1GroupVersion},
+			"/apis/extensions/v1beta1/namespaces/teresa/deployments",
+		},
+	}
+
+	ds := &spec.Deploy{
+		Pod: spec.Pod{
+			Name:      "app",
+			Namespace: "teresa",
+			Containers: []*spec.Container{{
+				Name:  "app",
+				Image: "luizalabs/teresa:0.0.1",
+			}},
+		},
+	}
+
+	for _, tc := range testCases {
+		srv := newFakeAPIServer(newDiscoveryHandler(func(w http.ResponseWriter, r *fakeRequest) {
+			writeStatus(w, http.StatusNotFound, metav1.StatusReasonNotFound)
+		}, tc.groupVersions...))
+
+		err := srv.Client().CreateOrUpdateDeploy(ds)
+		srv.Close()
+		if err == nil {
+			t.Fatal("expected not found error on create; got nil")
+		}
+
+		last := srv.Requests[len(srv.Requests)-1]
+		if last.Method != http.MethodPost {
+			t.Errorf("got %s; want %s", last.Method, http.MethodPost)
+		}
+		if last.Path != tc.expectedPath {
+			t.Errorf("got %s; want %s", last.Path, tc.expectedPath)
+		}
+	}
+}
+
+func TestCreateOrUpdateDeployUnsupportedCluster(t *testing.T) {
+	srv := newFakeAPIServer(newDiscoveryHandler(func(w http.ResponseWriter, r *fakeRequest) {
+		writeStatus(w, http.StatusNotFound, metav1.StatusReasonNotFound)
+	}))
+	defer srv.Close()
+
+	ds := &spec.Deploy{Pod: spec.Pod{Name: "app", Namespace: "teresa"}}
+	if err := srv.Client().CreateOrUpdateDeploy(ds); err != ErrUnsupportedAPIVersion {
+		t.Errorf("got %v; want %v", err, ErrUnsupportedAPIVersion)
+	}
+}
+
+func TestCreateOrUpdateAutoscalePicksGroupVersion(t *testing.T) {
+	allGroupVersions := []string{autoscalingV1GroupVersion, autoscalingV2alpha1GroupVersion}
+	customMetric := &app.CustomMetric{Name: "queue_depth", TargetAverageValue: "100"}
+	var testCases = []struct {
+		groupVersions []string
+		customMetric  *app.CustomMetric
+		expectedPath  string
+	}{
+		{
+			allGroupVersions,
+			nil,
+			"/apis/autoscaling/v1/namespaces/teresa/horizontalpodautoscalers/teresa",
+		},
+		{
+			allGroupVersions,
+			customMetric,
+			"/apis/autoscaling/v2alpha1/namespaces/teresa/horizontalpodautoscalers/teresa",
+		},
+		{
+			[]string{autoscalingV1GroupVersion},
+			nil,
+			"/apis/autoscaling/v1/namespaces/teresa/horizontalpodautoscalers/teresa",
+		},
+	}
+
+	for _, tc := range testCases {
+		srv := newFakeAPIServer(newDiscoveryHandler(func(w http.ResponseWriter, r *fakeRequest) {
+			writeJSON(w, http.StatusOK, &asv1.HorizontalPodAutoscaler{})
+		}, tc.groupVersions...))
+
+		a := &app.App{
+			Name:         "teresa",
+			Autoscale:    &app.Autoscale{CPUTargetUtilization: 70, Min: 1, Max: 3},
+			CustomMetric: tc.customMetric,
+		}
+		err := srv.Client().CreateOrUpdateAutoscale(a)
+		srv.Close()
+		if err != nil {
+			t.Fatal("got unexpected error:", err)
+		}
+
+		last := srv.Requests[len(srv.Requests)-1]
+		if last.Method != http.MethodPut {
+			t.Errorf("got %s; want %s", last.Method, http.MethodPut)
+		}
+		if last.Path != tc.expectedPath {
+			t.Errorf("got %s; want %s", last.Path, tc.expectedPath)
+		}
+	}
+}
+
+func TestCreateOrUpdateAutoscaleCustomMetricUnsupported(t *testing.T) {
+	srv := newFakeAPIServer(newDiscoveryHandler(func(w http.ResponseWriter, r *fakeRequest) {
+		writeJSON(w, http.StatusOK, &asv1.HorizontalPodAutoscaler{})
+	}, autoscalingV1GroupVersion))
+	defer srv.Close()
+
+	a := &app.App{
+		Name:         "teresa",
+		Autoscale:    &app.Autoscale{Min: 1, Max: 3},
+		CustomMetric: &app.CustomMetric{Name: "queue_depth", TargetAverageValue: "100"},
+	}
+	if err := srv.Client().CreateOrUpdateAutoscale(a); err != ErrUnsupportedAPIVersion {
+		t.Errorf("got %v; want %v", err, ErrUnsupportedAPIVersion)
+	}
+}
+
+func TestGroupVersionsAreCached(t *testing.T) {
+	srv := newFakeAPIServer(newDiscoveryHandler(func(w http.ResponseWriter, r *fakeRequest) {
+		writeStatus(w, http.StatusNotFound, metav1.StatusReasonNotFound)
+	}, appsV1beta1GroupVersion))
+	defer srv.Close()
+
+	c := srv.Client()
+	ds := &spec.Deploy{Pod: spec.Pod{Name: "app", Namespace: "teresa"}}
+	c.CreateOrUpdateDeploy(ds)
+	c.CreateOrUpdateDeploy(ds)
+
+	count := 0
+	for _, req := range srv.Requests {
+		if req.Path == "/apis" {
+			count++
+		}
+	}
+	if count != 1 {
+		t.Errorf("got %d discovery requests; want 1", count)
+	}
+}
+
+func TestGroupVersionsCacheExpires(t *testing.T) {
+	srv := newFakeAPIServer(newDiscoveryHandler(func(w http.ResponseWriter, r *fakeRequest) {
+		writeStatus(w, http.StatusNotFound, metav1.StatusReasonNotFound)
+	}, appsV1beta1GroupVersion))
+	defer srv.Close()
+
+	c := srv.Client()
+	ds := &spec.Deploy{Pod: spec.Pod{Name: "app", Namespace: "teresa"}}
+	c.CreateOrUpdateDeploy(ds)
+	c.groupVersions.expires = time.Now().Add(-time.Second)
+	c.CreateOrUpdateDeploy(ds)
+
+	count := 0
+	for _, req := range srv.Requests {
+		if req.Path == "/apis" {
+			count++
+		}
+	}
+	if count != 2 {
+		t.Errorf("got %d discovery requests; want 2", count)
+	}
+}
+
+func TestDeployReadsAndDeletesPickGroupVersion(t *testing.T) {
+	var testCases = []struct {
+		groupVersions []string
+		expectedPath  string
+	}{
+		{
+			[]string{appsV1beta1GroupVersion, extensionsV1beta1GroupVersion},
+			"/apis/apps/v1beta1/namespaces/teresa/deployments/teresa",
+		},
+		{
+			[]string{extensionsV1beta1GroupVersion},
+			"/apis/extensions/v1beta1/namespaces/teresa/deployments/teresa",
+		},
+	}
+
+	for _, tc := range testCases {
+		srv := newFakeAPIServer(newDiscoveryHandler(func(w http.ResponseWriter, r *fakeRequest) {
+			if r.Method == http.MethodDelete {
+				writeStatus(w, http.StatusOK, "")
+				return
+			}
+			writeJSON(w, http.StatusOK, &v1beta1.Deployment{})
+		}, tc.groupVersions...))
+
+		c := srv.Client()
+		if _, err := c.DeployAnnotations("teresa", "teresa"); err != nil {
+			t.Fatal("got unexpected error:", err)
+		}
+		if err := c.DeleteDeploy("teresa", "teresa"); err != nil {
+			t.Fatal("got unexpected error:", err)
+		}
+		srv.Close()
+
+		for _, req := range srv.Requests {
+			if !strings.Contains(req.Path, "/namespaces/") {
+				continue
+			}
+			if req.Path != tc.expectedPath {
+				t.Errorf("got %s %s; want %s", req.Method, req.Path, tc.expectedPath)
+			}
+		}
+	}
+}
+
+func TestAppsToExtensionsDeploy(t *testing.T) {
+	ds := &spec.Deploy{
+		Pod: spec.Pod{
+			Name:      "app",
+			Namespace: "teresa",
+			Containers: []*spec.Container{{
+				Name:  "app",
+				Image: "luizalabs/teresa:0.0.1",
+			}},
+		},
+	}
+	d, err := deploySpecToK8sDeploy(ds, 3)
+	if err != nil {
+		t.Fatal("error converting spec:", err)
+	}
+
+	ed, err := appsToExtensionsDeploy(d)
+	if err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+	if ed.APIVersion != extensionsV1beta1GroupVersion {
+		t.Errorf("got %s; want %s", ed.APIVersion, extensionsV1beta1GroupVersion)
+	}
+	if ed.Name != d.Name || ed.Namespace != d.Namespace {
+		t.Errorf("got %s/%s; want %s/%s", ed.Namespace, ed.Name, d.Namespace, d.Name)
+	}
+	if *ed.Spec.Replicas != 3 {
+		t.Errorf("got %d; want 3", *ed.Spec.Replicas)
+	}
+	if ed.Spec.Template.Spec.Containers[0].Image != ds.Containers[0].Image {
+		t.Errorf("got %s; want %s", ed.Spec.Template.Spec.Containers[0].Image, ds.Containers[0].Image)
+	}
+}
+
+func TestCreateOrUpdateAutoscaleCustomMetricWithoutV2alpha1(t *testing.T) {
+	srv := newFakeAPIServer(newDiscoveryHandler(func(w http.ResponseWriter, r *fakeRequest) {
+		writeJSON(w, http.StatusOK, &asv1.HorizontalPodAutoscaler{})
+	}, autoscalingV1GroupVersion))
+	defer srv.Close()
+
+	a := &app.App{
+		Name:         "teresa",
+		Autoscale:    &app.Autoscale{Min: 1, Max: 3},
+		CustomMetric: &app.CustomMetric{Name: "queue_depth", TargetAverageValue: "100"},
+	}
+	if err := srv.Client().CreateOrUpdateAutoscale(a); err != ErrUnsupportedAPIVersion {
+		t.Errorf("got %v; want %v", err, ErrUnsupportedAPIVersion)
+	}
+}
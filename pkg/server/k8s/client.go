@@ -1,44 +1,175 @@
 package k8s
 
 import (
+	"bufio"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	log "github.com/Sirupsen/logrus"
+	"github.com/ghodss/yaml"
 	"github.com/luizalabs/teresa/pkg/server/app"
 	"github.com/luizalabs/teresa/pkg/server/deploy"
 	"github.com/luizalabs/teresa/pkg/server/service"
 	"github.com/luizalabs/teresa/pkg/server/spec"
 	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/pkg/api"
 	k8sv1 "k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/pkg/apis/apps/v1beta1"
 	asv1 "k8s.io/client-go/pkg/apis/autoscaling/v1"
+	asv2alpha1 "k8s.io/client-go/pkg/apis/autoscaling/v2alpha1"
+	k8s_extensions "k8s.io/client-go/pkg/apis/extensions/v1beta1"
+	policy "k8s.io/client-go/pkg/apis/policy/v1beta1"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	remotecommandconsts "k8s.io/apimachinery/pkg/util/remotecommand"
 	"k8s.io/apimachinery/pkg/util/wait"
 	restclient "k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/remotecommand"
+	utilexec "k8s.io/client-go/util/exec"
 )
 
 const (
-	patchDeployEnvVarsTmpl            = `{"metadata": {"annotations": {"kubernetes.io/change-cause": "update env vars"}}, "spec":{"template":{"metadata": {"annotations": {"date": "%s"}}, "spec":{"containers":[{"name": "%s", "env":%s}]}}}}`
-	patchCronJobEnvVarsTmpl           = `{"metadata": {"annotations": {"kubernetes.io/change-cause": "update env vars"}}, "spec":{"template":{"metadata":{"annotations":{"date": "%s"}}}, "jobTemplate":{"spec": {"template": {"spec": {"containers":[{"name": "%s", "env":%s}]}}}}}}`
+	patchDeployEnvVarsTmpl            = `{"metadata": {"annotations": {"kubernetes.io/change-cause": %s}}, "spec":{"template":{"metadata": {"annotations": {"date": "%s"}}, "spec":{"containers":[{"name": "%s", "env":%s}]}}}}`
+	patchCronJobEnvVarsTmpl           = `{"metadata": {"annotations": {"kubernetes.io/change-cause": %s}}, "spec":{"template":{"metadata":{"annotations":{"date": "%s"}}}, "jobTemplate":{"spec": {"template": {"spec": {"containers":[{"name": "%s", "env":%s}]}}}}}}`
+	patchDeployImageTmpl              = `{"metadata": {"annotations": {"kubernetes.io/change-cause": %s}}, "spec":{"template":{"spec":{"containers":[{"name": "%s", "image": %s}]}}}}`
+	patchDeployRestartTmpl            = `{"spec":{"template":{"metadata":{"annotations":{"kubectl.kubernetes.io/restartedAt": "%s"}}}}}`
+	patchDeployPodAnnotationsTmpl     = `{"spec":{"template":{"metadata":{"annotations": %s}}}}`
+	patchDeployEnvFromTmpl            = `{"spec":{"template":{"spec":{"containers":[{"name": "%s", "envFrom":%s}]}}}}`
 	patchDeployRollbackToRevisionTmpl = `{"spec":{"rollbackTo":{"revision": %s}}}`
 	patchDeployReplicasTmpl           = `{"spec":{"replicas": %d}}`
-	patchServiceAnnotationsTmpl       = `{"metadata":{"annotations": %s}}`
+	patchDeployPausedTmpl             = `{"spec":{"paused": %t}}`
+	patchAnnotationsTmpl              = `{"metadata":{"annotations": %s}}`
+	patchNamespaceLabelsTmpl          = `{"metadata":{"labels": %s}}`
+	patchSecretDataTmpl               = `{"data": %s}`
 	revisionAnnotation                = "deployment.kubernetes.io/revision"
+	lastAppliedAnnotation             = "kubectl.kubernetes.io/last-applied-configuration"
+	progressDeadlineExceededReason    = "ProgressDeadlineExceeded"
+	prometheusScrapeAnnotation        = "prometheus.io/scrape"
+	prometheusPortAnnotation          = "prometheus.io/port"
+	prometheusPathAnnotation          = "prometheus.io/path"
+	defaultPrometheusPath             = "/metrics"
+	resourceQuotaName                 = "quota"
+	defaultEnvVarsChangeCause         = "update env vars"
+	previousLogsDelimiter             = "--- previous container logs ---\n"
+	currentLogsDelimiter              = "--- current container logs ---\n"
 )
 
+// appLogsPollInterval is how often AppLogs looks for new pods to follow
+const appLogsPollInterval = 5 * time.Second
+
+// podRunsCloseTimeout bounds how long Close waits for the cancelled runs
+const podRunsCloseTimeout = 30 * time.Second
+
+// PodRunTimeoutExitCode is sent by PodRun when the pod doesn't finish in
+// time, the same code returned by timeout(1)
+const PodRunTimeoutExitCode = 124
+
 type Client struct {
 	conf          *restclient.Config
 	podRunTimeout time.Duration
 	ingress       bool
+	dryRun        io.Writer
+	runs          *podRuns
+	groupVersions *groupVersionsCache
+}
+
+// podRuns tracks the pods created by PodRun that are still running, with
+// the pipes streaming their logs
+type podRuns struct {
+	mu     sync.Mutex
+	runs   map[string]*podRun
+	closed bool
+	stop   chan struct{}
+	wg     sync.WaitGroup
+}
+
+type podRun struct {
+	pod *k8sv1.Pod
+	w   *io.PipeWriter
+}
+
+func newPodRuns() *podRuns {
+	return &podRuns{runs: make(map[string]*podRun), stop: make(chan struct{})}
+}
+
+func (r *podRuns) add(pod *k8sv1.Pod, w *io.PipeWriter) bool {
+	if r == nil {
+		return true
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return false
+	}
+	r.runs[pod.Namespace+"/"+pod.Name] = &podRun{pod: pod, w: w}
+	r.wg.Add(1)
+	return true
+}
+
+func (r *podRuns) done(pod *k8sv1.Pod) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	delete(r.runs, pod.Namespace+"/"+pod.Name)
+	r.mu.Unlock()
+	r.wg.Done()
+}
+
+func (r *podRuns) stopped() <-chan struct{} {
+	if r == nil {
+		return nil
+	}
+	return r.stop
+}
+
+// close refuses new runs and returns the active ones
+func (r *podRuns) close() []*podRun {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.closed {
+		r.closed = true
+		close(r.stop)
+	}
+	runs := make([]*podRun, 0, len(r.runs))
+	for _, run := range r.runs {
+		runs = append(runs, run)
+	}
+	return runs
+}
+
+// wait waits the runs to finish up to timeout, returning false on timeout
+func (r *podRuns) wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
 }
 
 func (k *Client) buildClient() (*kubernetes.Clientset, error) {
@@ -58,6 +189,25 @@ func (k *Client) HealthCheck() error {
 	return err
 }
 
+// NamespaceHealthCheck only gets the given namespace, for service accounts
+// not allowed to list the cluster namespaces
+func (k *Client) NamespaceHealthCheck(namespace string) error {
+	_, err := k.getNamespace(namespace)
+	return err
+}
+
+func (k *Client) ServerVersion() (string, error) {
+	kc, err := k.buildClient()
+	if err != nil {
+		return "", err
+	}
+	v, err := kc.Discovery().ServerVersion()
+	if err != nil {
+		return "", errors.Wrap(err, "get server version failed")
+	}
+	return v.GitVersion, nil
+}
+
 func (k *Client) getNamespace(namespace string) (*k8sv1.Namespace, error) {
 	kc, err := k.buildClient()
 	if err != nil {
@@ -76,9 +226,7 @@ func (k *Client) DeployAnnotation(namespace, deployName, annotation string) (str
 		return "", err
 	}
 
-	d, err := kc.AppsV1beta1().
-		Deployments(namespace).
-		Get(deployName, metav1.GetOptions{})
+	d, err := k.getDeploy(kc, namespace, deployName)
 
 	if err != nil {
 		return "", errors.Wrap(err, "get deploy annotation failed")
@@ -87,6 +235,35 @@ func (k *Client) DeployAnnotation(namespace, deployName, annotation string) (str
 	return d.Annotations[annotation], nil
 }
 
+// DeployAnnotations returns all the annotations of the deploy
+func (k *Client) DeployAnnotations(namespace, deployName string) (map[string]string, error) {
+	kc, err := k.buildClient()
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := k.getDeploy(kc, namespace, deployName)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "get deploy annotations failed")
+	}
+
+	return d.Annotations, nil
+}
+
+// DeployLastApplied returns the configuration last applied to the deploy by
+// kubectl apply, to diff against the running one
+func (k *Client) DeployLastApplied(namespace, deployName string) ([]byte, error) {
+	conf, err := k.DeployAnnotation(namespace, deployName, lastAppliedAnnotation)
+	if err != nil {
+		return nil, err
+	}
+	if conf == "" {
+		return nil, ErrNoLastApplied
+	}
+	return []byte(conf), nil
+}
+
 func (k *Client) NamespaceAnnotation(namespace, annotation string) (string, error) {
 	ns, err := k.getNamespace(namespace)
 	if err != nil {
@@ -105,6 +282,14 @@ func (k *Client) NamespaceLabel(namespace, label string) (string, error) {
 	return ns.Labels[label], nil
 }
 
+func (k *Client) NamespaceAge(namespace string) (time.Duration, error) {
+	ns, err := k.getNamespace(namespace)
+	if err != nil {
+		return 0, errors.Wrap(err, "get namespace failed")
+	}
+	return time.Since(ns.CreationTimestamp.Time), nil
+}
+
 func (k *Client) PodList(namespace string, opts *app.PodListOptions) ([]*app.Pod, error) {
 	kc, err := k.buildClient()
 	if err != nil {
@@ -118,6 +303,9 @@ func (k *Client) PodList(namespace string, opts *app.PodListOptions) ([]*app.Pod
 
 	pods := make([]*app.Pod, 0)
 	for _, pod := range podList.Items {
+		if !isPodOwnedBy(&pod, opts.OwnerKind, opts.OwnerName) {
+			continue
+		}
 		p := &app.Pod{Name: pod.Name}
 
 		if pod.Status.StartTime != nil {
@@ -143,629 +331,2651 @@ func (k *Client) PodList(namespace string, opts *app.PodListOptions) ([]*app.Pod
 	return pods, nil
 }
 
-func (k *Client) PodLogs(namespace string, podName string, opts *app.LogOptions) (io.ReadCloser, error) {
+// PodEvents returns the events of a pod, useful to find out why it is
+// pending (scheduling, volume mounts, image pulls and so on)
+func (k *Client) PodEvents(namespace, podName string) ([]*app.Event, error) {
 	kc, err := k.buildClient()
 	if err != nil {
 		return nil, err
 	}
-	req := kc.CoreV1().Pods(namespace).GetLogs(
-		podName,
-		&k8sv1.PodLogOptions{
-			Follow:    opts.Follow,
-			TailLines: &opts.Lines,
-			Previous:  opts.Previous,
-			Container: opts.Container,
-		},
-	)
-
-	return req.Stream()
-}
+	fieldSelector := fmt.Sprintf("involvedObject.name=%s,involvedObject.kind=Pod", podName)
+	el, err := kc.CoreV1().Events(namespace).List(metav1.ListOptions{FieldSelector: fieldSelector})
+	if err != nil {
+		return nil, errors.Wrap(err, "list pod events failed")
+	}
 
-func newNs(a *app.App, user string) *k8sv1.Namespace {
-	return &k8sv1.Namespace{
-		ObjectMeta: metav1.ObjectMeta{
-			Name: a.Name,
-			Labels: map[string]string{
-				app.TeresaTeamLabel: a.Team,
-			},
-			Annotations: map[string]string{
-				app.TeresaLastUser: user,
-			},
-		},
+	events := make([]*app.Event, 0)
+	for _, item := range el.Items {
+		ev := &app.Event{
+			Type:    item.Type,
+			Reason:  item.Reason,
+			Message: item.Message,
+			Count:   item.Count,
+		}
+		if !item.LastTimestamp.IsZero() {
+			ev.Age = int64(time.Since(item.LastTimestamp.Time))
+		}
+		events = append(events, ev)
 	}
+	return events, nil
 }
 
-func addAppToNs(a *app.App, ns *k8sv1.Namespace) error {
-	b, err := json.Marshal(a)
+// PodReadinessGates returns if the pod is ready and its conditions, the
+// readiness gates conditions included, to explain why it is not
+func (k *Client) PodReadinessGates(namespace, podName string) (bool, []app.PodCondition, error) {
+	kc, err := k.buildClient()
 	if err != nil {
-		return err
+		return false, nil, err
 	}
 
-	ns.Annotations[app.TeresaAnnotation] = string(b)
-	return nil
-}
-
-func addLimitRangeQuantityToResourceList(r *k8sv1.ResourceList, lrQuantity []*app.LimitRangeQuantity) error {
-	if lrQuantity == nil {
-		return nil
+	pod, err := kc.CoreV1().Pods(namespace).Get(podName, metav1.GetOptions{})
+	if err != nil {
+		return false, nil, errors.Wrap(err, "get pod failed")
 	}
 
-	rl := k8sv1.ResourceList{}
-	for _, item := range lrQuantity {
-		name := k8sv1.ResourceName(item.Resource)
-		q, err := resource.ParseQuantity(item.Quantity)
-		if err != nil {
-			return err
+	ready := false
+	conditions := make([]app.PodCondition, len(pod.Status.Conditions))
+	for i, c := range pod.Status.Conditions {
+		status := c.Status == k8sv1.ConditionTrue
+		if c.Type == k8sv1.PodReady {
+			ready = status
+		}
+		conditions[i] = app.PodCondition{
+			Type:    string(c.Type),
+			Status:  status,
+			Reason:  c.Reason,
+			Message: c.Message,
 		}
-		rl[name] = q
 	}
-	*r = rl
-	return nil
+	return ready, conditions, nil
 }
 
-func parseLimitRangeParams(lrItem *k8sv1.LimitRangeItem, lim *app.Limits) error {
-	if err := addLimitRangeQuantityToResourceList(&lrItem.Default, lim.Default); err != nil {
-		return err
+// PodNodeInfo returns the node where the pod is running with its zone and
+// region
+func (k *Client) PodNodeInfo(namespace, podName string) (*app.NodeInfo, error) {
+	kc, err := k.buildClient()
+	if err != nil {
+		return nil, err
 	}
-	return addLimitRangeQuantityToResourceList(&lrItem.DefaultRequest, lim.DefaultRequest)
+	pod, err := kc.CoreV1().Pods(namespace).Get(podName, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "get pod failed")
+	}
+	if pod.Spec.NodeName == "" {
+		return nil, ErrPodNotScheduled
+	}
+	node, err := kc.CoreV1().Nodes().Get(pod.Spec.NodeName, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "get node failed")
+	}
+	return &app.NodeInfo{
+		Name:   node.Name,
+		Zone:   node.Labels[zoneLabel],
+		Region: node.Labels[regionLabel],
+	}, nil
 }
 
-func newLimitRange(a *app.App) (*k8sv1.LimitRange, error) {
-	lrItem := k8sv1.LimitRangeItem{Type: k8sv1.LimitTypeContainer}
-	if err := parseLimitRangeParams(&lrItem, a.Limits); err != nil {
+// PodCountByState returns the number of pods of the namespace by phase
+func (k *Client) PodCountByState(namespace string) (map[string]int, error) {
+	kc, err := k.buildClient()
+	if err != nil {
 		return nil, err
 	}
-
-	lr := &k8sv1.LimitRange{
-		ObjectMeta: metav1.ObjectMeta{
-			Name: "limits",
-		},
-		Spec: k8sv1.LimitRangeSpec{
-			Limits: []k8sv1.LimitRangeItem{lrItem},
-		},
+	podList, err := kc.CoreV1().Pods(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "list pods failed")
 	}
-	return lr, nil
+	count := make(map[string]int)
+	for _, pod := range podList.Items {
+		count[string(pod.Status.Phase)]++
+	}
+	return count, nil
 }
 
-func newHPA(a *app.App) *asv1.HorizontalPodAutoscaler {
-	tcpu := a.Autoscale.CPUTargetUtilization
-	minr := a.Autoscale.Min
+// podMetricsList is the subset of metrics.k8s.io PodMetricsList used by
+// teresa, the metrics API types aren't part of the vendored client-go
+type podMetricsList struct {
+	Items []struct {
+		Metadata   metav1.ObjectMeta `json:"metadata"`
+		Containers []struct {
+			Usage k8sv1.ResourceList `json:"usage"`
+		} `json:"containers"`
+	} `json:"items"`
+}
 
-	return &asv1.HorizontalPodAutoscaler{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      a.Name,
-			Namespace: a.Name,
-		},
-		Spec: asv1.HorizontalPodAutoscalerSpec{
-			ScaleTargetRef: asv1.CrossVersionObjectReference{
-				APIVersion: "extensions/v1beta1",
-				Kind:       "Deployment",
-				Name:       a.Name,
-			},
-			TargetCPUUtilizationPercentage: &tcpu,
-			MaxReplicas:                    a.Autoscale.Max,
-			MinReplicas:                    &minr,
-		},
+func podMetricsListToPodMetrics(pml *podMetricsList) []*app.PodMetric {
+	metrics := make([]*app.PodMetric, len(pml.Items))
+	for i, item := range pml.Items {
+		cpu, mem := resource.Quantity{}, resource.Quantity{}
+		for _, c := range item.Containers {
+			cpu.Add(c.Usage[k8sv1.ResourceCPU])
+			mem.Add(c.Usage[k8sv1.ResourceMemory])
+		}
+		metrics[i] = &app.PodMetric{
+			Name:   item.Metadata.Name,
+			CPU:    cpu.String(),
+			Memory: mem.String(),
+		}
 	}
+	return metrics
 }
 
-func (k *Client) CreateNamespace(a *app.App, user string) error {
+// PodMetrics returns the current cpu and memory usage of the namespace pods,
+// as reported by the metrics-server
+func (k *Client) PodMetrics(namespace string) ([]*app.PodMetric, error) {
 	kc, err := k.buildClient()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	ns := newNs(a, user)
-	if err := addAppToNs(a, ns); err != nil {
-		return err
+	if _, err := k.preferredGroupVersion(kc, metricsGroupVersions); err != nil {
+		if err == ErrUnsupportedAPIVersion {
+			return nil, ErrMetricsUnavailable
+		}
+		return nil, err
 	}
 
-	_, err = kc.CoreV1().Namespaces().Create(ns)
-	return err
-}
-
-func (k *Client) CreateQuota(a *app.App) error {
-	kc, err := k.buildClient()
+	b, err := kc.CoreV1().RESTClient().
+		Get().
+		AbsPath("/apis", metricsV1beta1GroupVersion, "namespaces", namespace, "pods").
+		DoRaw()
 	if err != nil {
-		return err
+		if k.IsNotFound(err) {
+			return nil, ErrMetricsUnavailable
+		}
+		return nil, errors.Wrap(err, "get pod metrics failed")
 	}
 
-	lr, err := newLimitRange(a)
-	if err != nil {
-		return err
+	pml := new(podMetricsList)
+	if err := json.Unmarshal(b, pml); err != nil {
+		return nil, errors.Wrap(err, "decode pod metrics failed")
 	}
-
-	_, err = kc.CoreV1().LimitRanges(a.Name).Create(lr)
-	return err
+	return podMetricsListToPodMetrics(pml), nil
 }
 
-func (c *Client) GetSecret(namespace, secretName string) (map[string][]byte, error) {
-	kc, err := c.buildClient()
+func (k *Client) PodLogs(namespace string, podName string, opts *app.LogOptions) (io.ReadCloser, error) {
+	kc, err := k.buildClient()
 	if err != nil {
 		return nil, err
 	}
-	s, err := kc.CoreV1().Secrets(namespace).Get(secretName, metav1.GetOptions{})
-	if err != nil {
-		return nil, err
+	req := kc.CoreV1().Pods(namespace).GetLogs(podName, appLogOptsToK8s(opts))
+
+	stream, err := req.Stream()
+	if err != nil || opts.MaxLines <= 0 {
+		return stream, err
 	}
-	return s.Data, nil
+	return newLineLimitReadCloser(stream, opts.MaxLines), nil
 }
 
-func (c *Client) CreateOrUpdateSecret(namespace, secretName string, data map[string][]byte) error {
-	kc, err := c.buildClient()
+// PodLogsBySelector streams the logs of the newest pod matching the label
+// selector
+func (k *Client) PodLogsBySelector(namespace, labelSelector string, opts *app.LogOptions) (io.ReadCloser, error) {
+	kc, err := k.buildClient()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	s := &k8sv1.Secret{
-		Type: k8sv1.SecretTypeOpaque,
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      secretName,
-			Namespace: namespace,
-		},
-		Data: data,
+	podList, err := kc.CoreV1().Pods(namespace).List(metav1.ListOptions{LabelSelector: labelSelector})
+	if err != nil {
+		return nil, errors.Wrap(err, "list pods failed")
 	}
-
-	_, err = kc.CoreV1().Secrets(namespace).Update(s)
-	if c.IsNotFound(err) {
-		_, err = kc.CoreV1().Secrets(namespace).Create(s)
+	if len(podList.Items) == 0 {
+		return nil, ErrNotFound
 	}
-	return err
-}
 
-func (k *Client) CreateOrUpdateAutoscale(a *app.App) error {
-	kc, err := k.buildClient()
-	if err != nil {
-		return err
+	newest, tie := podList.Items[0], false
+	for _, pod := range podList.Items[1:] {
+		switch {
+		case newest.CreationTimestamp.Before(pod.CreationTimestamp):
+			newest, tie = pod, false
+		case newest.CreationTimestamp.Equal(pod.CreationTimestamp):
+			tie = true
+		}
 	}
+	if tie {
+		return nil, ErrAmbiguousPodSelector
+	}
+	return k.PodLogs(namespace, newest.Name, opts)
+}
 
-	hpa := newHPA(a)
+type multiReadCloser struct {
+	io.Reader
+	closers []io.Closer
+}
 
-	_, err = kc.AutoscalingV1().HorizontalPodAutoscalers(a.Name).Update(hpa)
-	if k.IsNotFound(err) {
-		_, err = kc.AutoscalingV1().HorizontalPodAutoscalers(a.Name).Create(hpa)
+func (m *multiReadCloser) Close() error {
+	var err error
+	for _, c := range m.closers {
+		if cErr := c.Close(); cErr != nil && err == nil {
+			err = cErr
+		}
 	}
 	return err
 }
 
-func (k *Client) AddressList(namespace string) ([]*app.Address, error) {
-	kc, err := k.buildClient()
-	if err != nil {
-		return nil, err
-	}
+// lineLimitReadCloser returns io.EOF after reading the lines limit
+type lineLimitReadCloser struct {
+	io.Closer
+	r     *bufio.Reader
+	lines int64
+	buf   []byte
+}
 
-	srvs, err := kc.CoreV1().Services(namespace).List(metav1.ListOptions{})
-	if err != nil {
-		return nil, errors.Wrap(err, "get addr list failed")
-	}
+func newLineLimitReadCloser(rc io.ReadCloser, lines int64) *lineLimitReadCloser {
+	return &lineLimitReadCloser{Closer: rc, r: bufio.NewReader(rc), lines: lines}
+}
 
-	addrs := []*app.Address{}
-	for _, srv := range srvs.Items {
-		for _, i := range srv.Status.LoadBalancer.Ingress {
-			h := i.Hostname
-			if h == "" {
-				h = i.IP
-			}
-			addrs = append(addrs, &app.Address{Hostname: h})
+func (l *lineLimitReadCloser) Read(p []byte) (int, error) {
+	if len(l.buf) == 0 {
+		if l.lines <= 0 {
+			return 0, io.EOF
+		}
+		line, err := l.r.ReadBytes('\n')
+		if len(line) == 0 {
+			return 0, err
 		}
+		l.lines--
+		l.buf = line
 	}
-	return addrs, nil
+	n := copy(p, l.buf)
+	l.buf = l.buf[n:]
+	return n, nil
 }
 
-func (k *Client) Status(namespace string) (*app.Status, error) {
+// PodLogsPreviousAndCurrent returns the logs of the previous instance of the
+// container (if any) followed by the logs of the current one
+func (k *Client) PodLogsPreviousAndCurrent(namespace, podName, container string) (io.ReadCloser, error) {
 	kc, err := k.buildClient()
 	if err != nil {
 		return nil, err
 	}
+	pods := kc.CoreV1().Pods(namespace)
 
-	pods, err := k.PodList(namespace, &app.PodListOptions{})
+	current, err := pods.GetLogs(
+		podName,
+		&k8sv1.PodLogOptions{Container: container},
+	).Stream()
 	if err != nil {
-		return nil, errors.Wrap(err, "get status failed")
+		return nil, errors.Wrap(err, "get current pod logs failed")
 	}
 
-	hpa, err := kc.AutoscalingV1().
-		HorizontalPodAutoscalers(namespace).
-		Get(namespace, metav1.GetOptions{})
-
+	previous, err := pods.GetLogs(
+		podName,
+		&k8sv1.PodLogOptions{Container: container, Previous: true},
+	).Stream()
 	if err != nil {
-		if !k.IsNotFound(err) {
-			return nil, errors.Wrap(err, "get status failed")
+		// there is no previous instance of the container
+		if k.IsBadRequest(err) || k.IsNotFound(err) {
+			return current, nil
 		}
+		current.Close()
+		return nil, errors.Wrap(err, "get previous pod logs failed")
 	}
 
-	var cpu int32 = -1
-	if hpa != nil && hpa.Status.CurrentCPUUtilizationPercentage != nil {
-		cpu = *hpa.Status.CurrentCPUUtilizationPercentage
+	r := io.MultiReader(
+		strings.NewReader(previousLogsDelimiter),
+		previous,
+		strings.NewReader(currentLogsDelimiter),
+		current,
+	)
+	return &multiReadCloser{Reader: r, closers: []io.Closer{previous, current}}, nil
+}
+
+type namedLogStream struct {
+	name   string
+	stream io.ReadCloser
+}
+
+// logMerger multiplexes log streams into a single reader, prefixing each
+// line with the name of the stream it came from. Streams can be added while
+// it's being read
+type logMerger struct {
+	r       *io.PipeReader
+	w       *io.PipeWriter
+	wmu     sync.Mutex
+	mu      sync.Mutex
+	streams []io.Closer
+	closed  bool
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+func newLogMerger() *logMerger {
+	r, w := io.Pipe()
+	return &logMerger{r: r, w: w, done: make(chan struct{})}
+}
+
+func (m *logMerger) Read(p []byte) (int, error) {
+	return m.r.Read(p)
+}
+
+func (m *logMerger) Close() error {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil
 	}
+	m.closed = true
+	close(m.done)
+	streams := m.streams
+	m.mu.Unlock()
 
-	stat := &app.Status{
-		CPU:  cpu,
-		Pods: pods,
+	for _, s := range streams {
+		s.Close()
 	}
-	return stat, nil
+	return m.r.Close()
 }
 
-func (k *Client) Autoscale(namespace string) (*app.Autoscale, error) {
+func (m *logMerger) add(s *namedLogStream) {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		s.stream.Close()
+		return
+	}
+	m.streams = append(m.streams, s.stream)
+	m.wg.Add(1)
+	m.mu.Unlock()
+
+	go func() {
+		defer m.wg.Done()
+		br := bufio.NewReader(s.stream)
+		for {
+			line, err := br.ReadString('\n')
+			if line != "" {
+				if !strings.HasSuffix(line, "\n") {
+					line += "\n"
+				}
+				m.wmu.Lock()
+				_, wErr := fmt.Fprintf(m.w, "[%s] %s", s.name, line)
+				m.wmu.Unlock()
+				if wErr != nil {
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+}
+
+// closeWhenDone ends the merged stream once the streams added so far end
+func (m *logMerger) closeWhenDone() {
+	go func() {
+		m.wg.Wait()
+		m.w.Close()
+	}()
+}
+
+func mergeLogStreams(streams []*namedLogStream) io.ReadCloser {
+	m := newLogMerger()
+	for _, s := range streams {
+		m.add(s)
+	}
+	m.closeWhenDone()
+	return m
+}
+
+// PodAllContainersLogs returns the logs of all containers of the pod merged
+// in a single stream, each line prefixed by the container name
+func (k *Client) PodAllContainersLogs(namespace, podName string, opts *app.LogOptions) (io.ReadCloser, error) {
 	kc, err := k.buildClient()
 	if err != nil {
 		return nil, err
 	}
+	pods := kc.CoreV1().Pods(namespace)
 
-	hpa, err := kc.AutoscalingV1().
-		HorizontalPodAutoscalers(namespace).
-		Get(namespace, metav1.GetOptions{})
+	pod, err := pods.Get(podName, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "get pod failed")
+	}
+
+	streams := make([]*namedLogStream, 0, len(pod.Spec.Containers))
+	for _, c := range pod.Spec.Containers {
+		containerOpts := *opts
+		containerOpts.Container = c.Name
+		stream, err := pods.GetLogs(podName, appLogOptsToK8s(&containerOpts)).Stream()
+		if err != nil {
+			for _, s := range streams {
+				s.stream.Close()
+			}
+			return nil, errors.Wrapf(err, "get logs of container %s failed", c.Name)
+		}
+		streams = append(streams, &namedLogStream{name: c.Name, stream: stream})
+	}
+	return mergeLogStreams(streams), nil
+}
+
+func newNs(a *app.App, user string) *k8sv1.Namespace {
+	return &k8sv1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: a.Name,
+			Labels: map[string]string{
+				app.TeresaTeamLabel: a.Team,
+			},
+			Annotations: map[string]string{
+				app.TeresaLastUser: user,
+			},
+		},
+	}
+}
 
+func addAppToNs(a *app.App, ns *k8sv1.Namespace) error {
+	b, err := json.Marshal(a)
 	if err != nil {
-		if k.IsNotFound(err) {
-			return nil, nil
+		return err
+	}
+
+	ns.Annotations[app.TeresaAnnotation] = string(b)
+	return nil
+}
+
+func appFromNs(ns *k8sv1.Namespace) (*app.App, error) {
+	an, ok := ns.Annotations[app.TeresaAnnotation]
+	if !ok {
+		return nil, ErrAppAnnotationNotFound
+	}
+	a := new(app.App)
+	if err := json.Unmarshal([]byte(an), a); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal app %s failed", ns.Name)
+	}
+	return a, nil
+}
+
+// AppLogs merges the logs of all the app pods, each line is prefixed with
+// the pod name. When following, the pods started afterwards are picked up
+// until the returned stream is closed
+func (k *Client) AppLogs(namespace string, opts *app.LogOptions) (io.ReadCloser, error) {
+	return k.appLogs(namespace, opts, appLogsPollInterval)
+}
+
+func (k *Client) appLogs(namespace string, opts *app.LogOptions, pollInterval time.Duration) (io.ReadCloser, error) {
+	kc, err := k.buildClient()
+	if err != nil {
+		return nil, err
+	}
+	pods := kc.CoreV1().Pods(namespace)
+	listOpts := metav1.ListOptions{LabelSelector: fmt.Sprintf("run=%s", namespace)}
+	seen := make(map[string]bool)
+
+	m := newLogMerger()
+	addNewPods := func() error {
+		podList, err := pods.List(listOpts)
+		if err != nil {
+			return errors.Wrap(err, "list pods failed")
 		}
-		return nil, errors.Wrap(err, "get autoscale failed")
+		for _, pod := range podList.Items {
+			if seen[pod.Name] || pod.Status.Phase != k8sv1.PodRunning {
+				continue
+			}
+			stream, err := pods.GetLogs(pod.Name, appLogOptsToK8s(opts)).Stream()
+			if err != nil {
+				continue
+			}
+			seen[pod.Name] = true
+			m.add(&namedLogStream{name: pod.Name, stream: stream})
+		}
+		return nil
 	}
 
-	var cpu, min int32
-	if hpa.Spec.TargetCPUUtilizationPercentage != nil {
-		cpu = *hpa.Spec.TargetCPUUtilizationPercentage
+	if err := addNewPods(); err != nil {
+		m.Close()
+		return nil, err
 	}
-	if hpa.Spec.MinReplicas != nil {
-		min = *hpa.Spec.MinReplicas
+	if !opts.Follow {
+		m.closeWhenDone()
+		return m, nil
+	}
+
+	go func() {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.done:
+				return
+			case <-ticker.C:
+				addNewPods()
+			}
+		}
+	}()
+	return m, nil
+}
+
+// AppFromNamespace decodes the app stored on the namespace annotation
+func (k *Client) AppFromNamespace(namespace string) (*app.App, error) {
+	ns, err := k.getNamespace(namespace)
+	if err != nil {
+		return nil, errors.Wrap(err, "get namespace failed")
+	}
+	return appFromNs(ns)
+}
+
+func (k *Client) patchNamespace(namespace string, data []byte) error {
+	kc, err := k.buildClient()
+	if err != nil {
+		return err
+	}
+	_, err = kc.CoreV1().Namespaces().Patch(
+		namespace,
+		types.StrategicMergePatchType,
+		data,
+	)
+	return errors.Wrap(err, "patch namespace failed")
+}
+
+// UpdateAppAnnotation refreshes the app stored on the namespace annotation
+// without touching the rest of the namespace
+func (k *Client) UpdateAppAnnotation(a *app.App) error {
+	b, err := json.Marshal(a)
+	if err != nil {
+		return errors.Wrap(err, "marshal app failed")
+	}
+	data, err := prepareAnnotations(
+		patchAnnotationsTmpl,
+		map[string]string{app.TeresaAnnotation: string(b)},
+	)
+	if err != nil {
+		return err
+	}
+	return k.patchNamespace(a.Name, data)
+}
+
+func prepareDeleteKeysPatch(tmpl string, keys []string) ([]byte, error) {
+	m := make(map[string]interface{})
+	for _, key := range keys {
+		m[key] = nil
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to json encode")
+	}
+	return []byte(fmt.Sprintf(tmpl, string(b))), nil
+}
+
+// DeleteNamespaceLabels removes the given labels from the namespace,
+// keeping the others untouched
+func (k *Client) DeleteNamespaceLabels(namespace string, keys []string) error {
+	data, err := prepareDeleteKeysPatch(patchNamespaceLabelsTmpl, keys)
+	if err != nil {
+		return err
+	}
+	return k.patchNamespace(namespace, data)
+}
+
+// DeleteNamespaceAnnotations removes the given annotations from the
+// namespace, keeping the others untouched
+func (k *Client) DeleteNamespaceAnnotations(namespace string, keys []string) error {
+	data, err := prepareDeleteKeysPatch(patchAnnotationsTmpl, keys)
+	if err != nil {
+		return err
+	}
+	return k.patchNamespace(namespace, data)
+}
+
+func addLimitRangeQuantityToResourceList(r *k8sv1.ResourceList, lrQuantity []*app.LimitRangeQuantity) error {
+	if lrQuantity == nil {
+		return nil
+	}
+
+	rl := k8sv1.ResourceList{}
+	for _, item := range lrQuantity {
+		name := k8sv1.ResourceName(item.Resource)
+		q, err := resource.ParseQuantity(item.Quantity)
+		if err != nil {
+			return err
+		}
+		rl[name] = q
+	}
+	*r = rl
+	return nil
+}
+
+func parseLimitRangeParams(lrItem *k8sv1.LimitRangeItem, lim *app.Limits) error {
+	if err := addLimitRangeQuantityToResourceList(&lrItem.Default, lim.Default); err != nil {
+		return err
+	}
+	return addLimitRangeQuantityToResourceList(&lrItem.DefaultRequest, lim.DefaultRequest)
+}
+
+func newLimitRange(a *app.App) (*k8sv1.LimitRange, error) {
+	lrItem := k8sv1.LimitRangeItem{Type: k8sv1.LimitTypeContainer}
+	if err := parseLimitRangeParams(&lrItem, a.Limits); err != nil {
+		return nil, err
+	}
+
+	lr := &k8sv1.LimitRange{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "limits",
+		},
+		Spec: k8sv1.LimitRangeSpec{
+			Limits: []k8sv1.LimitRangeItem{lrItem},
+		},
+	}
+	return lr, nil
+}
+
+func newResourceQuota(a *app.App) (*k8sv1.ResourceQuota, error) {
+	rq := &k8sv1.ResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      resourceQuotaName,
+			Namespace: a.Name,
+		},
+	}
+	if err := addLimitRangeQuantityToResourceList(&rq.Spec.Hard, a.Quota); err != nil {
+		return nil, err
+	}
+	return rq, nil
+}
+
+func resourceListToLimitRangeQuantity(rl k8sv1.ResourceList) []*app.LimitRangeQuantity {
+	var lrq []*app.LimitRangeQuantity
+	for k, v := range rl {
+		lrq = append(lrq, &app.LimitRangeQuantity{
+			Resource: string(k),
+			Quantity: v.String(),
+		})
 	}
+	return lrq
+}
+
+func newHPA(a *app.App) *asv1.HorizontalPodAutoscaler {
+	tcpu := a.Autoscale.CPUTargetUtilization
+	minr := a.Autoscale.Min
+
+	return &asv1.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      a.Name,
+			Namespace: a.Name,
+		},
+		Spec: asv1.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: asv1.CrossVersionObjectReference{
+				APIVersion: "extensions/v1beta1",
+				Kind:       "Deployment",
+				Name:       a.Name,
+			},
+			TargetCPUUtilizationPercentage: &tcpu,
+			MaxReplicas:                    a.Autoscale.Max,
+			MinReplicas:                    &minr,
+		},
+	}
+}
+
+func newHPAV2alpha1(a *app.App) (*asv2alpha1.HorizontalPodAutoscaler, error) {
+	minr := a.Autoscale.Min
+
+	metrics := make([]asv2alpha1.MetricSpec, 0)
+	if a.Autoscale.CPUTargetUtilization > 0 || a.CustomMetric == nil {
+		tcpu := a.Autoscale.CPUTargetUtilization
+		metrics = append(metrics, asv2alpha1.MetricSpec{
+			Type: asv2alpha1.ResourceMetricSourceType,
+			Resource: &asv2alpha1.ResourceMetricSource{
+				Name:                     k8sv1.ResourceCPU,
+				TargetAverageUtilization: &tcpu,
+			},
+		})
+	}
+	if a.CustomMetric != nil {
+		q, err := resource.ParseQuantity(a.CustomMetric.TargetAverageValue)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid custom metric target")
+		}
+		metrics = append(metrics, asv2alpha1.MetricSpec{
+			Type: asv2alpha1.PodsMetricSourceType,
+			Pods: &asv2alpha1.PodsMetricSource{
+				MetricName:         a.CustomMetric.Name,
+				TargetAverageValue: q,
+			},
+		})
+	}
+
+	return &asv2alpha1.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      a.Name,
+			Namespace: a.Name,
+		},
+		Spec: asv2alpha1.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: asv2alpha1.CrossVersionObjectReference{
+				APIVersion: "extensions/v1beta1",
+				Kind:       "Deployment",
+				Name:       a.Name,
+			},
+			MaxReplicas: a.Autoscale.Max,
+			MinReplicas: &minr,
+			Metrics:     metrics,
+		},
+	}, nil
+}
+
+func hpaV2alpha1CustomMetric(hpa *asv2alpha1.HorizontalPodAutoscaler) *app.CustomMetric {
+	for _, m := range hpa.Spec.Metrics {
+		if m.Type != asv2alpha1.PodsMetricSourceType || m.Pods == nil {
+			continue
+		}
+		return &app.CustomMetric{
+			Name:               m.Pods.MetricName,
+			TargetAverageValue: m.Pods.TargetAverageValue.String(),
+		}
+	}
+	return nil
+}
+
+// newPDB keeps all but one of the app pods available during voluntary
+// disruptions (e.g. node drains)
+func newPDB(a *app.App, replicas int32) *policy.PodDisruptionBudget {
+	minAvailable := intstr.FromInt(int(replicas - 1))
+
+	return &policy.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      a.Name,
+			Namespace: a.Name,
+		},
+		Spec: policy.PodDisruptionBudgetSpec{
+			MinAvailable: &minAvailable,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"run": a.Name},
+			},
+		},
+	}
+}
+
+func (k *Client) CreateNamespace(a *app.App, user string) error {
+	kc, err := k.buildClient()
+	if err != nil {
+		return err
+	}
+
+	ns := newNs(a, user)
+	if err := addAppToNs(a, ns); err != nil {
+		return err
+	}
+
+	_, err = kc.CoreV1().Namespaces().Create(ns)
+	return err
+}
+
+func (k *Client) CreateQuota(a *app.App) error {
+	kc, err := k.buildClient()
+	if err != nil {
+		return err
+	}
+
+	lr, err := newLimitRange(a)
+	if err != nil {
+		return err
+	}
+
+	_, err = kc.CoreV1().LimitRanges(a.Name).Create(lr)
+	return err
+}
+
+// CreateOrUpdateResourceQuota caps the total resources of the app namespace
+func (k *Client) CreateOrUpdateResourceQuota(a *app.App) error {
+	if len(a.Quota) == 0 {
+		return nil
+	}
+
+	kc, err := k.buildClient()
+	if err != nil {
+		return err
+	}
+
+	rq, err := newResourceQuota(a)
+	if err != nil {
+		return err
+	}
+
+	_, err = kc.CoreV1().ResourceQuotas(a.Name).Update(rq)
+	if k.IsNotFound(err) {
+		_, err = kc.CoreV1().ResourceQuotas(a.Name).Create(rq)
+	}
+	return err
+}
+
+func (k *Client) ResourceQuota(namespace string) ([]*app.LimitRangeQuantity, error) {
+	kc, err := k.buildClient()
+	if err != nil {
+		return nil, err
+	}
+
+	rq, err := kc.CoreV1().ResourceQuotas(namespace).Get(resourceQuotaName, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "get resource quota failed")
+	}
+	return resourceListToLimitRangeQuantity(rq.Spec.Hard), nil
+}
+
+// QuotaStatus returns the used and hard quantities of each resource in the
+// namespace quota, nil is returned if the namespace has no quota
+func (k *Client) QuotaStatus(namespace string) ([]*app.QuotaUsage, error) {
+	kc, err := k.buildClient()
+	if err != nil {
+		return nil, err
+	}
+
+	rq, err := kc.CoreV1().ResourceQuotas(namespace).Get(resourceQuotaName, metav1.GetOptions{})
+	if err != nil {
+		if k.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "get quota status failed")
+	}
+
+	names := make([]string, 0, len(rq.Status.Hard))
+	for name := range rq.Status.Hard {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+
+	usage := make([]*app.QuotaUsage, len(names))
+	for i, name := range names {
+		hard := rq.Status.Hard[k8sv1.ResourceName(name)]
+		used := rq.Status.Used[k8sv1.ResourceName(name)]
+		usage[i] = &app.QuotaUsage{
+			Resource: name,
+			Used:     used.String(),
+			Hard:     hard.String(),
+		}
+	}
+	return usage, nil
+}
+
+func (c *Client) GetSecret(namespace, secretName string) (map[string][]byte, error) {
+	kc, err := c.buildClient()
+	if err != nil {
+		return nil, err
+	}
+	s, err := kc.CoreV1().Secrets(namespace).Get(secretName, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return s.Data, nil
+}
+
+// SecretKeys returns the sorted keys of the secret, leaving the values out
+func (c *Client) SecretKeys(namespace, secretName string) ([]string, error) {
+	data, err := c.GetSecret(namespace, secretName)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// CreateOrUpdateTLSSecret stores the cert and key on a kubernetes.io/tls
+// secret, used by the ingress to terminate TLS
+func (c *Client) CreateOrUpdateTLSSecret(namespace, name string, cert, key []byte) error {
+	if _, err := tls.X509KeyPair(cert, key); err != nil {
+		return errors.Wrap(ErrInvalidTLSKeyPair, err.Error())
+	}
+
+	kc, err := c.buildClient()
+	if err != nil {
+		return err
+	}
+
+	s := &k8sv1.Secret{
+		Type: k8sv1.SecretTypeTLS,
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Data: map[string][]byte{
+			k8sv1.TLSCertKey:       cert,
+			k8sv1.TLSPrivateKeyKey: key,
+		},
+	}
+
+	_, err = kc.CoreV1().Secrets(namespace).Update(s)
+	if c.IsNotFound(err) {
+		_, err = kc.CoreV1().Secrets(namespace).Create(s)
+	}
+	return err
+}
+
+func (c *Client) CreateOrUpdateSecret(namespace, secretName string, data map[string][]byte) error {
+	kc, err := c.buildClient()
+	if err != nil {
+		return err
+	}
+
+	s := &k8sv1.Secret{
+		Type: k8sv1.SecretTypeOpaque,
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      secretName,
+			Namespace: namespace,
+		},
+		Data: data,
+	}
+
+	_, err = kc.CoreV1().Secrets(namespace).Update(s)
+	if c.IsNotFound(err) {
+		_, err = kc.CoreV1().Secrets(namespace).Create(s)
+	}
+	return err
+}
+
+// PatchSecretData merges data into the secret, the keys not present on data
+// are kept untouched
+func (c *Client) PatchSecretData(namespace, secretName string, data map[string][]byte) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return errors.Wrap(err, "failed to json encode secret data")
+	}
+
+	kc, err := c.buildClient()
+	if err != nil {
+		return err
+	}
+
+	_, err = kc.CoreV1().Secrets(namespace).Patch(
+		secretName,
+		types.StrategicMergePatchType,
+		[]byte(fmt.Sprintf(patchSecretDataTmpl, string(b))),
+	)
+	return errors.Wrap(err, "patch secret failed")
+}
+
+// DeleteSecretKeys removes the given keys from the secret, keeping the
+// others untouched
+func (c *Client) DeleteSecretKeys(namespace, secretName string, keys []string) error {
+	data, err := prepareDeleteKeysPatch(patchSecretDataTmpl, keys)
+	if err != nil {
+		return err
+	}
+
+	kc, err := c.buildClient()
+	if err != nil {
+		return err
+	}
+
+	_, err = kc.CoreV1().Secrets(namespace).Patch(secretName, types.MergePatchType, data)
+	return errors.Wrap(err, "patch secret failed")
+}
+
+func (k *Client) CreateOrUpdateAutoscale(a *app.App) error {
+	kc, err := k.buildClient()
+	if err != nil {
+		return err
+	}
+
+	// autoscaling/v1 only supports cpu utilization, the alpha API is
+	// used just by the apps with a custom metric
+	if a.CustomMetric != nil {
+		if _, err := k.preferredGroupVersion(kc, customMetricGroupVersions); err != nil {
+			return err
+		}
+		hpa, err := newHPAV2alpha1(a)
+		if err != nil {
+			return err
+		}
+		_, err = kc.AutoscalingV2alpha1().HorizontalPodAutoscalers(a.Name).Update(hpa)
+		if k.IsNotFound(err) {
+			_, err = kc.AutoscalingV2alpha1().HorizontalPodAutoscalers(a.Name).Create(hpa)
+		}
+		return err
+	}
+
+	hpa := newHPA(a)
+
+	_, err = kc.AutoscalingV1().HorizontalPodAutoscalers(a.Name).Update(hpa)
+	if k.IsNotFound(err) {
+		_, err = kc.AutoscalingV1().HorizontalPodAutoscalers(a.Name).Create(hpa)
+	}
+	return err
+}
+
+// CreateOrUpdatePDB creates the app PodDisruptionBudget based on the
+// autoscale min (or the current deploy replicas). Apps with a single
+// replica have their budget removed, it would block node drains.
+func (k *Client) CreateOrUpdatePDB(a *app.App) error {
+	replicas := k.currentPodReplicasFromDeploy(a.Name, a.Name)
+	if a.Autoscale != nil && a.Autoscale.Min > 0 {
+		replicas = a.Autoscale.Min
+	}
+
+	kc, err := k.buildClient()
+	if err != nil {
+		return err
+	}
+
+	if replicas < 2 {
+		err = kc.PolicyV1beta1().PodDisruptionBudgets(a.Name).Delete(a.Name, &metav1.DeleteOptions{})
+		if err != nil && !k.IsNotFound(err) {
+			return errors.Wrap(err, "delete pdb failed")
+		}
+		return nil
+	}
+
+	pdb := newPDB(a, replicas)
+	cur, err := kc.PolicyV1beta1().PodDisruptionBudgets(a.Name).Get(a.Name, metav1.GetOptions{})
+	if err != nil && !k.IsNotFound(err) {
+		return errors.Wrap(err, "get pdb failed")
+	}
+	if err == nil {
+		if cur.Spec.MinAvailable != nil && *cur.Spec.MinAvailable == *pdb.Spec.MinAvailable {
+			return nil
+		}
+		// the PDB spec is immutable, it must be recreated
+		err = kc.PolicyV1beta1().PodDisruptionBudgets(a.Name).Delete(a.Name, &metav1.DeleteOptions{})
+		if err != nil && !k.IsNotFound(err) {
+			return errors.Wrap(err, "delete pdb failed")
+		}
+	}
+	_, err = kc.PolicyV1beta1().PodDisruptionBudgets(a.Name).Create(pdb)
+	return errors.Wrap(err, "create pdb failed")
+}
+
+// PDBMinAvailable returns the minAvailable of the app PodDisruptionBudget,
+// zero if the app doesn't have one
+func (k *Client) PDBMinAvailable(namespace string) (int32, error) {
+	kc, err := k.buildClient()
+	if err != nil {
+		return 0, err
+	}
+
+	pdb, err := kc.PolicyV1beta1().PodDisruptionBudgets(namespace).Get(namespace, metav1.GetOptions{})
+	if err != nil {
+		if k.IsNotFound(err) {
+			return 0, nil
+		}
+		return 0, errors.Wrap(err, "get pdb failed")
+	}
+	if pdb.Spec.MinAvailable == nil {
+		return 0, nil
+	}
+	return int32(pdb.Spec.MinAvailable.IntValue()), nil
+}
+
+func (k *Client) AddressList(namespace string) ([]*app.Address, error) {
+	kc, err := k.buildClient()
+	if err != nil {
+		return nil, err
+	}
+
+	srvs, err := kc.CoreV1().Services(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "get addr list failed")
+	}
+
+	addrs := []*app.Address{}
+	for _, srv := range srvs.Items {
+		for _, i := range srv.Status.LoadBalancer.Ingress {
+			h := i.Hostname
+			if h == "" {
+				h = i.IP
+			}
+			addrs = append(addrs, &app.Address{Hostname: h})
+		}
+	}
+	return addrs, nil
+}
+
+func (k *Client) Status(namespace string) (*app.Status, error) {
+	kc, err := k.buildClient()
+	if err != nil {
+		return nil, err
+	}
+
+	pods, err := k.PodList(namespace, &app.PodListOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "get status failed")
+	}
+
+	hpa, err := kc.AutoscalingV1().
+		HorizontalPodAutoscalers(namespace).
+		Get(namespace, metav1.GetOptions{})
+
+	if err != nil {
+		if !k.IsNotFound(err) {
+			return nil, errors.Wrap(err, "get status failed")
+		}
+	}
+
+	var cpu int32 = -1
+	if hpa != nil && hpa.Status.CurrentCPUUtilizationPercentage != nil {
+		cpu = *hpa.Status.CurrentCPUUtilizationPercentage
+	}
+
+	stat := &app.Status{
+		CPU:  cpu,
+		Pods: pods,
+	}
+	return stat, nil
+}
+
+func (k *Client) Autoscale(namespace string) (*app.Autoscale, error) {
+	kc, err := k.buildClient()
+	if err != nil {
+		return nil, err
+	}
+
+	hpa, err := kc.AutoscalingV1().
+		HorizontalPodAutoscalers(namespace).
+		Get(namespace, metav1.GetOptions{})
+
+	if err != nil {
+		if k.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "get autoscale failed")
+	}
+
+	var cpu, min int32
+	if hpa.Spec.TargetCPUUtilizationPercentage != nil {
+		cpu = *hpa.Spec.TargetCPUUtilizationPercentage
+	}
+	if hpa.Spec.MinReplicas != nil {
+		min = *hpa.Spec.MinReplicas
+	}
+
+	as := &app.Autoscale{
+		CPUTargetUtilization: cpu,
+		Min:                  min,
+		Max:                  hpa.Spec.MaxReplicas,
+	}
+	return as, nil
+}
+
+// CustomMetric returns the custom metric used by the app autoscale, if any
+func (k *Client) CustomMetric(namespace string) (*app.CustomMetric, error) {
+	kc, err := k.buildClient()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := k.preferredGroupVersion(kc, customMetricGroupVersions); err != nil {
+		if err == ErrUnsupportedAPIVersion {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	hpa, err := kc.AutoscalingV2alpha1().
+		HorizontalPodAutoscalers(namespace).
+		Get(namespace, metav1.GetOptions{})
+	if err != nil {
+		if k.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "get autoscale failed")
+	}
+	return hpaV2alpha1CustomMetric(hpa), nil
+}
+
+// HasAutoscale reports if an HPA manages the app deploy, manual scaling is
+// reverted by it
+func (k *Client) HasAutoscale(namespace string) (bool, error) {
+	as, err := k.Autoscale(namespace)
+	if err != nil {
+		return false, err
+	}
+	return as != nil, nil
+}
+
+// DeleteAutoscale turns the app autoscale off, an app without one is fine
+func (k *Client) DeleteAutoscale(namespace string) error {
+	kc, err := k.buildClient()
+	if err != nil {
+		return err
+	}
+
+	err = kc.AutoscalingV1().HorizontalPodAutoscalers(namespace).Delete(namespace, &metav1.DeleteOptions{})
+	if err != nil && !k.IsNotFound(err) {
+		return errors.Wrap(err, "delete autoscale failed")
+	}
+	return nil
+}
+
+func (k *Client) Limits(namespace, name string) (*app.Limits, error) {
+	kc, err := k.buildClient()
+	if err != nil {
+		return nil, err
+	}
+
+	lr, err := kc.CoreV1().LimitRanges(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "get limits failed")
+	}
+
+	var def, defReq []*app.LimitRangeQuantity
+	for _, item := range lr.Spec.Limits {
+		for k, v := range item.Default {
+			q := &app.LimitRangeQuantity{
+				Resource: string(k),
+				Quantity: v.String(),
+			}
+			def = append(def, q)
+		}
+		for k, v := range item.DefaultRequest {
+			q := &app.LimitRangeQuantity{
+				Resource: string(k),
+				Quantity: v.String(),
+			}
+			defReq = append(defReq, q)
+		}
+	}
+
+	lim := &app.Limits{
+		Default:        def,
+		DefaultRequest: defReq,
+	}
+	return lim, nil
+}
+
+func (k *Client) CreateOrUpdateConfigMap(namespace, name string, data map[string]string) error {
+	kc, err := k.buildClient()
+	if err != nil {
+		return err
+	}
+
+	cm := configMapSpec(namespace, name, data)
+	_, err = kc.CoreV1().ConfigMaps(namespace).Update(cm)
+	if k.IsNotFound(err) {
+		_, err = kc.CoreV1().ConfigMaps(namespace).Create(cm)
+	}
+	return err
+}
+
+// ValidateDeploySpec checks the deploy spec before sending it to the API
+// server, the returned error describes all the problems found
+func (k *Client) ValidateDeploySpec(deploySpec *spec.Deploy) error {
+	var errs []error
+	for _, cs := range deploySpec.InitContainers {
+		errs = append(errs, validateContainerSpec(cs)...)
+	}
+	for _, cs := range deploySpec.Containers {
+		errs = append(errs, validateContainerSpec(cs)...)
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+func (k *Client) CreateOrUpdateDeploy(deploySpec *spec.Deploy) error {
+	kc, err := k.buildClient()
+	if err != nil {
+		return err
+	}
+
+	replicas := k.currentPodReplicasFromDeploy(deploySpec.Namespace, deploySpec.Name)
+	deployYaml, err := deploySpecToK8sDeploy(deploySpec, replicas)
+	if err != nil {
+		return err
+	}
+
+	if k.dryRun != nil {
+		return k.writeDryRun(deployYaml)
+	}
+
+	gv, err := k.preferredGroupVersion(kc, deployGroupVersions)
+	if err != nil {
+		return err
+	}
+
+	if gv == extensionsV1beta1GroupVersion {
+		ed, err := appsToExtensionsDeploy(deployYaml)
+		if err != nil {
+			return err
+		}
+		_, err = kc.ExtensionsV1beta1().Deployments(deploySpec.Namespace).Update(ed)
+		if k.IsNotFound(err) {
+			_, err = kc.ExtensionsV1beta1().Deployments(deploySpec.Namespace).Create(ed)
+		}
+		return err
+	}
+
+	_, err = kc.AppsV1beta1().Deployments(deploySpec.Namespace).Update(deployYaml)
+	if k.IsNotFound(err) {
+		_, err = kc.AppsV1beta1().Deployments(deploySpec.Namespace).Create(deployYaml)
+	}
+	return err
+}
+
+// RenderDeploy returns the deploy generated from the spec as YAML without
+// reaching the cluster. An empty groupVersion renders it as apps/v1beta1,
+// the one CreateOrUpdateDeploy prefers, and replicas lower than 1 as 1
+func RenderDeploy(deploySpec *spec.Deploy, groupVersion string, replicas int32) ([]byte, error) {
+	if groupVersion == "" {
+		groupVersion = appsV1beta1GroupVersion
+	}
+	if replicas < 1 {
+		replicas = 1
+	}
+	d, err := deploySpecToK8sDeploy(deploySpec, replicas)
+	if err != nil {
+		return nil, err
+	}
+
+	var obj interface{} = d
+	switch groupVersion {
+	case appsV1beta1GroupVersion:
+		d.TypeMeta.APIVersion = appsV1beta1GroupVersion
+	case extensionsV1beta1GroupVersion:
+		if obj, err = appsToExtensionsDeploy(d); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.Wrapf(ErrUnsupportedAPIVersion, "%q", groupVersion)
+	}
+	b, err := yaml.Marshal(obj)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal deploy failed")
+	}
+	return b, nil
+}
+
+func (c *Client) CreateOrUpdateCronJob(cronJobSpec *spec.CronJob) error {
+	kc, err := c.buildClient()
+	if err != nil {
+		return err
+	}
+
+	cronJobYaml, err := cronJobSpecToK8sCronJob(cronJobSpec)
+	if err != nil {
+		return err
+	}
+
+	if c.dryRun != nil {
+		return c.writeDryRun(cronJobYaml)
+	}
+
+	_, err = kc.CronJobs(cronJobSpec.Namespace).Update(cronJobYaml)
+	if c.IsNotFound(err) {
+		_, err = kc.CronJobs(cronJobSpec.Namespace).Create(cronJobYaml)
+	}
+	return err
+}
+
+func (k *Client) PodRun(podSpec *spec.Pod) (io.ReadCloser, <-chan int, error) {
+	select {
+	case <-k.runs.stopped():
+		return nil, nil, ErrClientClosed
+	default:
+	}
+	kc, err := k.buildClient()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	podYaml, err := podSpecToK8sPod(podSpec)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "define build pod spec failed")
+	}
+	pod, err := kc.Pods(podSpec.Namespace).Create(podYaml)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "pod create failed")
+	}
+	r, w := io.Pipe()
+	if !k.runs.add(pod, w) {
+		k.DeletePod(pod.Namespace, pod.Name)
+		return nil, nil, ErrClientClosed
+	}
+
+	// buffered, the caller may stop waiting for the exit code
+	exitCodeChan := make(chan int, 1)
+	go func() {
+		exitCode := 1
+		defer func() {
+			w.Close()
+			exitCodeChan <- exitCode
+			close(exitCodeChan)
+			go func() {
+				k.DeletePod(pod.Namespace, pod.Name)
+				k.runs.done(pod)
+			}()
+		}()
+
+		if err := k.waitPodStart(pod, 1*time.Second, 5*time.Minute); err != nil {
+			fmt.Fprintln(w, err)
+			return
+		}
+
+		opts := &app.LogOptions{Lines: 10, Follow: true}
+		stream, err := k.PodLogs(podSpec.Namespace, podSpec.Name, opts)
+		if err != nil {
+			return
+		}
+		defer stream.Close()
+		copied := make(chan struct{})
+		go func() {
+			select {
+			case <-k.runs.stopped():
+				stream.Close()
+			case <-copied:
+			}
+		}()
+		io.Copy(w, stream)
+		close(copied)
+
+		if err = k.waitPodEnd(pod, 3*time.Second, k.podRunTimeoutFor(podSpec)); err != nil {
+			if err == wait.ErrWaitTimeout {
+				exitCode = PodRunTimeoutExitCode
+			}
+			return
+		}
+
+		exitCode, _ = k.podExitCode(pod, pod.Spec.Containers[0].Name)
+	}()
+	return r, exitCodeChan, nil
+}
+
+// PodExec runs the command in a container of a running pod, like kubectl
+// exec. The command exit code is returned, the error is only about the
+// streaming. With tty the stderr is merged into stdout
+func (k *Client) PodExec(namespace, podName, container string, cmd []string, stdin io.Reader, stdout, stderr io.Writer, tty bool) (int, error) {
+	u, err := k.podExecURL(namespace, podName, container, cmd, stdin != nil, tty)
+	if err != nil {
+		return 1, err
+	}
+	if tty {
+		stderr = nil
+	}
+	return k.streamPod(u, remotecommand.StreamOptions{
+		Stdin:  stdin,
+		Stdout: stdout,
+		Stderr: stderr,
+		Tty:    tty,
+	})
+}
+
+// streamPod streams over the exec or attach subresource of the pod. A non
+// zero exit of the remote process isn't an error, only its code
+func (k *Client) streamPod(u *url.URL, opts remotecommand.StreamOptions) (int, error) {
+	executor, err := remotecommand.NewExecutor(k.conf, http.MethodPost, u)
+	if err != nil {
+		return 1, errors.Wrap(err, "create executor failed")
+	}
+	opts.SupportedProtocols = remotecommandconsts.SupportedStreamingProtocols
+	if err := executor.Stream(opts); err != nil {
+		if exitErr, ok := err.(utilexec.ExitError); ok && exitErr.Exited() {
+			return exitErr.ExitStatus(), nil
+		}
+		return 1, errors.Wrap(err, "stream failed")
+	}
+	return 0, nil
+}
+
+func (k *Client) podExecURL(namespace, podName, container string, cmd []string, stdin, tty bool) (*url.URL, error) {
+	kc, err := k.buildClient()
+	if err != nil {
+		return nil, err
+	}
+
+	req := kc.CoreV1().RESTClient().Post().
+		Namespace(namespace).
+		Resource("pods").
+		Name(podName).
+		SubResource("exec").
+		Param("container", container).
+		Param("stdout", "true").
+		Param("stderr", strconv.FormatBool(!tty))
+
+	for _, c := range cmd {
+		req = req.Param("command", c)
+	}
+	if stdin {
+		req = req.Param("stdin", "true")
+	}
+	if tty {
+		req = req.Param("tty", "true")
+	}
+	return req.URL(), nil
+}
+
+// PodRunInteractive creates the pod and attaches to its main container with
+// a TTY, like kubectl run -it. The TTY merges the container stderr into
+// stdout, stderr only gets the errors of the run itself. Terminal resizes are
+// not forwarded. The pod is deleted once its process ends
+func (k *Client) PodRunInteractive(podSpec *spec.Pod, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+	select {
+	case <-k.runs.stopped():
+		return 1, ErrClientClosed
+	default:
+	}
+	if stderr == nil {
+		stderr = ioutil.Discard
+	}
+	kc, err := k.buildClient()
+	if err != nil {
+		return 1, err
+	}
+
+	podYaml, err := podSpecToK8sPod(podSpec)
+	if err != nil {
+		return 1, errors.Wrap(err, "define interactive pod spec failed")
+	}
+	setPodInteractive(podYaml)
+	pod, err := kc.Pods(podSpec.Namespace).Create(podYaml)
+	if err != nil {
+		return 1, errors.Wrap(err, "pod create failed")
+	}
+	if !k.runs.add(pod, nil) {
+		k.DeletePod(pod.Namespace, pod.Name)
+		return 1, ErrClientClosed
+	}
+	defer func() {
+		k.DeletePod(pod.Namespace, pod.Name)
+		k.runs.done(pod)
+	}()
+
+	if err := k.waitPodStart(pod, 1*time.Second, 5*time.Minute); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1, err
+	}
+
+	container := podYaml.Spec.Containers[0].Name
+	u, err := k.podAttachURL(pod.Namespace, pod.Name, container, true)
+	if err != nil {
+		return 1, err
+	}
+	opts := remotecommand.StreamOptions{Stdin: stdin, Stdout: stdout, Tty: true}
+	if _, err := k.streamPod(u, opts); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1, err
+	}
+
+	// attach doesn't report the exit code, it comes from the pod status
+	if err := k.waitPodEnd(pod, 1*time.Second, k.podRunTimeoutFor(podSpec)); err != nil {
+		if err == wait.ErrWaitTimeout {
+			return PodRunTimeoutExitCode, nil
+		}
+		return 1, err
+	}
+	return k.podExitCode(pod, container)
+}
+
+// setPodInteractive allocates stdin and a TTY on the pod main container
+func setPodInteractive(pod *k8sv1.Pod) {
+	if len(pod.Spec.Containers) == 0 {
+		return
+	}
+	c := &pod.Spec.Containers[0]
+	c.Stdin = true
+	c.StdinOnce = true
+	c.TTY = true
+}
+
+func (k *Client) podAttachURL(namespace, podName, container string, tty bool) (*url.URL, error) {
+	kc, err := k.buildClient()
+	if err != nil {
+		return nil, err
+	}
+
+	req := kc.CoreV1().RESTClient().Post().
+		Namespace(namespace).
+		Resource("pods").
+		Name(podName).
+		SubResource("attach").
+		Param("container", container).
+		Param("stdin", "true").
+		Param("stdout", "true").
+		Param("stderr", strconv.FormatBool(!tty))
+
+	if tty {
+		req = req.Param("tty", "true")
+	}
+	return req.URL(), nil
+}
+
+// Close cancels the active pod runs, closing their streams and deleting
+// their pods, and waits a while for them to finish. PodRun fails with
+// ErrClientClosed afterwards
+func (k *Client) Close() error {
+	return k.close(podRunsCloseTimeout)
+}
+
+func (k *Client) close(timeout time.Duration) error {
+	if k.runs == nil {
+		return nil
+	}
+	var errs []error
+	for _, run := range k.runs.close() {
+		// interactive runs end with their pod
+		if run.w != nil {
+			run.w.CloseWithError(ErrClientClosed)
+		}
+		if err := k.DeletePod(run.pod.Namespace, run.pod.Name); err != nil && !k.IsNotFound(err) {
+			errs = append(errs, err)
+		}
+	}
+	if !k.runs.wait(timeout) {
+		errs = append(errs, ErrPodRunsStillRunning)
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+func (k *Client) podRunTimeoutFor(podSpec *spec.Pod) time.Duration {
+	if podSpec.Timeout > 0 {
+		return podSpec.Timeout
+	}
+	return k.podRunTimeout
+}
+
+func (k *Client) hasService(namespace, appName string) (bool, error) {
+	kc, err := k.buildClient()
+	if err != nil {
+		return false, err
+	}
+	_, err = kc.CoreV1().Services(namespace).Get(appName, metav1.GetOptions{})
+	if err != nil {
+		if k.IsNotFound(err) {
+			return false, nil
+		}
+		return false, errors.Wrap(err, "get service failed")
+	}
+	return true, nil
+}
+
+// WaitForAddress waits the cloud provider to provision the load balancer of
+// the app service and returns its address
+func (k *Client) WaitForAddress(namespace, appName string, timeout time.Duration) (string, error) {
+	return k.waitForAddress(namespace, appName, 5*time.Second, timeout)
+}
+
+func (k *Client) waitForAddress(namespace, appName string, checkInterval, timeout time.Duration) (string, error) {
+	kc, err := k.buildClient()
+	if err != nil {
+		return "", err
+	}
+	var addr string
+	err = wait.PollImmediate(checkInterval, timeout, func() (bool, error) {
+		svc, err := kc.CoreV1().Services(namespace).Get(appName, metav1.GetOptions{})
+		if err != nil {
+			return false, errors.Wrap(err, "get service failed")
+		}
+		if svc.Spec.ClusterIP == k8sv1.ClusterIPNone {
+			return false, ErrHeadlessService
+		}
+		for _, i := range svc.Status.LoadBalancer.Ingress {
+			addr = i.Hostname
+			if addr == "" {
+				addr = i.IP
+			}
+			if addr != "" {
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	return addr, err
+}
+
+func (k *Client) createService(namespace, appName, svcType string, opts *service.ServiceOptions) error {
+	kc, err := k.buildClient()
+	if err != nil {
+		return err
+	}
+	if opts != nil {
+		if err := validateSourceRanges(opts.SourceRanges); err != nil {
+			return err
+		}
+		names := make([]string, len(opts.Ports))
+		for i := range opts.Ports {
+			names[i] = opts.Ports[i].Name
+		}
+		if err := validateServicePortNames(names); err != nil {
+			return err
+		}
+		if err := validateServicePortProtocols(opts.Ports); err != nil {
+			return err
+		}
+	}
+	srvSpec := serviceSpec(namespace, appName, svcType, opts)
+	_, err = kc.CoreV1().Services(namespace).Create(srvSpec)
+	return errors.Wrap(err, "create service failed")
+}
+
+// setServiceTargetPort points the first port of an existing service to
+// targetPort, the service isn't updated when it already does
+func (k *Client) setServiceTargetPort(namespace, appName string, targetPort int32) error {
+	kc, err := k.buildClient()
+	if err != nil {
+		return err
+	}
+	svc, err := kc.CoreV1().Services(namespace).Get(appName, metav1.GetOptions{})
+	if err != nil {
+		return errors.Wrap(err, "get service failed")
+	}
+	if len(svc.Spec.Ports) == 0 || svc.Spec.Ports[0].TargetPort.IntValue() == int(targetPort) {
+		return nil
+	}
+	svc.Spec.Ports[0].TargetPort = intstr.FromInt(int(targetPort))
+	_, err = kc.CoreV1().Services(namespace).Update(svc)
+	return errors.Wrap(err, "update service failed")
+}
+
+func (k *Client) HasIngress(namespace, appName string) (bool, error) {
+	kc, err := k.buildClient()
+	if err != nil {
+		return false, err
+	}
+	_, err = kc.ExtensionsV1beta1().
+		Ingresses(namespace).
+		Get(appName, metav1.GetOptions{})
+
+	if err != nil {
+		if k.IsNotFound(err) {
+			return false, nil
+		}
+		return false, errors.Wrap(err, "get ingress failed")
+	}
+	return true, nil
+}
+
+func (k *Client) createIngress(namespace, appName, vHost string) error {
+	kc, err := k.buildClient()
+	if err != nil {
+		return err
+	}
+	igsSpec := ingressSpec(namespace, appName, vHost)
+	_, err = kc.ExtensionsV1beta1().Ingresses(namespace).Create(igsSpec)
+	return errors.Wrap(err, "create ingress failed")
+}
+
+// ExposeDeploy creates a service and/or a ingress if needed
+func (k *Client) ExposeDeploy(namespace, appName, vHost, svcType string, w io.Writer) error {
+	return k.ExposeDeployWithOptions(namespace, appName, vHost, svcType, nil, w)
+}
+
+// ExposeDeployWithOptions is ExposeDeploy creating the service with opts,
+// headless services are not exposed by an ingress
+func (k *Client) ExposeDeployWithOptions(namespace, appName, vHost, svcType string, opts *service.ServiceOptions, w io.Writer) error {
+	hasSrv, err := k.hasService(namespace, appName)
+	if err != nil {
+		return err
+	}
+	if !hasSrv {
+		fmt.Fprintln(w, "Exposing service")
+		if err := k.createService(namespace, appName, svcType, opts); err != nil {
+			return err
+		}
+	} else if opts != nil && opts.TargetPort > 0 {
+		if err := k.setServiceTargetPort(namespace, appName, opts.TargetPort); err != nil {
+			return err
+		}
+	}
+
+	if !k.ingress || (opts != nil && opts.Headless) {
+		return nil
+	}
+	hasIgs, err := k.HasIngress(namespace, appName)
+	if err != nil {
+		return err
+	}
+	if !hasIgs {
+		fmt.Fprintln(w, "Creating ingress")
+		if err := k.createIngress(namespace, appName, vHost); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (k *Client) DeletePod(namespace, podName string) error {
+	kc, err := k.buildClient()
+	if err != nil {
+		return err
+	}
+	err = kc.Pods(namespace).Delete(podName, &metav1.DeleteOptions{})
+	return errors.Wrap(err, "could not delete pod")
+}
+
+// EvictPodsOnNode evicts the namespace pods running on the node, the
+// eviction API refuses the ones that would violate a PodDisruptionBudget.
+// The other pods are still evicted when one is refused
+func (k *Client) EvictPodsOnNode(namespace, nodeName string) error {
+	kc, err := k.buildClient()
+	if err != nil {
+		return err
+	}
+	fieldSelector := fmt.Sprintf("spec.nodeName=%s", nodeName)
+	podList, err := kc.CoreV1().Pods(namespace).List(metav1.ListOptions{FieldSelector: fieldSelector})
+	if err != nil {
+		return errors.Wrap(err, "list pods failed")
+	}
+	var errs []error
+	for _, pod := range podList.Items {
+		if pod.Spec.NodeName != nodeName {
+			continue
+		}
+		eviction := &policy.Eviction{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      pod.Name,
+				Namespace: pod.Namespace,
+			},
+		}
+		if err := kc.CoreV1().Pods(namespace).Evict(eviction); err != nil && !k.IsNotFound(err) {
+			errs = append(errs, errors.Wrapf(err, "evict pod %s failed", pod.Name))
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+func (k *Client) waitPodStart(pod *k8sv1.Pod, checkInterval, timeout time.Duration) error {
+	kc, err := k.buildClient()
+	if err != nil {
+		return err
+	}
+	podsClient := kc.Pods(pod.Namespace)
+	return wait.PollImmediate(checkInterval, timeout, func() (bool, error) {
+		p, err := podsClient.Get(pod.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		if p.Status.Phase == k8sv1.PodFailed {
+			return true, podStartFailure(p)
+		}
+		if reason, msg := podStartBlockedReason(p); reason != "" {
+			return true, errors.Wrapf(ErrPodRunFailed, "%s: %s", reason, msg)
+		}
+		result := p.Status.Phase == k8sv1.PodRunning || p.Status.Phase == k8sv1.PodSucceeded
+		return result, nil
+	})
+}
+
+// podStartBlockedReasons are the waiting reasons of containers that won't
+// start without user intervention
+var podStartBlockedReasons = map[string]bool{
+	"ImagePullBackOff":           true,
+	"InvalidImageName":           true,
+	"CreateContainerError":       true,
+	"CreateContainerConfigError": true,
+}
+
+func podStartBlockedReason(p *k8sv1.Pod) (string, string) {
+	statuses := append(p.Status.InitContainerStatuses, p.Status.ContainerStatuses...)
+	for _, cs := range statuses {
+		waiting := cs.State.Waiting
+		if waiting != nil && podStartBlockedReasons[waiting.Reason] {
+			return waiting.Reason, waiting.Message
+		}
+	}
+	return "", ""
+}
+
+func podStartFailure(p *k8sv1.Pod) error {
+	statuses := append(p.Status.InitContainerStatuses, p.Status.ContainerStatuses...)
+	for _, cs := range statuses {
+		if t := cs.State.Terminated; t != nil && t.ExitCode != 0 {
+			return errors.Wrapf(ErrPodRunFailed, "container %s %s (exit code %d)", cs.Name, t.Reason, t.ExitCode)
+		}
+	}
+	if p.Status.Reason != "" {
+		return errors.Wrapf(ErrPodRunFailed, "%s: %s", p.Status.Reason, p.Status.Message)
+	}
+	return ErrPodRunFailed
+}
+
+func (k *Client) waitPodEnd(pod *k8sv1.Pod, checkInterval, timeout time.Duration) error {
+	kc, err := k.buildClient()
+	if err != nil {
+		return err
+	}
+	podsClient := kc.Pods(pod.Namespace)
+	return wait.PollImmediate(checkInterval, timeout, func() (bool, error) {
+		p, err := podsClient.Get(pod.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		// OnFailure pods stay running while their containers are restarted
+		result := p.Status.Phase == k8sv1.PodSucceeded || p.Status.Phase == k8sv1.PodFailed
+		return result, nil
+	})
+}
+
+// podExitCode returns the exit code of the given container, the sidecars
+// may exit successfully while the main one fails. An empty container name
+// picks the first one terminated
+func (k *Client) podExitCode(pod *k8sv1.Pod, container string) (int, error) {
+	kc, err := k.buildClient()
+	if err != nil {
+		return 1, err
+	}
+
+	p, err := kc.Pods(pod.Namespace).Get(pod.Name, metav1.GetOptions{})
+	if err != nil {
+		return 1, err
+	}
+	for _, containerStatus := range p.Status.ContainerStatuses {
+		if container != "" && containerStatus.Name != container {
+			continue
+		}
+		state := containerStatus.State.Terminated
+		if state == nil {
+			continue
+		}
+		return int(state.ExitCode), nil
+	}
+	return 1, ErrPodStillRunning
+}
+
+func (k *Client) currentPodReplicasFromDeploy(namespace, appName string) int32 {
+	kc, err := k.buildClient()
+	if err != nil {
+		return 1
+	}
+
+	d, err := k.getDeploy(kc, namespace, appName)
+	if err != nil || d.Status.Replicas < 1 {
+		return 1
+	}
+	return d.Status.Replicas
+}
+
+// conflictBackoff is the same used by client-go retry package
+var conflictBackoff = wait.Backoff{
+	Steps:    5,
+	Duration: 10 * time.Millisecond,
+	Factor:   1.0,
+	Jitter:   0.1,
+}
+
+func (k *Client) retryOnConflict(fn func() error) error {
+	var lastErr error
+	err := wait.ExponentialBackoff(conflictBackoff, func() (bool, error) {
+		lastErr = fn()
+		if lastErr == nil {
+			return true, nil
+		}
+		if k.IsConflict(lastErr) {
+			return false, nil
+		}
+		return false, lastErr
+	})
+	if err == wait.ErrWaitTimeout {
+		err = lastErr
+	}
+	return err
+}
+
+// updateNamespace gets the namespace, applies mutate and updates it,
+// starting over if the namespace changed in between
+func (k *Client) updateNamespace(namespace string, mutate func(ns *k8sv1.Namespace)) error {
+	kc, err := k.buildClient()
+	if err != nil {
+		return err
+	}
+
+	return k.retryOnConflict(func() error {
+		ns, err := k.getNamespace(namespace)
+		if err != nil {
+			return err
+		}
+		mutate(ns)
+		_, err = kc.CoreV1().Namespaces().Update(ns)
+		return err
+	})
+}
+
+func (k *Client) SetNamespaceAnnotations(namespace string, annotations map[string]string) error {
+	return k.updateNamespace(namespace, func(ns *k8sv1.Namespace) {
+		if ns.Annotations == nil {
+			ns.Annotations = make(map[string]string)
+		}
+		for key, value := range annotations {
+			ns.Annotations[key] = value
+		}
+	})
+}
+
+func (k *Client) SetNamespaceLabels(namespace string, labels map[string]string) error {
+	return k.updateNamespace(namespace, func(ns *k8sv1.Namespace) {
+		if ns.Labels == nil {
+			ns.Labels = make(map[string]string)
+		}
+		for key, value := range labels {
+			ns.Labels[key] = value
+		}
+	})
+}
+
+func prepareEnvVarsPath(name, cause, template string, v interface{}) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to json encode env vars")
+	}
+	if cause == "" {
+		cause = defaultEnvVarsChangeCause
+	}
+	c, err := json.Marshal(cause)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to json encode change cause")
+	}
+	data := fmt.Sprintf(template, string(c), time.Now().UTC().Format(time.RFC3339Nano), name, string(b))
+	return []byte(data), nil
+}
+
+func (c *Client) patchDeployEnvVars(namespace, name, cause string, v interface{}) error {
+	data, err := prepareEnvVarsPath(name, cause, patchDeployEnvVarsTmpl, v)
+	if err != nil {
+		return err
+	}
+
+	if c.dryRun != nil {
+		return c.writeDryRun(data)
+	}
+
+	kc, err := c.buildClient()
+	if err != nil {
+		return err
+	}
+
+	_, err = kc.ExtensionsV1beta1().Deployments(namespace).Patch(
+		name,
+		types.StrategicMergePatchType,
+		data,
+	)
+
+	return errors.Wrap(err, "patch deploy failed")
+}
+
+func (c *Client) patchCronJobEnvVars(namespace, name string, v interface{}) error {
+	data, err := prepareEnvVarsPath(name, "", patchCronJobEnvVarsTmpl, v)
+	if err != nil {
+		return err
+	}
+
+	if c.dryRun != nil {
+		return c.writeDryRun(data)
+	}
+
+	kc, err := c.buildClient()
+	if err != nil {
+		return err
+	}
+
+	_, err = kc.CronJobs(namespace).Patch(
+		name,
+		types.StrategicMergePatchType,
+		data,
+	)
+
+	return errors.Wrap(err, "patch cronjob failed")
+}
+
+func convertAppSecretEnvVar(secretName string, secrets []string) interface{} {
+	type secretKeyRef struct {
+		Key  string `json:"key"`
+		Name string `json:"name"`
+	}
+	type valueFrom struct {
+		SecretKeyRef secretKeyRef `json:"secretKeyRef"`
+	}
+	type envVar struct {
+		Name      string    `json:"name"`
+		ValueFrom valueFrom `json:"valueFrom"`
+	}
+
+	env := make([]*envVar, len(secrets))
+	for i := range secrets {
+		env[i] = &envVar{
+			Name: secrets[i],
+			ValueFrom: valueFrom{
+				SecretKeyRef: secretKeyRef{
+					Key:  secrets[i],
+					Name: secretName,
+				},
+			},
+		}
+	}
+
+	return env
+}
+
+func convertAppEnvVar(evs []*app.EnvVar) interface{} {
+	type EnvVar struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+	env := make([]*EnvVar, len(evs))
+	for i := range evs {
+		env[i] = &EnvVar{Name: evs[i].Key, Value: evs[i].Value}
+	}
+
+	return env
+}
+
+func convertAppDeleteEnvVar(evNames []string) interface{} {
+	type EnvVar struct {
+		Name  string `json:"name"`
+		Patch string `json:"$patch"`
+	}
+	env := make([]*EnvVar, len(evNames))
+	for i := range evNames {
+		env[i] = &EnvVar{Name: evNames[i], Patch: "delete"}
+	}
+
+	return env
+}
+
+// CreateOrUpdateDeployEnvVars patches the deploy env vars, the description
+// is recorded as the change cause of the new revision (empty means the
+// default one)
+func (c *Client) CreateOrUpdateDeployEnvVars(namespace, name string, evs []*app.EnvVar, description string) error {
+	return c.patchDeployEnvVars(namespace, name, description, convertAppEnvVar(evs))
+}
+
+// AddDeployEnvVars only adds the env vars not set on the deploy yet. The
+// strategic merge patch uses the env name as key, so the current entries,
+// and the ones added concurrently, are kept untouched
+func (c *Client) AddDeployEnvVars(namespace, name string, evs []*app.EnvVar) error {
+	current, _, err := c.DeployEnvVars(namespace, name)
+	if err != nil {
+		return err
+	}
+	set := make(map[string]bool)
+	for _, ev := range current {
+		set[ev.Key] = true
+	}
+
+	newEvs := make([]*app.EnvVar, 0)
+	for _, ev := range evs {
+		if !set[ev.Key] {
+			newEvs = append(newEvs, ev)
+		}
+	}
+	if len(newEvs) == 0 {
+		return nil
+	}
+	return c.patchDeployEnvVars(namespace, name, "add env vars", convertAppEnvVar(newEvs))
+}
+
+// UpdateDeployEnvVar patches a single env var, the other entries are kept
+// untouched as the strategic merge patch uses the env name as key
+func (c *Client) UpdateDeployEnvVar(namespace, name, key, value string) error {
+	ev := []*app.EnvVar{{Key: key, Value: value}}
+	return c.patchDeployEnvVars(namespace, name, "update env var "+key, convertAppEnvVar(ev))
+}
+
+func (c *Client) CreateOrUpdateCronJobEnvVars(namespace, name string, evs []*app.EnvVar) error {
+	return c.patchCronJobEnvVars(namespace, name, convertAppEnvVar(evs))
+}
+
+func (c *Client) CreateOrUpdateDeploySecretEnvVars(namespace, name, secretName string, secrets []string) error {
+	return c.patchDeployEnvVars(namespace, name, "", convertAppSecretEnvVar(secretName, secrets))
+}
+
+func (c *Client) CreateOrUpdateCronJobSecretEnvVars(namespace, name, secretName string, secrets []string) error {
+	return c.patchCronJobEnvVars(namespace, name, convertAppSecretEnvVar(secretName, secrets))
+}
+
+func (k *Client) DeleteDeployEnvVars(namespace, name string, evNames []string) error {
+	return k.patchDeployEnvVars(namespace, name, "", convertAppDeleteEnvVar(evNames))
+}
+
+func (k *Client) DeleteCronJobEnvVars(namespace, name string, evNames []string) error {
+	return k.patchCronJobEnvVars(namespace, name, convertAppDeleteEnvVar(evNames))
+}
+
+func envFromSourceName(source k8sv1.EnvFromSource) string {
+	if source.ConfigMapRef != nil {
+		return "configmap/" + source.ConfigMapRef.Name
+	}
+	if source.SecretRef != nil {
+		return "secret/" + source.SecretRef.Name
+	}
+	return ""
+}
 
-	as := &app.Autoscale{
-		CPUTargetUtilization: cpu,
-		Min:                  min,
-		Max:                  hpa.Spec.MaxReplicas,
+func prepareDeployEnvFromPatch(name string, envFrom []k8sv1.EnvFromSource) ([]byte, error) {
+	b, err := json.Marshal(envFrom)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to json encode env from")
 	}
-	return as, nil
+	data := fmt.Sprintf(patchDeployEnvFromTmpl, name, string(b))
+	return []byte(data), nil
 }
 
-func (k *Client) Limits(namespace, name string) (*app.Limits, error) {
+// addDeployEnvFrom appends source to the deploy container envFrom. The
+// envFrom list is replaced on patch, so the current sources are kept
+func (k *Client) addDeployEnvFrom(namespace, name string, source k8sv1.EnvFromSource) error {
 	kc, err := k.buildClient()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	lr, err := kc.CoreV1().LimitRanges(namespace).Get(name, metav1.GetOptions{})
+	d, err := k.getDeploy(kc, namespace, name)
 	if err != nil {
-		return nil, errors.Wrap(err, "get limits failed")
+		return errors.Wrap(err, "get deploy failed")
 	}
 
-	var def, defReq []*app.LimitRangeQuantity
-	for _, item := range lr.Spec.Limits {
-		for k, v := range item.Default {
-			q := &app.LimitRangeQuantity{
-				Resource: string(k),
-				Quantity: v.String(),
-			}
-			def = append(def, q)
+	envFrom := []k8sv1.EnvFromSource{}
+	for _, c := range d.Spec.Template.Spec.Containers {
+		if c.Name == name {
+			envFrom = c.EnvFrom
+			break
 		}
-		for k, v := range item.DefaultRequest {
-			q := &app.LimitRangeQuantity{
-				Resource: string(k),
-				Quantity: v.String(),
-			}
-			defReq = append(defReq, q)
+	}
+	for _, ef := range envFrom {
+		if envFromSourceName(ef) == envFromSourceName(source) {
+			return nil
 		}
 	}
 
-	lim := &app.Limits{
-		Default:        def,
-		DefaultRequest: defReq,
+	data, err := prepareDeployEnvFromPatch(name, append(envFrom, source))
+	if err != nil {
+		return err
 	}
-	return lim, nil
+	if k.dryRun != nil {
+		return k.writeDryRun(data)
+	}
+	_, err = kc.ExtensionsV1beta1().Deployments(namespace).Patch(
+		name,
+		types.StrategicMergePatchType,
+		data,
+	)
+
+	return errors.Wrap(err, "patch deploy failed")
 }
 
-func (k *Client) CreateOrUpdateConfigMap(namespace, name string, data map[string]string) error {
+// CreateOrUpdateDeployConfigMapEnvFrom exposes all the config map keys as
+// env vars of the deploy
+func (k *Client) CreateOrUpdateDeployConfigMapEnvFrom(namespace, name, configMapName string) error {
+	return k.addDeployEnvFrom(namespace, name, k8sv1.EnvFromSource{
+		ConfigMapRef: &k8sv1.ConfigMapEnvSource{
+			LocalObjectReference: k8sv1.LocalObjectReference{Name: configMapName},
+		},
+	})
+}
+
+// CreateOrUpdateDeploySecretEnvFrom exposes all the secret keys as env vars
+// of the deploy
+func (k *Client) CreateOrUpdateDeploySecretEnvFrom(namespace, name, secretName string) error {
+	return k.addDeployEnvFrom(namespace, name, k8sv1.EnvFromSource{
+		SecretRef: &k8sv1.SecretEnvSource{
+			LocalObjectReference: k8sv1.LocalObjectReference{Name: secretName},
+		},
+	})
+}
+
+func (k *Client) DeleteNamespace(namespace string) error {
 	kc, err := k.buildClient()
 	if err != nil {
 		return err
 	}
-
-	cm := configMapSpec(namespace, name, data)
-	_, err = kc.CoreV1().ConfigMaps(namespace).Update(cm)
-	if k.IsNotFound(err) {
-		_, err = kc.CoreV1().ConfigMaps(namespace).Create(cm)
-	}
-	return err
+	err = kc.CoreV1().Namespaces().Delete(namespace, &metav1.DeleteOptions{})
+	return errors.Wrap(err, "delete ns failed")
 }
 
-func (k *Client) CreateOrUpdateDeploy(deploySpec *spec.Deploy) error {
+func (k *Client) DeleteDeploy(namespace, name string) error {
 	kc, err := k.buildClient()
 	if err != nil {
 		return err
 	}
+	policy := metav1.DeletePropagationForeground
+	err = k.deleteDeploy(kc, namespace, name, &metav1.DeleteOptions{PropagationPolicy: &policy})
+	return errors.Wrap(err, "delete deploy failed")
+}
 
-	replicas := k.currentPodReplicasFromDeploy(deploySpec.Namespace, deploySpec.Name)
-	deployYaml, err := deploySpecToK8sDeploy(deploySpec, replicas)
+func (c *Client) DeleteCronJob(namespace, name string) error {
+	kc, err := c.buildClient()
 	if err != nil {
 		return err
 	}
-
-	_, err = kc.AppsV1beta1().Deployments(deploySpec.Namespace).Update(deployYaml)
-	if k.IsNotFound(err) {
-		_, err = kc.AppsV1beta1().Deployments(deploySpec.Namespace).Create(deployYaml)
+	policy := metav1.DeletePropagationBackground
+	err = kc.CronJobs(namespace).Delete(
+		name,
+		&metav1.DeleteOptions{PropagationPolicy: &policy},
+	)
+	if err != nil && !c.IsNotFound(err) {
+		return errors.Wrap(err, "delete cronjob failed")
 	}
-	return err
+	return nil
 }
 
-func (c *Client) CreateOrUpdateCronJob(cronJobSpec *spec.CronJob) error {
+func (c *Client) CronJobStatus(namespace, name string) (*spec.CronJobStatus, error) {
 	kc, err := c.buildClient()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	cronJobYaml, err := cronJobSpecToK8sCronJob(cronJobSpec)
+	cj, err := kc.CronJobs(namespace).Get(name, metav1.GetOptions{})
 	if err != nil {
-		return err
+		return nil, errors.Wrap(err, "get cronjob failed")
 	}
 
-	_, err = kc.CronJobs(cronJobSpec.Namespace).Update(cronJobYaml)
-	if c.IsNotFound(err) {
-		_, err = kc.CronJobs(cronJobSpec.Namespace).Create(cronJobYaml)
+	status := &spec.CronJobStatus{
+		Schedule: cj.Spec.Schedule,
+		Active:   len(cj.Status.Active),
 	}
-	return err
+	if cj.Status.LastScheduleTime != nil {
+		t := cj.Status.LastScheduleTime.Time
+		status.LastScheduleTime = &t
+	}
+	return status, nil
 }
 
-func (k *Client) PodRun(podSpec *spec.Pod) (io.ReadCloser, <-chan int, error) {
-	kc, err := k.buildClient()
+// CronJobRuns returns the jobs created by the cron job, newest first
+func (c *Client) CronJobRuns(namespace, name string) ([]*spec.JobRun, error) {
+	kc, err := c.buildClient()
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	podYaml, err := podSpecToK8sPod(podSpec)
-	if err != nil {
-		return nil, nil, errors.Wrap(err, "define build pod spec failed")
-	}
-	pod, err := kc.Pods(podSpec.Namespace).Create(podYaml)
+	jobs, err := kc.BatchV1().Jobs(namespace).List(metav1.ListOptions{})
 	if err != nil {
-		return nil, nil, errors.Wrap(err, "pod create failed")
+		return nil, errors.Wrap(err, "list jobs failed")
 	}
 
-	exitCodeChan := make(chan int)
-	r, w := io.Pipe()
-	go func() {
-		defer func() {
-			w.Close()
-			close(exitCodeChan)
-		}()
-
-		if err := k.waitPodStart(pod, 1*time.Second, 5*time.Minute); err != nil {
-			return
-		}
-
-		opts := &app.LogOptions{Lines: 10, Follow: true}
-		stream, err := k.PodLogs(podSpec.Namespace, podSpec.Name, opts)
-		if err != nil {
-			return
-		}
-		io.Copy(w, stream)
-
-		if err = k.waitPodEnd(pod, 3*time.Second, k.podRunTimeout); err != nil {
-			return
+	runs := make([]*spec.JobRun, 0)
+	for i := range jobs.Items {
+		job := &jobs.Items[i]
+		if !isControlledBy(job.OwnerReferences, "CronJob", name) {
+			continue
 		}
-
-		exitCode, err := k.podExitCode(pod)
-		if err != nil {
-			return
+		runs = append(runs, k8sJobToJobRun(job))
+	}
+	sort.SliceStable(runs, func(i, j int) bool {
+		if runs[i].StartTime == nil || runs[j].StartTime == nil {
+			return runs[j].StartTime != nil
 		}
-		exitCodeChan <- exitCode
-		go k.DeletePod(pod.Namespace, pod.Name)
-	}()
-	return r, exitCodeChan, nil
+		return runs[i].StartTime.After(*runs[j].StartTime)
+	})
+	return runs, nil
 }
 
-func (k *Client) hasService(namespace, appName string) (bool, error) {
-	kc, err := k.buildClient()
+// CronJobLatestLogs streams the logs of the pod of the most recent cron job
+// run
+func (c *Client) CronJobLatestLogs(namespace, name string, opts *app.LogOptions) (io.ReadCloser, error) {
+	runs, err := c.CronJobRuns(namespace, name)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
-	_, err = kc.CoreV1().Services(namespace).Get(appName, metav1.GetOptions{})
+	if len(runs) == 0 {
+		return nil, ErrCronJobNeverRan
+	}
+
+	kc, err := c.buildClient()
 	if err != nil {
-		if k.IsNotFound(err) {
-			return false, nil
+		return nil, err
+	}
+
+	pods, err := kc.CoreV1().Pods(namespace).List(metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("job-name=%s", runs[0].Name),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "list job pods failed")
+	}
+	if len(pods.Items) == 0 {
+		return nil, ErrNotFound
+	}
+
+	// a failed run may have several pods, one per retry
+	latest := pods.Items[0]
+	for _, pod := range pods.Items[1:] {
+		if latest.CreationTimestamp.Before(pod.CreationTimestamp) {
+			latest = pod
 		}
-		return false, errors.Wrap(err, "get service failed")
 	}
-	return true, nil
+	return c.PodLogs(namespace, latest.Name, opts)
 }
 
-func (k *Client) createService(namespace, appName, svcType string) error {
+func (k *Client) NamespaceListByLabel(label, value string) ([]string, error) {
 	kc, err := k.buildClient()
 	if err != nil {
-		return err
+		return nil, err
 	}
-	srvSpec := serviceSpec(namespace, appName, svcType)
-	_, err = kc.CoreV1().Services(namespace).Create(srvSpec)
-	return errors.Wrap(err, "create service failed")
+	labelSelector := fmt.Sprintf("%s=%s", label, value)
+	if value == "" {
+		labelSelector = fmt.Sprintf("%s", label)
+	}
+	nl, err := kc.CoreV1().Namespaces().List(metav1.ListOptions{LabelSelector: labelSelector})
+	if err != nil {
+		return nil, err
+	}
+	namespaces := make([]string, 0)
+	for _, item := range nl.Items {
+		namespaces = append(namespaces, item.ObjectMeta.Name)
+	}
+	return namespaces, nil
 }
 
-func (k *Client) HasIngress(namespace, appName string) (bool, error) {
+// AppList returns the apps stored on teresa namespaces, with their team and
+// last user, reading all namespaces in a single call
+func (k *Client) AppList() ([]*app.AppMeta, error) {
 	kc, err := k.buildClient()
 	if err != nil {
-		return false, err
+		return nil, err
 	}
-	_, err = kc.ExtensionsV1beta1().
-		Ingresses(namespace).
-		Get(appName, metav1.GetOptions{})
-
+	nl, err := kc.CoreV1().Namespaces().List(metav1.ListOptions{LabelSelector: app.TeresaTeamLabel})
 	if err != nil {
-		if k.IsNotFound(err) {
-			return false, nil
+		return nil, errors.Wrap(err, "list namespaces failed")
+	}
+	apps := make([]*app.AppMeta, 0)
+	for i := range nl.Items {
+		item := &nl.Items[i]
+		team, ok := item.Labels[app.TeresaTeamLabel]
+		if !ok {
+			continue
 		}
-		return false, errors.Wrap(err, "get ingress failed")
+		a, err := appFromNs(item)
+		if err != nil {
+			// a broken app must not hide the others
+			if err != ErrAppAnnotationNotFound {
+				log.WithError(err).Errorf("Listing app %s", item.Name)
+			}
+			continue
+		}
+		apps = append(apps, &app.AppMeta{
+			App:      a,
+			Team:     team,
+			LastUser: item.Annotations[app.TeresaLastUser],
+		})
 	}
-	return true, nil
+	return apps, nil
 }
 
-func (k *Client) createIngress(namespace, appName, vHost string) error {
-	kc, err := k.buildClient()
+func replicaSetListByLabel(kc *kubernetes.Clientset, namespace, label, value string) (*k8s_extensions.ReplicaSetList, error) {
+	labelSelector := fmt.Sprintf("%s=%s", label, value)
+	opts := metav1.ListOptions{LabelSelector: labelSelector}
+	rs, err := kc.ExtensionsV1beta1().ReplicaSets(namespace).List(opts)
 	if err != nil {
-		return err
+		return nil, errors.Wrap(err, "failed to get replicasets")
 	}
-	igsSpec := ingressSpec(namespace, appName, vHost)
-	_, err = kc.ExtensionsV1beta1().Ingresses(namespace).Create(igsSpec)
-	return errors.Wrap(err, "create ingress failed")
+	return rs, nil
 }
 
-// ExposeDeploy creates a service and/or a ingress if needed
-func (k *Client) ExposeDeploy(namespace, appName, vHost, svcType string, w io.Writer) error {
-	hasSrv, err := k.hasService(namespace, appName)
+func (k *Client) ReplicaSetListByLabel(namespace, label, value string) ([]*deploy.ReplicaSetListItem, error) {
+	cli, err := k.buildClient()
 	if err != nil {
-		return err
-	}
-	if !hasSrv {
-		fmt.Fprintln(w, "Exposing service")
-		if err := k.createService(namespace, appName, svcType); err != nil {
-			return err
-		}
+		return nil, errors.Wrap(err, "failed to build client")
 	}
 
-	if !k.ingress {
-		return nil
-	}
-	hasIgs, err := k.HasIngress(namespace, appName)
+	rs, err := replicaSetListByLabel(cli, namespace, label, value)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if !hasIgs {
-		fmt.Fprintln(w, "Creating ingress")
-		if err := k.createIngress(namespace, appName, vHost); err != nil {
-			return err
+
+	resp := make([]*deploy.ReplicaSetListItem, len(rs.Items))
+	for i, item := range rs.Items {
+		resp[i] = &deploy.ReplicaSetListItem{
+			Revision:    item.Annotations[revisionAnnotation],
+			Age:         int64(time.Since(item.CreationTimestamp.Time)),
+			Current:     item.Status.ReadyReplicas > 0,
+			Description: item.Annotations[changeCauseAnnotation],
+		}
+		if containers := item.Spec.Template.Spec.Containers; len(containers) > 0 {
+			resp[i].Image = containers[0].Image
 		}
 	}
 
-	return nil
+	return resp, nil
 }
 
-func (k *Client) DeletePod(namespace, podName string) error {
-	kc, err := k.buildClient()
-	if err != nil {
-		return err
+func replicaSetRevision(rs *k8s_extensions.ReplicaSet) int {
+	r, _ := strconv.Atoi(rs.Annotations[revisionAnnotation])
+	return r
+}
+
+func isReplicaSetActive(rs *k8s_extensions.ReplicaSet) bool {
+	if rs.Spec.Replicas != nil && *rs.Spec.Replicas > 0 {
+		return true
 	}
-	err = kc.Pods(namespace).Delete(podName, &metav1.DeleteOptions{})
-	return errors.Wrap(err, "could not delete pod")
+	return rs.Status.Replicas > 0
 }
 
-func (k *Client) waitPodStart(pod *k8sv1.Pod, checkInterval, timeout time.Duration) error {
+// PruneReplicaSets deletes the old replicasets without replicas, keeping the
+// newest ones. The newest revision is never deleted
+func (k *Client) PruneReplicaSets(namespace, label, value string, keep int) error {
 	kc, err := k.buildClient()
 	if err != nil {
 		return err
 	}
-	podsClient := kc.Pods(pod.Namespace)
-	return wait.PollImmediate(checkInterval, timeout, func() (bool, error) {
-		p, err := podsClient.Get(pod.Name, metav1.GetOptions{})
-		if err != nil {
-			return false, err
-		}
-		if p.Status.Phase == k8sv1.PodFailed {
-			return true, ErrPodRunFailed
-		}
-		result := p.Status.Phase == k8sv1.PodRunning || p.Status.Phase == k8sv1.PodSucceeded
-		return result, nil
-	})
-}
 
-func (k *Client) waitPodEnd(pod *k8sv1.Pod, checkInterval, timeout time.Duration) error {
-	kc, err := k.buildClient()
+	rs, err := replicaSetListByLabel(kc, namespace, label, value)
 	if err != nil {
 		return err
 	}
-	podsClient := kc.Pods(pod.Namespace)
-	return wait.PollImmediate(checkInterval, timeout, func() (bool, error) {
-		p, err := podsClient.Get(pod.Name, metav1.GetOptions{})
-		if err != nil {
-			return false, err
-		}
-		result := p.Status.Phase == k8sv1.PodSucceeded || p.Status.Phase == k8sv1.PodFailed
-		return result, nil
+	items := rs.Items
+	sort.Slice(items, func(i, j int) bool {
+		return replicaSetRevision(&items[i]) > replicaSetRevision(&items[j])
 	})
+	if keep < 1 {
+		keep = 1
+	}
+	if len(items) <= keep {
+		return nil
+	}
+
+	for i := range items[keep:] {
+		item := &items[keep+i]
+		if isReplicaSetActive(item) {
+			continue
+		}
+		err := kc.ExtensionsV1beta1().ReplicaSets(namespace).Delete(item.Name, &metav1.DeleteOptions{})
+		if err != nil && !k.IsNotFound(err) {
+			return errors.Wrapf(err, "delete replicaset %s failed", item.Name)
+		}
+	}
+	return nil
 }
 
-func (k *Client) podExitCode(pod *k8sv1.Pod) (int, error) {
+// CurrentDeployDescription returns the change cause of the replicaset of the
+// current deploy revision
+func (k *Client) CurrentDeployDescription(namespace, name string) (string, error) {
 	kc, err := k.buildClient()
 	if err != nil {
-		return 1, err
+		return "", err
 	}
 
-	p, err := kc.Pods(pod.Namespace).Get(pod.Name, metav1.GetOptions{})
+	d, err := k.getDeploy(kc, namespace, name)
 	if err != nil {
-		return 1, err
+		return "", errors.Wrap(err, "get deploy failed")
 	}
-	for _, containerStatus := range p.Status.ContainerStatuses {
-		state := containerStatus.State.Terminated
-		if state == nil {
-			continue
+	revision := d.Annotations[revisionAnnotation]
+
+	rs, err := replicaSetListByLabel(kc, namespace, "run", name)
+	if err != nil {
+		return "", err
+	}
+	for _, item := range rs.Items {
+		if item.Annotations[revisionAnnotation] == revision {
+			return item.Annotations[changeCauseAnnotation], nil
 		}
-		return int(state.ExitCode), nil
 	}
-	return 1, ErrPodStillRunning
+	return "", ErrNotFound
 }
 
-func (k *Client) currentPodReplicasFromDeploy(namespace, appName string) int32 {
+// DeployEnvVars returns the literal env vars of the deploy app container and
+// the names of the ones backed by secrets
+func (k *Client) DeployEnvVars(namespace, name string) ([]*app.EnvVar, []string, error) {
 	kc, err := k.buildClient()
 	if err != nil {
-		return 1
+		return nil, nil, err
 	}
 
-	d, err := kc.AppsV1beta1().Deployments(
-		namespace).Get(appName, metav1.GetOptions{})
-	if err != nil || d.Status.Replicas < 1 {
-		return 1
+	d, err := k.getDeploy(kc, namespace, name)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "get deploy failed")
 	}
-	return d.Status.Replicas
+	c := appContainer(d.Spec.Template.Spec.Containers, name)
+	if c == nil {
+		return nil, nil, ErrNotFound
+	}
+	evs, secrets := k8sEnvToEnvVars(c.Env)
+	return evs, secrets, nil
 }
 
-func (k *Client) SetNamespaceAnnotations(namespace string, annotations map[string]string) error {
-	kc, err := k.buildClient()
-	if err != nil {
-		return err
+func (k *Client) DeployRollbackToRevision(namespace, name, revision string) error {
+	data := fmt.Sprintf(patchDeployRollbackToRevisionTmpl, revision)
+
+	if k.dryRun != nil {
+		return k.writeDryRun([]byte(data))
 	}
 
-	ns, err := k.getNamespace(namespace)
+	kc, err := k.buildClient()
 	if err != nil {
 		return err
 	}
 
-	for key, value := range annotations {
-		ns.Annotations[key] = value
-	}
-	_, err = kc.CoreV1().Namespaces().Update(ns)
-	return err
+	_, err = kc.ExtensionsV1beta1().Deployments(namespace).Patch(
+		name,
+		types.StrategicMergePatchType,
+		[]byte(data),
+	)
+
+	return errors.Wrap(err, "patch deploy failed")
 }
 
-func (k *Client) SetNamespaceLabels(namespace string, labels map[string]string) error {
+// DeployRollbackToPrevious rolls back to the highest revision before the
+// current one still kept by a replicaset
+func (k *Client) DeployRollbackToPrevious(namespace, name string) error {
 	kc, err := k.buildClient()
 	if err != nil {
 		return err
 	}
 
-	ns, err := k.getNamespace(namespace)
+	d, err := k.getDeploy(kc, namespace, name)
 	if err != nil {
-		return err
+		return errors.Wrap(err, "get deploy failed")
 	}
+	current, _ := strconv.Atoi(d.Annotations[revisionAnnotation])
 
-	for key, value := range labels {
-		ns.Labels[key] = value
+	rs, err := replicaSetListByLabel(kc, namespace, "run", name)
+	if err != nil {
+		return err
 	}
-	_, err = kc.CoreV1().Namespaces().Update(ns)
-	return err
+	previous := 0
+	for i := range rs.Items {
+		if r := replicaSetRevision(&rs.Items[i]); r < current && r > previous {
+			previous = r
+		}
+	}
+	if previous == 0 {
+		return ErrNoPreviousRevision
+	}
+	return k.DeployRollbackToRevision(namespace, name, strconv.Itoa(previous))
 }
 
-func prepareEnvVarsPath(name, template string, v interface{}) ([]byte, error) {
-	b, err := json.Marshal(v)
+func prepareDeployImagePatch(name, image string) ([]byte, error) {
+	cause, err := json.Marshal(fmt.Sprintf("set image %s", image))
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to json encode env vars")
+		return nil, errors.Wrap(err, "failed to json encode change cause")
 	}
-	data := fmt.Sprintf(template, time.Now(), name, string(b))
+	img, err := json.Marshal(image)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to json encode image")
+	}
+	data := fmt.Sprintf(patchDeployImageTmpl, string(cause), name, string(img))
 	return []byte(data), nil
 }
 
-func (c *Client) patchDeployEnvVars(namespace, name string, v interface{}) error {
-	data, err := prepareEnvVarsPath(name, patchDeployEnvVarsTmpl, v)
+func (k *Client) SetDeployImage(namespace, name, image string) error {
+	data, err := prepareDeployImagePatch(name, image)
 	if err != nil {
 		return err
 	}
 
-	kc, err := c.buildClient()
+	if k.dryRun != nil {
+		return k.writeDryRun(data)
+	}
+
+	kc, err := k.buildClient()
 	if err != nil {
 		return err
 	}
@@ -779,168 +2989,156 @@ func (c *Client) patchDeployEnvVars(namespace, name string, v interface{}) error
 	return errors.Wrap(err, "patch deploy failed")
 }
 
-func (c *Client) patchCronJobEnvVars(namespace, name string, v interface{}) error {
-	data, err := prepareEnvVarsPath(name, patchCronJobEnvVarsTmpl, v)
-	if err != nil {
-		return err
+// RestartDeploy triggers a new rollout of the deploy without changing it,
+// the same way as `kubectl rollout restart`
+func (k *Client) RestartDeploy(namespace, name string) error {
+	data := []byte(fmt.Sprintf(patchDeployRestartTmpl, time.Now().UTC().Format(time.RFC3339)))
+
+	if k.dryRun != nil {
+		return k.writeDryRun(data)
 	}
 
-	kc, err := c.buildClient()
+	kc, err := k.buildClient()
 	if err != nil {
 		return err
 	}
 
-	_, err = kc.CronJobs(namespace).Patch(
+	_, err = kc.ExtensionsV1beta1().Deployments(namespace).Patch(
 		name,
 		types.StrategicMergePatchType,
 		data,
 	)
 
-	return errors.Wrap(err, "patch cronjob failed")
+	return errors.Wrap(err, "patch deploy failed")
 }
 
-func convertAppSecretEnvVar(secretName string, secrets []string) interface{} {
-	type secretKeyRef struct {
-		Key  string `json:"key"`
-		Name string `json:"name"`
-	}
-	type valueFrom struct {
-		SecretKeyRef secretKeyRef `json:"secretKeyRef"`
-	}
-	type envVar struct {
-		Name      string    `json:"name"`
-		ValueFrom valueFrom `json:"valueFrom"`
-	}
-
-	env := make([]*envVar, len(secrets))
-	for i := range secrets {
-		env[i] = &envVar{
-			Name: secrets[i],
-			ValueFrom: valueFrom{
-				SecretKeyRef: secretKeyRef{
-					Key:  secrets[i],
-					Name: secretName,
-				},
-			},
-		}
+// SetDeployPodAnnotations sets the annotations on the deploy pod template,
+// so they land on its pods. It triggers a new rollout
+func (k *Client) SetDeployPodAnnotations(namespace, name string, annotations map[string]string) error {
+	data, err := prepareAnnotations(patchDeployPodAnnotationsTmpl, annotations)
+	if err != nil {
+		return err
 	}
 
-	return env
-}
-
-func convertAppEnvVar(evs []*app.EnvVar) interface{} {
-	type EnvVar struct {
-		Name  string `json:"name"`
-		Value string `json:"value"`
-	}
-	env := make([]*EnvVar, len(evs))
-	for i := range evs {
-		env[i] = &EnvVar{Name: evs[i].Key, Value: evs[i].Value}
+	if k.dryRun != nil {
+		return k.writeDryRun(data)
 	}
 
-	return env
-}
-
-func convertAppDeleteEnvVar(evNames []string) interface{} {
-	type EnvVar struct {
-		Name  string `json:"name"`
-		Patch string `json:"$patch"`
-	}
-	env := make([]*EnvVar, len(evNames))
-	for i := range evNames {
-		env[i] = &EnvVar{Name: evNames[i], Patch: "delete"}
+	kc, err := k.buildClient()
+	if err != nil {
+		return err
 	}
 
-	return env
-}
-
-func (c *Client) CreateOrUpdateDeployEnvVars(namespace, name string, evs []*app.EnvVar) error {
-	return c.patchDeployEnvVars(namespace, name, convertAppEnvVar(evs))
-}
-
-func (c *Client) CreateOrUpdateCronJobEnvVars(namespace, name string, evs []*app.EnvVar) error {
-	return c.patchCronJobEnvVars(namespace, name, convertAppEnvVar(evs))
-}
-
-func (c *Client) CreateOrUpdateDeploySecretEnvVars(namespace, name, secretName string, secrets []string) error {
-	return c.patchDeployEnvVars(namespace, name, convertAppSecretEnvVar(secretName, secrets))
-}
+	_, err = kc.ExtensionsV1beta1().Deployments(namespace).Patch(
+		name,
+		types.StrategicMergePatchType,
+		data,
+	)
 
-func (c *Client) CreateOrUpdateCronJobSecretEnvVars(namespace, name, secretName string, secrets []string) error {
-	return c.patchCronJobEnvVars(namespace, name, convertAppSecretEnvVar(secretName, secrets))
+	return errors.Wrap(err, "patch deploy failed")
 }
 
-func (k *Client) DeleteDeployEnvVars(namespace, name string, evNames []string) error {
-	return k.patchDeployEnvVars(namespace, name, convertAppDeleteEnvVar(evNames))
+// EnablePrometheusScraping annotates the deploy pods to be scraped by
+// prometheus on the port and path, an empty path means /metrics
+func (k *Client) EnablePrometheusScraping(namespace, name string, port int, path string) error {
+	if path == "" {
+		path = defaultPrometheusPath
+	}
+	return k.SetDeployPodAnnotations(namespace, name, map[string]string{
+		prometheusScrapeAnnotation: "true",
+		prometheusPortAnnotation:   strconv.Itoa(port),
+		prometheusPathAnnotation:   path,
+	})
 }
 
-func (k *Client) DeleteCronJobEnvVars(namespace, name string, evNames []string) error {
-	return k.patchCronJobEnvVars(namespace, name, convertAppDeleteEnvVar(evNames))
+// WaitForDeployRollout waits the deploy pods to be updated and available,
+// on timeout the error tells how many of them are. It fails fast once the
+// deploy exceeds its progress deadline
+func (k *Client) WaitForDeployRollout(namespace, name string, timeout time.Duration) error {
+	return k.waitForDeployRollout(namespace, name, 3*time.Second, timeout)
 }
 
-func (k *Client) DeleteNamespace(namespace string) error {
+func (k *Client) waitForDeployRollout(namespace, name string, checkInterval, timeout time.Duration) error {
 	kc, err := k.buildClient()
 	if err != nil {
 		return err
 	}
-	err = kc.CoreV1().Namespaces().Delete(namespace, &metav1.DeleteOptions{})
-	return errors.Wrap(err, "delete ns failed")
+	var desired, updated, available int32
+	err = wait.PollImmediate(checkInterval, timeout, func() (bool, error) {
+		d, err := k.getDeploy(kc, namespace, name)
+		if err != nil {
+			return false, errors.Wrap(err, "get deploy failed")
+		}
+		desired = 1
+		if d.Spec.Replicas != nil {
+			desired = *d.Spec.Replicas
+		}
+		updated, available = d.Status.UpdatedReplicas, d.Status.AvailableReplicas
+		if d.Status.ObservedGeneration < d.Generation {
+			return false, nil
+		}
+		for _, c := range d.Status.Conditions {
+			if c.Type == v1beta1.DeploymentProgressing && c.Reason == progressDeadlineExceededReason {
+				return false, status.Errorf(codes.Aborted, "Deploy rollout exceeded its progress deadline: %s", c.Message)
+			}
+		}
+		return updated == desired && available == desired && d.Status.Replicas == desired, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return status.Errorf(codes.DeadlineExceeded, "Deploy rollout did not complete in time: %d of %d pods updated, %d available", updated, desired, available)
+	}
+	return err
 }
 
-func (k *Client) NamespaceListByLabel(label, value string) ([]string, error) {
+// DeployReplicas returns the desired and the available replicas of the
+// deploy, they differ while it's scaling or rolling out
+func (k *Client) DeployReplicas(namespace, name string) (int32, int32, error) {
 	kc, err := k.buildClient()
 	if err != nil {
-		return nil, err
-	}
-	labelSelector := fmt.Sprintf("%s=%s", label, value)
-	if value == "" {
-		labelSelector = fmt.Sprintf("%s", label)
+		return 0, 0, err
 	}
-	nl, err := kc.CoreV1().Namespaces().List(metav1.ListOptions{LabelSelector: labelSelector})
+
+	d, err := k.getDeploy(kc, namespace, name)
 	if err != nil {
-		return nil, err
+		return 0, 0, errors.Wrap(err, "get deploy failed")
 	}
-	namespaces := make([]string, 0)
-	for _, item := range nl.Items {
-		namespaces = append(namespaces, item.ObjectMeta.Name)
+
+	var desired int32 = 1
+	if d.Spec.Replicas != nil {
+		desired = *d.Spec.Replicas
 	}
-	return namespaces, nil
+	return desired, d.Status.AvailableReplicas, nil
 }
 
-func (k *Client) ReplicaSetListByLabel(namespace, label, value string) ([]*deploy.ReplicaSetListItem, error) {
-	cli, err := k.buildClient()
+// DeployImage returns the image of the first container of the deploy
+func (k *Client) DeployImage(namespace, name string) (string, error) {
+	kc, err := k.buildClient()
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to build client")
+		return "", err
 	}
 
-	labelSelector := fmt.Sprintf("%s=%s", label, value)
-	opts := metav1.ListOptions{LabelSelector: labelSelector}
-	rs, err := cli.ExtensionsV1beta1().ReplicaSets(namespace).List(opts)
+	d, err := k.getDeploy(kc, namespace, name)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to get replicasets")
+		return "", errors.Wrap(err, "get deploy failed")
 	}
-
-	resp := make([]*deploy.ReplicaSetListItem, len(rs.Items))
-	for i, item := range rs.Items {
-		resp[i] = &deploy.ReplicaSetListItem{
-			Revision:    item.Annotations[revisionAnnotation],
-			Age:         int64(time.Since(item.CreationTimestamp.Time)),
-			Current:     item.Status.ReadyReplicas > 0,
-			Description: item.Annotations[changeCauseAnnotation],
-		}
+	if len(d.Spec.Template.Spec.Containers) == 0 {
+		return "", ErrNotFound
 	}
-
-	return resp, nil
+	return d.Spec.Template.Spec.Containers[0].Image, nil
 }
 
-func (k *Client) DeployRollbackToRevision(namespace, name, revision string) error {
+func (k *Client) DeploySetReplicas(namespace, name string, replicas int32) error {
+	data := fmt.Sprintf(patchDeployReplicasTmpl, replicas)
+
+	if k.dryRun != nil {
+		return k.writeDryRun([]byte(data))
+	}
+
 	kc, err := k.buildClient()
 	if err != nil {
 		return err
 	}
 
-	data := fmt.Sprintf(patchDeployRollbackToRevisionTmpl, revision)
-
 	_, err = kc.ExtensionsV1beta1().Deployments(namespace).Patch(
 		name,
 		types.StrategicMergePatchType,
@@ -950,14 +3148,18 @@ func (k *Client) DeployRollbackToRevision(namespace, name, revision string) erro
 	return errors.Wrap(err, "patch deploy failed")
 }
 
-func (k *Client) DeploySetReplicas(namespace, name string, replicas int32) error {
+func (k *Client) setDeployPaused(namespace, name string, paused bool) error {
+	data := fmt.Sprintf(patchDeployPausedTmpl, paused)
+
+	if k.dryRun != nil {
+		return k.writeDryRun([]byte(data))
+	}
+
 	kc, err := k.buildClient()
 	if err != nil {
 		return err
 	}
 
-	data := fmt.Sprintf(patchDeployReplicasTmpl, replicas)
-
 	_, err = kc.ExtensionsV1beta1().Deployments(namespace).Patch(
 		name,
 		types.StrategicMergePatchType,
@@ -967,20 +3169,42 @@ func (k *Client) DeploySetReplicas(namespace, name string, replicas int32) error
 	return errors.Wrap(err, "patch deploy failed")
 }
 
+func (k *Client) PauseDeploy(namespace, name string) error {
+	return k.setDeployPaused(namespace, name, true)
+}
+
+func (k *Client) ResumeDeploy(namespace, name string) error {
+	return k.setDeployPaused(namespace, name, false)
+}
+
 func (c *Client) CloudProviderName() (string, error) {
 	kc, err := c.buildClient()
 	if err != nil {
 		return "", err
 	}
-	ls := "kubernetes.io/role=master"
-	nodes, err := kc.CoreV1().Nodes().List(metav1.ListOptions{LabelSelector: ls})
-	if err != nil {
-		return "", errors.Wrap(err, "node list failed")
-	}
-	if len(nodes.Items) == 0 {
-		return "", errors.New("empty cluster")
+	// managed clusters hide the masters, any node works there
+	for _, ls := range cloudProviderNodeSelectors {
+		nodes, err := kc.CoreV1().Nodes().List(metav1.ListOptions{LabelSelector: ls})
+		if err != nil {
+			return "", errors.Wrap(err, "node list failed")
+		}
+		for _, node := range nodes.Items {
+			if node.Spec.ProviderID != "" {
+				return providerName(node.Spec.ProviderID)
+			}
+		}
 	}
-	id := nodes.Items[0].Spec.ProviderID
+	return "", errors.New("empty cluster")
+}
+
+var cloudProviderNodeSelectors = []string{
+	"kubernetes.io/role=master",
+	"node-role.kubernetes.io/master",
+	"",
+}
+
+// providerName extracts the provider of ids like aws:///us-east-1a/i-123
+func providerName(id string) (string, error) {
 	idx := strings.Index(id, "://")
 	if idx <= 0 {
 		return "", errors.New("invalid provider id")
@@ -988,11 +3212,54 @@ func (c *Client) CloudProviderName() (string, error) {
 	return id[:idx], nil
 }
 
+// ClusterInfo returns the cloud provider, the node count and the distinct
+// instance types of the cluster nodes
+func (c *Client) ClusterInfo() (*app.ClusterInfo, error) {
+	kc, err := c.buildClient()
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := kc.CoreV1().Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "node list failed")
+	}
+	if len(nodes.Items) == 0 {
+		return nil, errors.New("empty cluster")
+	}
+
+	info := &app.ClusterInfo{Nodes: len(nodes.Items)}
+	seen := make(map[string]bool)
+	for _, node := range nodes.Items {
+		if info.Provider == "" && node.Spec.ProviderID != "" {
+			if info.Provider, err = providerName(node.Spec.ProviderID); err != nil {
+				return nil, err
+			}
+		}
+		it := node.Labels[instanceTypeLabel]
+		if it != "" && !seen[it] {
+			seen[it] = true
+			info.InstanceTypes = append(info.InstanceTypes, it)
+		}
+	}
+	sort.Strings(info.InstanceTypes)
+	return info, nil
+}
+
 func (c *Client) SetServiceAnnotations(namespace, svcName string, annotations map[string]string) error {
 	return c.patchServiceAnnotations(namespace, svcName, annotations)
 }
 
 func (c *Client) UpdateServicePorts(namespace, svcName string, ports []service.ServicePort) error {
+	names := make([]string, len(ports))
+	for i := range ports {
+		names[i] = ports[i].Name
+	}
+	if err := validateServicePortNames(names); err != nil {
+		return err
+	}
+	if err := validateServicePortProtocols(ports); err != nil {
+		return err
+	}
 	kc, err := c.buildClient()
 	if err != nil {
 		return err
@@ -1007,8 +3274,22 @@ func (c *Client) UpdateServicePorts(namespace, svcName string, ports []service.S
 	return errors.Wrap(err, "update service failed")
 }
 
+// ValidateServicePorts checks that every target port is exposed by a
+// container of the deploy, it's meant to be called before UpdateServicePorts
+func (c *Client) ValidateServicePorts(namespace, deployName string, ports []service.ServicePort) error {
+	kc, err := c.buildClient()
+	if err != nil {
+		return err
+	}
+	d, err := c.getDeploy(kc, namespace, deployName)
+	if err != nil {
+		return errors.Wrap(err, "get deploy failed")
+	}
+	return validateTargetPorts(ports, d.Spec.Template.Spec.Containers)
+}
+
 func (c *Client) patchServiceAnnotations(namespace, svcName string, annotations map[string]string) error {
-	data, err := prepareServiceAnnotations(patchServiceAnnotationsTmpl, annotations)
+	data, err := prepareAnnotations(patchAnnotationsTmpl, annotations)
 	if err != nil {
 		return err
 	}
@@ -1045,18 +3326,30 @@ func (c *Client) ServicePorts(namespace, svcName string) ([]*service.ServicePort
 	if err != nil {
 		return nil, err
 	}
-	ports := make([]*service.ServicePort, len(svc.Spec.Ports))
-	for i := range svc.Spec.Ports {
-		ports[i] = &service.ServicePort{
-			Port:       int(svc.Spec.Ports[i].Port),
-			Name:       svc.Spec.Ports[i].Name,
-			TargetPort: int(svc.Spec.Ports[i].TargetPort.IntVal),
-		}
+	return k8sServicePortsToServicePorts(svc.Spec.Ports), nil
+}
+
+// AllServicePorts returns the ports of every service of the namespace, keyed
+// by the service name
+func (c *Client) AllServicePorts(namespace string) (map[string][]*service.ServicePort, error) {
+	kc, err := c.buildClient()
+	if err != nil {
+		return nil, err
+	}
+	svcs, err := kc.CoreV1().Services(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "list services failed")
+	}
+	ports := make(map[string][]*service.ServicePort)
+	for _, svc := range svcs.Items {
+		ports[svc.Name] = k8sServicePortsToServicePorts(svc.Spec.Ports)
 	}
 	return ports, nil
 }
 
-func prepareServiceAnnotations(tmpl string, annotations map[string]string) ([]byte, error) {
+// prepareAnnotations fills the annotations of the patch template, for the
+// object metadata or the deploy pod template
+func prepareAnnotations(tmpl string, annotations map[string]string) ([]byte, error) {
 	b, err := json.Marshal(annotations)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to json encode")
@@ -1071,8 +3364,10 @@ func newInClusterK8sClient(conf *Config) (*Client, error) {
 		return nil, err
 	}
 	return &Client{
-		conf:    k8sConf,
-		ingress: conf.Ingress,
+		conf:          k8sConf,
+		ingress:       conf.Ingress,
+		runs:          newPodRuns(),
+		groupVersions: new(groupVersionsCache),
 	}, nil
 }
 
@@ -1084,5 +3379,7 @@ func newOutOfClusterK8sClient(conf *Config) (*Client, error) {
 	return &Client{
 		conf:          k8sConf,
 		podRunTimeout: conf.PodRunTimeout,
+		runs:          newPodRuns(),
+		groupVersions: new(groupVersionsCache),
 	}, nil
 }
@@ -0,0 +1,3747 @@
+package k8s
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/wait"
+	k8sv1 "k8s.io/client-go/pkg/api/v1"
+	asv1 "k8s.io/client-go/pkg/apis/autoscaling/v1"
+	asv2alpha1 "k8s.io/client-go/pkg/apis/autoscaling/v2alpha1"
+	k8sbatch "k8s.io/client-go/pkg/apis/batch/v1"
+	k8sv2alpha "k8s.io/client-go/pkg/apis/batch/v2alpha1"
+	k8s_extensions "k8s.io/client-go/pkg/apis/extensions/v1beta1"
+	policy "k8s.io/client-go/pkg/apis/policy/v1beta1"
+	restclient "k8s.io/client-go/rest"
+
+	"github.com/luizalabs/teresa/pkg/server/app"
+	"github.com/luizalabs/teresa/pkg/server/service"
+	"github.com/luizalabs/teresa/pkg/server/spec"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type fakeRequest struct {
+	Method string
+	Path   string
+	Query  string
+	Body   []byte
+}
+
+type fakeAPIServer struct {
+	*httptest.Server
+	Requests []*fakeRequest
+}
+
+func newFakeAPIServer(handler func(w http.ResponseWriter, r *fakeRequest)) *fakeAPIServer {
+	f := &fakeAPIServer{}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		req := &fakeRequest{
+			Method: r.Method,
+			Path:   r.URL.Path,
+			Query:  r.URL.RawQuery,
+			Body:   body,
+		}
+		f.Requests = append(f.Requests, req)
+		handler(w, req)
+	}))
+	return f
+}
+
+func (f *fakeAPIServer) Client() *Client {
+	return &Client{
+		conf:          &restclient.Config{Host: f.URL},
+		runs:          newPodRuns(),
+		groupVersions: new(groupVersionsCache),
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, obj interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(obj)
+}
+
+func writeStatus(w http.ResponseWriter, code int, reason metav1.StatusReason) {
+	writeJSON(w, code, &metav1.Status{
+		TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+		Status:   metav1.StatusFailure,
+		Code:     int32(code),
+		Reason:   reason,
+	})
+}
+
+func TestDeleteDeploy(t *testing.T) {
+	srv := newFakeAPIServer(newDiscoveryHandler(func(w http.ResponseWriter, r *fakeRequest) {
+		writeStatus(w, http.StatusOK, "")
+	}, appsV1beta1GroupVersion))
+	defer srv.Close()
+
+	if err := srv.Client().DeleteDeploy("teresa", "app"); err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+
+	req := srv.Requests[len(srv.Requests)-1]
+	if req.Method != http.MethodDelete {
+		t.Errorf("got %s; want %s", req.Method, http.MethodDelete)
+	}
+	wantPath := "/apis/apps/v1beta1/namespaces/teresa/deployments/app"
+	if req.Path != wantPath {
+		t.Errorf("got %s; want %s", req.Path, wantPath)
+	}
+
+	opts := new(metav1.DeleteOptions)
+	if err := json.Unmarshal(req.Body, opts); err != nil {
+		t.Fatal("error decoding delete options:", err)
+	}
+	if opts.PropagationPolicy == nil {
+		t.Fatal("expected propagation policy; got nil")
+	}
+	if *opts.PropagationPolicy != metav1.DeletePropagationForeground {
+		t.Errorf("got %s; want %s", *opts.PropagationPolicy, metav1.DeletePropagationForeground)
+	}
+}
+
+func TestDeleteCronJob(t *testing.T) {
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		writeStatus(w, http.StatusOK, "")
+	})
+	defer srv.Close()
+
+	if err := srv.Client().DeleteCronJob("teresa", "cron"); err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+
+	req := srv.Requests[0]
+	if req.Method != http.MethodDelete {
+		t.Errorf("got %s; want %s", req.Method, http.MethodDelete)
+	}
+	wantPath := "/apis/batch/v2alpha1/namespaces/teresa/cronjobs/cron"
+	if req.Path != wantPath {
+		t.Errorf("got %s; want %s", req.Path, wantPath)
+	}
+
+	opts := new(metav1.DeleteOptions)
+	if err := json.Unmarshal(req.Body, opts); err != nil {
+		t.Fatal("error decoding delete options:", err)
+	}
+	if opts.PropagationPolicy == nil || *opts.PropagationPolicy != metav1.DeletePropagationBackground {
+		t.Errorf("got %v; want %s", opts.PropagationPolicy, metav1.DeletePropagationBackground)
+	}
+}
+
+func TestDeleteCronJobNotFound(t *testing.T) {
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		writeStatus(w, http.StatusNotFound, metav1.StatusReasonNotFound)
+	})
+	defer srv.Close()
+
+	if err := srv.Client().DeleteCronJob("teresa", "cron"); err != nil {
+		t.Error("got unexpected error:", err)
+	}
+}
+
+func TestCronJobStatus(t *testing.T) {
+	lastSchedule := time.Date(2017, 10, 1, 12, 0, 0, 0, time.UTC)
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		writeJSON(w, http.StatusOK, &k8sv2alpha.CronJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "cron", Namespace: "teresa"},
+			Spec:       k8sv2alpha.CronJobSpec{Schedule: "*/5 * * * *"},
+			Status: k8sv2alpha.CronJobStatus{
+				Active:           []k8sv1.ObjectReference{{Name: "cron-1506859200"}},
+				LastScheduleTime: &metav1.Time{Time: lastSchedule},
+			},
+		})
+	})
+	defer srv.Close()
+
+	status, err := srv.Client().CronJobStatus("teresa", "cron")
+	if err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+	if wantPath := "/apis/batch/v2alpha1/namespaces/teresa/cronjobs/cron"; srv.Requests[0].Path != wantPath {
+		t.Errorf("got %s; want %s", srv.Requests[0].Path, wantPath)
+	}
+	if status.Schedule != "*/5 * * * *" {
+		t.Errorf("got %s; want */5 * * * *", status.Schedule)
+	}
+	if status.Active != 1 {
+		t.Errorf("got %d; want 1", status.Active)
+	}
+	if status.LastScheduleTime == nil || !status.LastScheduleTime.Equal(lastSchedule) {
+		t.Errorf("got %v; want %s", status.LastScheduleTime, lastSchedule)
+	}
+}
+
+func TestCronJobStatusNeverRan(t *testing.T) {
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		writeJSON(w, http.StatusOK, &k8sv2alpha.CronJob{
+			Spec: k8sv2alpha.CronJobSpec{Schedule: "@daily"},
+		})
+	})
+	defer srv.Close()
+
+	status, err := srv.Client().CronJobStatus("teresa", "cron")
+	if err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+	if status.LastScheduleTime != nil {
+		t.Errorf("got %s; want nil", status.LastScheduleTime)
+	}
+	if status.Active != 0 {
+		t.Errorf("got %d; want 0", status.Active)
+	}
+}
+
+func TestCronJobRuns(t *testing.T) {
+	controller := true
+	newJob := func(name, cron string, start time.Time, condition k8sbatch.JobConditionType) k8sbatch.Job {
+		job := k8sbatch.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: name,
+				OwnerReferences: []metav1.OwnerReference{
+					{Kind: "CronJob", Name: cron, Controller: &controller},
+				},
+			},
+		}
+		job.Status.StartTime = &metav1.Time{Time: start}
+		job.Status.Conditions = []k8sbatch.JobCondition{
+			{Type: condition, Status: k8sv1.ConditionTrue},
+		}
+		if condition == k8sbatch.JobComplete {
+			job.Status.CompletionTime = &metav1.Time{Time: start.Add(time.Minute)}
+		}
+		return job
+	}
+	first := time.Date(2017, 10, 1, 12, 0, 0, 0, time.UTC)
+	second := first.Add(time.Hour)
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		writeJSON(w, http.StatusOK, &k8sbatch.JobList{
+			Items: []k8sbatch.Job{
+				newJob("cron-1", "cron", first, k8sbatch.JobComplete),
+				newJob("other-1", "other", first, k8sbatch.JobComplete),
+				newJob("cron-2", "cron", second, k8sbatch.JobFailed),
+			},
+		})
+	})
+	defer srv.Close()
+
+	runs, err := srv.Client().CronJobRuns("teresa", "cron")
+	if err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+	if wantPath := "/apis/batch/v1/namespaces/teresa/jobs"; srv.Requests[0].Path != wantPath {
+		t.Errorf("got %s; want %s", srv.Requests[0].Path, wantPath)
+	}
+	if len(runs) != 2 {
+		t.Fatalf("got %d runs; want 2", len(runs))
+	}
+
+	if runs[0].Name != "cron-2" || runs[0].Status != spec.JobRunFailed {
+		t.Errorf("got %s %s; want cron-2 %s", runs[0].Name, runs[0].Status, spec.JobRunFailed)
+	}
+	if runs[0].CompletionTime != nil {
+		t.Errorf("got %s; want nil", runs[0].CompletionTime)
+	}
+	if runs[1].Name != "cron-1" || runs[1].Status != spec.JobRunSucceeded {
+		t.Errorf("got %s %s; want cron-1 %s", runs[1].Name, runs[1].Status, spec.JobRunSucceeded)
+	}
+	if runs[1].StartTime == nil || !runs[1].StartTime.Equal(first) {
+		t.Errorf("got %v; want %s", runs[1].StartTime, first)
+	}
+	if runs[1].CompletionTime == nil || !runs[1].CompletionTime.Equal(first.Add(time.Minute)) {
+		t.Errorf("got %v; want %s", runs[1].CompletionTime, first.Add(time.Minute))
+	}
+}
+
+func TestSetDeployImage(t *testing.T) {
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		writeJSON(w, http.StatusOK, &k8s_extensions.Deployment{})
+	})
+	defer srv.Close()
+
+	image := "luizalabs/teresa:0.0.2"
+	if err := srv.Client().SetDeployImage("teresa", "app", image); err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+
+	req := srv.Requests[0]
+	if req.Method != http.MethodPatch {
+		t.Errorf("got %s; want %s", req.Method, http.MethodPatch)
+	}
+	wantPath := "/apis/extensions/v1beta1/namespaces/teresa/deployments/app"
+	if req.Path != wantPath {
+		t.Errorf("got %s; want %s", req.Path, wantPath)
+	}
+
+	patch := new(k8s_extensions.Deployment)
+	if err := json.Unmarshal(req.Body, patch); err != nil {
+		t.Fatal("error decoding patch:", err)
+	}
+	wantCause := "set image " + image
+	if got := patch.Annotations[changeCauseAnnotation]; got != wantCause {
+		t.Errorf("got %s; want %s", got, wantCause)
+	}
+	containers := patch.Spec.Template.Spec.Containers
+	if len(containers) != 1 {
+		t.Fatalf("got %d containers; want 1", len(containers))
+	}
+	if containers[0].Name != "app" {
+		t.Errorf("got %s; want app", containers[0].Name)
+	}
+	if containers[0].Image != image {
+		t.Errorf("got %s; want %s", containers[0].Image, image)
+	}
+}
+
+func TestRestartDeploy(t *testing.T) {
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		writeJSON(w, http.StatusOK, &k8s_extensions.Deployment{})
+	})
+	defer srv.Close()
+
+	before := time.Now().UTC().Truncate(time.Second)
+	if err := srv.Client().RestartDeploy("teresa", "app"); err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+
+	req := srv.Requests[0]
+	if req.Method != http.MethodPatch {
+		t.Errorf("got %s; want %s", req.Method, http.MethodPatch)
+	}
+	wantPath := "/apis/extensions/v1beta1/namespaces/teresa/deployments/app"
+	if req.Path != wantPath {
+		t.Errorf("got %s; want %s", req.Path, wantPath)
+	}
+
+	patch := new(k8s_extensions.Deployment)
+	if err := json.Unmarshal(req.Body, patch); err != nil {
+		t.Fatal("error decoding patch:", err)
+	}
+	restartedAt := patch.Spec.Template.Annotations["kubectl.kubernetes.io/restartedAt"]
+	ts, err := time.Parse(time.RFC3339, restartedAt)
+	if err != nil {
+		t.Fatalf("got invalid timestamp %q: %v", restartedAt, err)
+	}
+	if ts.Before(before) {
+		t.Errorf("got %s; want a time after %s", ts, before)
+	}
+	if _, ok := patch.Annotations[changeCauseAnnotation]; ok {
+		t.Errorf("got %v; want the change cause kept", patch.Annotations)
+	}
+}
+
+func TestSetDeployPodAnnotations(t *testing.T) {
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		writeJSON(w, http.StatusOK, &k8s_extensions.Deployment{})
+	})
+	defer srv.Close()
+
+	annotations := map[string]string{"key1": "value1", "key2": "value2"}
+	if err := srv.Client().SetDeployPodAnnotations("teresa", "app", annotations); err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+
+	req := srv.Requests[0]
+	if req.Method != http.MethodPatch {
+		t.Errorf("got %s; want %s", req.Method, http.MethodPatch)
+	}
+	wantPath := "/apis/extensions/v1beta1/namespaces/teresa/deployments/app"
+	if req.Path != wantPath {
+		t.Errorf("got %s; want %s", req.Path, wantPath)
+	}
+
+	patch := new(k8s_extensions.Deployment)
+	if err := json.Unmarshal(req.Body, patch); err != nil {
+		t.Fatal("error decoding patch:", err)
+	}
+	for key, value := range annotations {
+		if actual := patch.Spec.Template.Annotations[key]; actual != value {
+			t.Errorf("got %s; want %s", actual, value)
+		}
+	}
+	if len(patch.Annotations) != 0 {
+		t.Errorf("got %v; want no deploy annotations", patch.Annotations)
+	}
+}
+
+func TestEnablePrometheusScraping(t *testing.T) {
+	var testCases = []struct {
+		path     string
+		expected string
+	}{
+		{"/stats", "/stats"},
+		{"", "/metrics"},
+	}
+
+	for _, tc := range testCases {
+		srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+			writeJSON(w, http.StatusOK, &k8s_extensions.Deployment{})
+		})
+
+		if err := srv.Client().EnablePrometheusScraping("teresa", "app", 9090, tc.path); err != nil {
+			t.Fatal("got unexpected error:", err)
+		}
+		patch := new(k8s_extensions.Deployment)
+		if err := json.Unmarshal(srv.Requests[0].Body, patch); err != nil {
+			t.Fatal("error decoding patch:", err)
+		}
+		expected := map[string]string{
+			"prometheus.io/scrape": "true",
+			"prometheus.io/port":   "9090",
+			"prometheus.io/path":   tc.expected,
+		}
+		for key, value := range expected {
+			if actual := patch.Spec.Template.Annotations[key]; actual != value {
+				t.Errorf("got %s; want %s", actual, value)
+			}
+		}
+		srv.Close()
+	}
+}
+
+func TestCreateOrUpdateDeployEnvVarsChangeCause(t *testing.T) {
+	var testCases = []struct {
+		description string
+		expected    string
+	}{
+		{"", defaultEnvVarsChangeCause},
+		{"enable feature \"x\"", "enable feature \"x\""},
+	}
+
+	for _, tc := range testCases {
+		srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+			writeJSON(w, http.StatusOK, &k8s_extensions.Deployment{})
+		})
+
+		evs := []*app.EnvVar{{Key: "KEY", Value: "VALUE"}}
+		err := srv.Client().CreateOrUpdateDeployEnvVars("teresa", "app", evs, tc.description)
+		srv.Close()
+		if err != nil {
+			t.Fatal("got unexpected error:", err)
+		}
+
+		patch := new(k8s_extensions.Deployment)
+		if err := json.Unmarshal(srv.Requests[0].Body, patch); err != nil {
+			t.Fatal("error decoding patch:", err)
+		}
+		if got := patch.Annotations[changeCauseAnnotation]; got != tc.expected {
+			t.Errorf("got %s; want %s", got, tc.expected)
+		}
+	}
+}
+
+func TestPrepareEnvVarsPathDate(t *testing.T) {
+	templates := []string{patchDeployEnvVarsTmpl, patchCronJobEnvVarsTmpl}
+	for _, tmpl := range templates {
+		data, err := prepareEnvVarsPath("app", "", tmpl, convertAppEnvVar(nil))
+		if err != nil {
+			t.Fatal("got unexpected error:", err)
+		}
+
+		var patch struct {
+			Spec struct {
+				Template struct {
+					Metadata struct {
+						Annotations map[string]string
+					}
+				}
+			}
+		}
+		if err := json.Unmarshal(data, &patch); err != nil {
+			t.Fatal("error decoding patch:", err)
+		}
+		date := patch.Spec.Template.Metadata.Annotations["date"]
+		if _, err := time.Parse(time.RFC3339, date); err != nil {
+			t.Errorf("got date %q; want RFC3339: %v", date, err)
+		}
+	}
+}
+
+func newReplicaSet(revision, image string, ready int32) k8s_extensions.ReplicaSet {
+	return k8s_extensions.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "app-" + revision,
+			Annotations: map[string]string{
+				revisionAnnotation:    revision,
+				changeCauseAnnotation: "deploy " + revision,
+			},
+		},
+		Spec: k8s_extensions.ReplicaSetSpec{
+			Template: k8sv1.PodTemplateSpec{
+				Spec: k8sv1.PodSpec{
+					Containers: []k8sv1.Container{{Name: "app", Image: image}},
+				},
+			},
+		},
+		Status: k8s_extensions.ReplicaSetStatus{Replicas: ready, ReadyReplicas: ready},
+	}
+}
+
+func TestReplicaSetListByLabelImages(t *testing.T) {
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		writeJSON(w, http.StatusOK, &k8s_extensions.ReplicaSetList{
+			Items: []k8s_extensions.ReplicaSet{
+				newReplicaSet("1", "luizalabs/app:v1", 0),
+				newReplicaSet("2", "luizalabs/app:v2", 1),
+			},
+		})
+	})
+	defer srv.Close()
+
+	items, err := srv.Client().ReplicaSetListByLabel("teresa", "run", "app")
+	if err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("got %d items; want 2", len(items))
+	}
+
+	want := map[string]string{"1": "luizalabs/app:v1", "2": "luizalabs/app:v2"}
+	for _, item := range items {
+		if item.Image != want[item.Revision] {
+			t.Errorf("got %s; want %s", item.Image, want[item.Revision])
+		}
+		if item.Description != "deploy "+item.Revision {
+			t.Errorf("got %s; want deploy %s", item.Description, item.Revision)
+		}
+	}
+	if items[0].Current || !items[1].Current {
+		t.Errorf("got current %v, %v; want false, true", items[0].Current, items[1].Current)
+	}
+}
+
+func TestPauseAndResumeDeploy(t *testing.T) {
+	var testCases = []struct {
+		fn     func(c *Client) error
+		paused bool
+	}{
+		{func(c *Client) error { return c.PauseDeploy("teresa", "app") }, true},
+		{func(c *Client) error { return c.ResumeDeploy("teresa", "app") }, false},
+	}
+
+	for _, tc := range testCases {
+		srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+			writeJSON(w, http.StatusOK, &k8s_extensions.Deployment{})
+		})
+		err := tc.fn(srv.Client())
+		srv.Close()
+		if err != nil {
+			t.Fatal("got unexpected error:", err)
+		}
+
+		req := srv.Requests[0]
+		if req.Method != http.MethodPatch {
+			t.Errorf("got %s; want %s", req.Method, http.MethodPatch)
+		}
+		var patch struct {
+			Spec struct {
+				Paused *bool `json:"paused"`
+			} `json:"spec"`
+		}
+		if err := json.Unmarshal(req.Body, &patch); err != nil {
+			t.Fatal("error decoding patch:", err)
+		}
+		if patch.Spec.Paused == nil {
+			t.Fatal("expected paused field on patch; got nil")
+		}
+		if *patch.Spec.Paused != tc.paused {
+			t.Errorf("got %v; want %v", *patch.Spec.Paused, tc.paused)
+		}
+	}
+}
+
+func TestPodLogsPreviousAndCurrent(t *testing.T) {
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		if strings.Contains(r.Query, "previous=true") {
+			fmt.Fprintln(w, "crashed")
+			return
+		}
+		fmt.Fprintln(w, "running")
+	})
+	defer srv.Close()
+
+	rc, err := srv.Client().PodLogsPreviousAndCurrent("teresa", "app-1234", "app")
+	if err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+	defer rc.Close()
+
+	b, err := ioutil.ReadAll(rc)
+	if err != nil {
+		t.Fatal("error reading logs:", err)
+	}
+	want := previousLogsDelimiter + "crashed\n" + currentLogsDelimiter + "running\n"
+	if string(b) != want {
+		t.Errorf("got %q; want %q", string(b), want)
+	}
+}
+
+func TestPodLogsPreviousAndCurrentWithoutPrevious(t *testing.T) {
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		if strings.Contains(r.Query, "previous=true") {
+			writeStatus(w, http.StatusBadRequest, metav1.StatusReasonBadRequest)
+			return
+		}
+		fmt.Fprintln(w, "running")
+	})
+	defer srv.Close()
+
+	rc, err := srv.Client().PodLogsPreviousAndCurrent("teresa", "app-1234", "app")
+	if err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+	defer rc.Close()
+
+	b, err := ioutil.ReadAll(rc)
+	if err != nil {
+		t.Fatal("error reading logs:", err)
+	}
+	if string(b) != "running\n" {
+		t.Errorf("got %q; want %q", string(b), "running\n")
+	}
+}
+
+func TestPodLogsPreviousAndCurrentPreviousError(t *testing.T) {
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		if strings.Contains(r.Query, "previous=true") {
+			writeStatus(w, http.StatusInternalServerError, metav1.StatusReasonInternalError)
+			return
+		}
+		fmt.Fprintln(w, "running")
+	})
+	defer srv.Close()
+
+	if _, err := srv.Client().PodLogsPreviousAndCurrent("teresa", "app-1234", "app"); err == nil {
+		t.Error("expected error; got nil")
+	}
+}
+
+func TestPodLogsSinceSeconds(t *testing.T) {
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		fmt.Fprintln(w, "log line")
+	})
+	defer srv.Close()
+
+	var since int64 = 300
+	opts := &app.LogOptions{Lines: 10, SinceSeconds: &since}
+	rc, err := srv.Client().PodLogs("teresa", "app-1234", opts)
+	if err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+	rc.Close()
+
+	req := srv.Requests[0]
+	wantPath := "/api/v1/namespaces/teresa/pods/app-1234/log"
+	if req.Path != wantPath {
+		t.Errorf("got %s; want %s", req.Path, wantPath)
+	}
+	if !strings.Contains(req.Query, "sinceSeconds=300") {
+		t.Errorf("expected sinceSeconds=300 in query %s", req.Query)
+	}
+}
+
+func TestPodLogsLimits(t *testing.T) {
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		fmt.Fprint(w, "line 1\nline 2\nline 3\n")
+	})
+	defer srv.Close()
+
+	var limit int64 = 1024
+	opts := &app.LogOptions{Lines: 10, Follow: true, LimitBytes: &limit, MaxLines: 2}
+	rc, err := srv.Client().PodLogs("teresa", "app-1234", opts)
+	if err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+	defer rc.Close()
+
+	b, err := ioutil.ReadAll(rc)
+	if err != nil {
+		t.Fatal("error reading logs:", err)
+	}
+	if expected := "line 1\nline 2\n"; string(b) != expected {
+		t.Errorf("got %q; want %q", string(b), expected)
+	}
+	if !strings.Contains(srv.Requests[0].Query, "limitBytes=1024") {
+		t.Errorf("expected limitBytes=1024 in query %s", srv.Requests[0].Query)
+	}
+}
+
+func TestPodAllContainersLogs(t *testing.T) {
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		if !strings.HasSuffix(r.Path, "/log") {
+			writeJSON(w, http.StatusOK, &k8sv1.Pod{
+				Spec: k8sv1.PodSpec{
+					Containers: []k8sv1.Container{{Name: "app"}, {Name: "shipper"}},
+				},
+			})
+			return
+		}
+		if strings.Contains(r.Query, "container=shipper") {
+			fmt.Fprint(w, "shipped 1\nshipped 2\n")
+			return
+		}
+		fmt.Fprint(w, "GET /\nGET /hc")
+	})
+	defer srv.Close()
+
+	rc, err := srv.Client().PodAllContainersLogs("teresa", "app-1234", &app.LogOptions{Lines: 10})
+	if err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+	defer rc.Close()
+
+	b, err := ioutil.ReadAll(rc)
+	if err != nil {
+		t.Fatal("error reading logs:", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	sort.Strings(lines)
+	want := []string{"[app] GET /", "[app] GET /hc", "[shipper] shipped 1", "[shipper] shipped 2"}
+	if strings.Join(lines, "|") != strings.Join(want, "|") {
+		t.Errorf("got %v; want %v", lines, want)
+	}
+}
+
+func TestNewResourceQuota(t *testing.T) {
+	a := &app.App{
+		Name: "teresa",
+		Quota: []*app.LimitRangeQuantity{
+			{Resource: "requests.cpu", Quantity: "2"},
+			{Resource: "requests.memory", Quantity: "4Gi"},
+			{Resource: "pods", Quantity: "10"},
+		},
+	}
+
+	rq, err := newResourceQuota(a)
+	if err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+	if rq.Namespace != a.Name {
+		t.Errorf("got %s; want %s", rq.Namespace, a.Name)
+	}
+	for _, q := range a.Quota {
+		got := rq.Spec.Hard[k8sv1.ResourceName(q.Resource)]
+		if got.String() != q.Quantity {
+			t.Errorf("got %s; want %s for %s", got.String(), q.Quantity, q.Resource)
+		}
+	}
+}
+
+func TestNewResourceQuotaInvalidQuantity(t *testing.T) {
+	a := &app.App{
+		Name:  "teresa",
+		Quota: []*app.LimitRangeQuantity{{Resource: "pods", Quantity: "many"}},
+	}
+
+	if _, err := newResourceQuota(a); err == nil {
+		t.Error("expected error; got nil")
+	}
+}
+
+func TestCreateOrUpdateResourceQuota(t *testing.T) {
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		if r.Method == http.MethodPut {
+			writeStatus(w, http.StatusNotFound, metav1.StatusReasonNotFound)
+			return
+		}
+		writeJSON(w, http.StatusCreated, &k8sv1.ResourceQuota{})
+	})
+	defer srv.Close()
+
+	a := &app.App{
+		Name:  "teresa",
+		Quota: []*app.LimitRangeQuantity{{Resource: "pods", Quantity: "10"}},
+	}
+	if err := srv.Client().CreateOrUpdateResourceQuota(a); err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+
+	if len(srv.Requests) != 2 {
+		t.Fatalf("got %d requests; want 2", len(srv.Requests))
+	}
+	req := srv.Requests[1]
+	if req.Method != http.MethodPost {
+		t.Errorf("got %s; want %s", req.Method, http.MethodPost)
+	}
+	rq := new(k8sv1.ResourceQuota)
+	if err := json.Unmarshal(req.Body, rq); err != nil {
+		t.Fatal("error decoding resource quota:", err)
+	}
+	pods := rq.Spec.Hard[k8sv1.ResourcePods]
+	if pods.String() != "10" {
+		t.Errorf("got %s; want 10", pods.String())
+	}
+}
+
+func TestResourceQuota(t *testing.T) {
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		writeJSON(w, http.StatusOK, &k8sv1.ResourceQuota{
+			Spec: k8sv1.ResourceQuotaSpec{
+				Hard: k8sv1.ResourceList{
+					k8sv1.ResourcePods: resource.MustParse("10"),
+				},
+			},
+		})
+	})
+	defer srv.Close()
+
+	quota, err := srv.Client().ResourceQuota("teresa")
+	if err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+
+	wantPath := "/api/v1/namespaces/teresa/resourcequotas/" + resourceQuotaName
+	if srv.Requests[0].Path != wantPath {
+		t.Errorf("got %s; want %s", srv.Requests[0].Path, wantPath)
+	}
+	if len(quota) != 1 {
+		t.Fatalf("got %d items; want 1", len(quota))
+	}
+	if quota[0].Resource != "pods" || quota[0].Quantity != "10" {
+		t.Errorf("got %s=%s; want pods=10", quota[0].Resource, quota[0].Quantity)
+	}
+}
+
+func TestQuotaStatus(t *testing.T) {
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		writeJSON(w, http.StatusOK, &k8sv1.ResourceQuota{
+			Status: k8sv1.ResourceQuotaStatus{
+				Hard: k8sv1.ResourceList{
+					k8sv1.ResourcePods:           resource.MustParse("10"),
+					k8sv1.ResourceRequestsMemory: resource.MustParse("4Gi"),
+				},
+				Used: k8sv1.ResourceList{
+					k8sv1.ResourcePods: resource.MustParse("8"),
+				},
+			},
+		})
+	})
+	defer srv.Close()
+
+	usage, err := srv.Client().QuotaStatus("teresa")
+	if err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+
+	want := []app.QuotaUsage{
+		{Resource: "pods", Used: "8", Hard: "10"},
+		{Resource: "requests.memory", Used: "0", Hard: "4Gi"},
+	}
+	if len(usage) != len(want) {
+		t.Fatalf("got %d items; want %d", len(usage), len(want))
+	}
+	for i := range want {
+		if *usage[i] != want[i] {
+			t.Errorf("got %v; want %v", *usage[i], want[i])
+		}
+	}
+}
+
+func TestQuotaStatusWithoutQuota(t *testing.T) {
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		writeStatus(w, http.StatusNotFound, metav1.StatusReasonNotFound)
+	})
+	defer srv.Close()
+
+	usage, err := srv.Client().QuotaStatus("teresa")
+	if err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+	if usage != nil {
+		t.Errorf("got %v; want nil", usage)
+	}
+}
+
+func TestNamespaceHealthCheck(t *testing.T) {
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		writeJSON(w, http.StatusOK, &k8sv1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{Name: "teresa"},
+		})
+	})
+	defer srv.Close()
+
+	if err := srv.Client().NamespaceHealthCheck("teresa"); err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+	req := srv.Requests[0]
+	if req.Method != http.MethodGet || req.Path != "/api/v1/namespaces/teresa" {
+		t.Errorf("got %s %s; want GET /api/v1/namespaces/teresa", req.Method, req.Path)
+	}
+}
+
+func TestNamespaceHealthCheckForbidden(t *testing.T) {
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		writeStatus(w, http.StatusForbidden, metav1.StatusReasonForbidden)
+	})
+	defer srv.Close()
+
+	if err := srv.Client().NamespaceHealthCheck("teresa"); err == nil {
+		t.Error("expected error; got nil")
+	}
+}
+
+func TestServerVersion(t *testing.T) {
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		writeJSON(w, http.StatusOK, map[string]string{
+			"major":      "1",
+			"minor":      "7",
+			"gitVersion": "v1.7.5",
+		})
+	})
+	defer srv.Close()
+
+	v, err := srv.Client().ServerVersion()
+	if err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+	if srv.Requests[0].Path != "/version" {
+		t.Errorf("got %s; want /version", srv.Requests[0].Path)
+	}
+	if v != "v1.7.5" {
+		t.Errorf("got %s; want v1.7.5", v)
+	}
+}
+
+func TestPodExecURL(t *testing.T) {
+	c := &Client{conf: &restclient.Config{Host: "http://k8s.teresa.io"}}
+
+	u, err := c.podExecURL("teresa", "app-1234", "app", []string{"ls", "-la"}, true, false)
+	if err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+
+	wantPath := "/api/v1/namespaces/teresa/pods/app-1234/exec"
+	if u.Path != wantPath {
+		t.Errorf("got %s; want %s", u.Path, wantPath)
+	}
+	q := u.Query()
+	if q.Get("container") != "app" {
+		t.Errorf("got %s; want app", q.Get("container"))
+	}
+	if strings.Join(q["command"], " ") != "ls -la" {
+		t.Errorf("got %v; want [ls -la]", q["command"])
+	}
+	if q.Get("stdin") != "true" || q.Get("stdout") != "true" || q.Get("stderr") != "true" {
+		t.Errorf("got stdin=%s stdout=%s stderr=%s; want all true", q.Get("stdin"), q.Get("stdout"), q.Get("stderr"))
+	}
+	if q.Get("tty") != "" {
+		t.Errorf("got tty=%s; want empty", q.Get("tty"))
+	}
+}
+
+func TestPodExecURLWithTTY(t *testing.T) {
+	c := &Client{conf: &restclient.Config{Host: "http://k8s.teresa.io"}}
+
+	u, err := c.podExecURL("teresa", "app-1234", "app", []string{"bash"}, true, true)
+	if err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+
+	q := u.Query()
+	if q.Get("tty") != "true" {
+		t.Errorf("got tty=%s; want true", q.Get("tty"))
+	}
+	if q.Get("stderr") != "false" {
+		t.Errorf("got stderr=%s; want false", q.Get("stderr"))
+	}
+}
+
+func TestPodExecUpgradeRefused(t *testing.T) {
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		writeStatus(w, http.StatusForbidden, metav1.StatusReasonForbidden)
+	})
+	defer srv.Close()
+
+	ec, err := srv.Client().PodExec("teresa", "app-1234", "app", []string{"ls"}, nil, ioutil.Discard, ioutil.Discard, false)
+	if err == nil {
+		t.Fatal("expected error; got nil")
+	}
+	if ec != 1 {
+		t.Errorf("got %d; want 1", ec)
+	}
+	req := srv.Requests[0]
+	if req.Method != http.MethodPost || req.Path != "/api/v1/namespaces/teresa/pods/app-1234/exec" {
+		t.Errorf("got %s %s; want POST on the exec subresource", req.Method, req.Path)
+	}
+}
+
+func TestPodRunTimeoutFor(t *testing.T) {
+	c := &Client{podRunTimeout: 30 * time.Minute}
+
+	var testCases = []struct {
+		timeout  time.Duration
+		expected time.Duration
+	}{
+		{0, 30 * time.Minute},
+		{2 * time.Hour, 2 * time.Hour},
+	}
+
+	for _, tc := range testCases {
+		got := c.podRunTimeoutFor(&spec.Pod{Timeout: tc.timeout})
+		if got != tc.expected {
+			t.Errorf("got %v; want %v", got, tc.expected)
+		}
+	}
+}
+
+func newPodRunHandler(phase k8sv1.PodPhase, logsCode int) func(w http.ResponseWriter, r *fakeRequest) {
+	pod := &k8sv1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "run", Namespace: "teresa"},
+		Status:     k8sv1.PodStatus{Phase: phase},
+	}
+	return func(w http.ResponseWriter, r *fakeRequest) {
+		switch {
+		case r.Method == http.MethodDelete:
+			writeStatus(w, http.StatusOK, "")
+		case strings.HasSuffix(r.Path, "/log"):
+			writeStatus(w, logsCode, "")
+		default:
+			writeJSON(w, http.StatusOK, pod)
+		}
+	}
+}
+
+func testPodRunCleanUp(t *testing.T, srv *fakeAPIServer) {
+	ps := &spec.Pod{Name: "run", Namespace: "teresa"}
+	c := srv.Client()
+	r, exitCodeChan, err := c.PodRun(ps)
+	if err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+	ioutil.ReadAll(r)
+
+	if ec := <-exitCodeChan; ec == 0 {
+		t.Error("got exit code 0; want non zero")
+	}
+	if _, ok := <-exitCodeChan; ok {
+		t.Error("expected exit code channel to be closed")
+	}
+	// the pod is deleted in background, wait for it
+	c.Close()
+
+	last := srv.Requests[len(srv.Requests)-1]
+	if last.Method != http.MethodDelete {
+		t.Errorf("got %s; want %s", last.Method, http.MethodDelete)
+	}
+	if expected := "/api/v1/namespaces/teresa/pods/run"; last.Path != expected {
+		t.Errorf("got %s; want %s", last.Path, expected)
+	}
+}
+
+func TestPodRunDoesNotBlockOnExitCode(t *testing.T) {
+	srv := newFakeAPIServer(newPodRunHandler(k8sv1.PodFailed, http.StatusOK))
+	defer srv.Close()
+
+	c := srv.Client()
+	r, _, err := c.PodRun(&spec.Pod{Name: "run", Namespace: "teresa"})
+	if err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+	ioutil.ReadAll(r)
+
+	done := make(chan struct{})
+	go func() {
+		c.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("run still blocked sending the exit code")
+	}
+}
+
+func TestPodRunDeletesPodThatFailedToStart(t *testing.T) {
+	srv := newFakeAPIServer(newPodRunHandler(k8sv1.PodFailed, http.StatusOK))
+	defer srv.Close()
+
+	testPodRunCleanUp(t, srv)
+}
+
+func TestPodRunDeletesPodOnStreamError(t *testing.T) {
+	srv := newFakeAPIServer(newPodRunHandler(k8sv1.PodRunning, http.StatusInternalServerError))
+	defer srv.Close()
+
+	testPodRunCleanUp(t, srv)
+}
+
+func TestPodRunInteractiveDeletesPodOnAttachError(t *testing.T) {
+	srv := newFakeAPIServer(newPodRunHandler(k8sv1.PodRunning, http.StatusOK))
+	defer srv.Close()
+
+	ps := &spec.Pod{Name: "run", Namespace: "teresa", Containers: []*spec.Container{{Name: "app"}}}
+	stderr := new(bytes.Buffer)
+	ec, err := srv.Client().PodRunInteractive(ps, strings.NewReader("exit\n"), ioutil.Discard, stderr)
+	if err == nil {
+		t.Fatal("expected error; got nil")
+	}
+	if ec != 1 {
+		t.Errorf("got %d; want 1", ec)
+	}
+	if stderr.Len() == 0 {
+		t.Error("expected the attach error on stderr")
+	}
+
+	var attach *fakeRequest
+	for _, req := range srv.Requests {
+		if strings.HasSuffix(req.Path, "/attach") {
+			attach = req
+		}
+	}
+	if attach == nil {
+		t.Fatal("expected an attach request")
+	}
+	q, _ := url.ParseQuery(attach.Query)
+	if q.Get("tty") != "true" || q.Get("stdin") != "true" {
+		t.Errorf("got %v; want stdin and tty", q)
+	}
+	last := srv.Requests[len(srv.Requests)-1]
+	if last.Method != http.MethodDelete || last.Path != "/api/v1/namespaces/teresa/pods/run" {
+		t.Errorf("got %s %s; want the pod deleted", last.Method, last.Path)
+	}
+}
+
+func TestSetPodInteractive(t *testing.T) {
+	pod := &k8sv1.Pod{Spec: k8sv1.PodSpec{Containers: []k8sv1.Container{{Name: "app"}, {Name: "nginx"}}}}
+	setPodInteractive(pod)
+
+	c := pod.Spec.Containers[0]
+	if !c.Stdin || !c.StdinOnce || !c.TTY {
+		t.Errorf("got stdin=%v stdinOnce=%v tty=%v; want all true", c.Stdin, c.StdinOnce, c.TTY)
+	}
+	if sidecar := pod.Spec.Containers[1]; sidecar.Stdin || sidecar.TTY {
+		t.Errorf("got stdin=%v tty=%v on the sidecar; want false", sidecar.Stdin, sidecar.TTY)
+	}
+	setPodInteractive(&k8sv1.Pod{})
+}
+
+func TestCloseDeletesRunningPods(t *testing.T) {
+	var deleted int32
+	pod := &k8sv1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "run", Namespace: "teresa"},
+		Status:     k8sv1.PodStatus{Phase: k8sv1.PodPending},
+	}
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		switch {
+		case r.Method == http.MethodDelete:
+			atomic.StoreInt32(&deleted, 1)
+			writeStatus(w, http.StatusOK, "")
+		case atomic.LoadInt32(&deleted) == 1:
+			writeStatus(w, http.StatusNotFound, metav1.StatusReasonNotFound)
+		default:
+			writeJSON(w, http.StatusOK, pod)
+		}
+	})
+	defer srv.Close()
+
+	c := srv.Client()
+	r, exitCodeChan, err := c.PodRun(&spec.Pod{Name: "run", Namespace: "teresa"})
+	if err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+	go ioutil.ReadAll(r)
+	if err := c.Close(); err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+	if atomic.LoadInt32(&deleted) != 1 {
+		t.Error("expected the running pod to be deleted")
+	}
+	if ec := <-exitCodeChan; ec == 0 {
+		t.Error("got exit code 0; want non zero")
+	}
+
+	if _, _, err := c.PodRun(&spec.Pod{Name: "run", Namespace: "teresa"}); err != ErrClientClosed {
+		t.Errorf("got %v; want %v", err, ErrClientClosed)
+	}
+}
+
+func TestCloseUnblocksRunsWithoutReader(t *testing.T) {
+	var deleted int32
+	pod := &k8sv1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "run", Namespace: "teresa"},
+		Status:     k8sv1.PodStatus{Phase: k8sv1.PodRunning},
+	}
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		switch {
+		case r.Method == http.MethodDelete:
+			atomic.StoreInt32(&deleted, 1)
+			writeStatus(w, http.StatusOK, "")
+		case atomic.LoadInt32(&deleted) == 1:
+			writeStatus(w, http.StatusNotFound, metav1.StatusReasonNotFound)
+		case strings.HasSuffix(r.Path, "/log"):
+			fmt.Fprintln(w, "nobody reads this line")
+		default:
+			writeJSON(w, http.StatusOK, pod)
+		}
+	})
+	defer srv.Close()
+
+	c := srv.Client()
+	r, _, err := c.PodRun(&spec.Pod{Name: "run", Namespace: "teresa"})
+	if err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+	// let the run block writing the logs
+	time.Sleep(100 * time.Millisecond)
+
+	if err := c.close(5 * time.Second); err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+	if _, err := ioutil.ReadAll(r); err != ErrClientClosed {
+		t.Errorf("got %v; want %v", err, ErrClientClosed)
+	}
+}
+
+func newTeresaNamespace(name, team, user string) k8sv1.Namespace {
+	return k8sv1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{app.TeresaTeamLabel: team},
+			Annotations: map[string]string{
+				app.TeresaAnnotation: fmt.Sprintf(`{"name": "%s"}`, name),
+				app.TeresaLastUser:   user,
+			},
+		},
+	}
+}
+
+func TestAppListSkipsBrokenApp(t *testing.T) {
+	broken := newTeresaNamespace("app1", "team1", "gopher@luizalabs.com")
+	broken.Annotations[app.TeresaAnnotation] = "{"
+	nl := &k8sv1.NamespaceList{
+		Items: []k8sv1.Namespace{
+			broken,
+			newTeresaNamespace("app2", "team2", "teresa@luizalabs.com"),
+		},
+	}
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		writeJSON(w, http.StatusOK, nl)
+	})
+	defer srv.Close()
+
+	apps, err := srv.Client().AppList()
+	if err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+	if len(apps) != 1 {
+		t.Fatalf("got %d apps; want 1", len(apps))
+	}
+	if apps[0].App.Name != "app2" {
+		t.Errorf("got %s; want app2", apps[0].App.Name)
+	}
+}
+
+func TestAppList(t *testing.T) {
+	nl := &k8sv1.NamespaceList{
+		Items: []k8sv1.Namespace{
+			newTeresaNamespace("app1", "team1", "gopher@luizalabs.com"),
+			{ObjectMeta: metav1.ObjectMeta{Name: "kube-system"}},
+			newTeresaNamespace("app2", "team2", "teresa@luizalabs.com"),
+		},
+	}
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		writeJSON(w, http.StatusOK, nl)
+	})
+	defer srv.Close()
+
+	apps, err := srv.Client().AppList()
+	if err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+	if len(srv.Requests) != 1 {
+		t.Errorf("got %d requests; want 1", len(srv.Requests))
+	}
+	if len(apps) != 2 {
+		t.Fatalf("got %d apps; want 2", len(apps))
+	}
+
+	var expected = []struct {
+		name, team, user string
+	}{
+		{"app1", "team1", "gopher@luizalabs.com"},
+		{"app2", "team2", "teresa@luizalabs.com"},
+	}
+	for i, e := range expected {
+		a := apps[i]
+		if a.App.Name != e.name {
+			t.Errorf("got %s; want %s", a.App.Name, e.name)
+		}
+		if a.Team != e.team {
+			t.Errorf("got %s; want %s", a.Team, e.team)
+		}
+		if a.LastUser != e.user {
+			t.Errorf("got %s; want %s", a.LastUser, e.user)
+		}
+	}
+}
+
+func TestAppFromNamespace(t *testing.T) {
+	ns := newTeresaNamespace("teresa", "team", "gopher@luizalabs.com")
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		writeJSON(w, http.StatusOK, &ns)
+	})
+	defer srv.Close()
+
+	a, err := srv.Client().AppFromNamespace("teresa")
+	if err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+	if a.Name != "teresa" {
+		t.Errorf("got %s; want teresa", a.Name)
+	}
+}
+
+func TestAppFromNamespaceWithoutAnnotation(t *testing.T) {
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		writeJSON(w, http.StatusOK, &k8sv1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "teresa"}})
+	})
+	defer srv.Close()
+
+	if _, err := srv.Client().AppFromNamespace("teresa"); err != ErrAppAnnotationNotFound {
+		t.Errorf("got %v; want %v", err, ErrAppAnnotationNotFound)
+	}
+}
+
+func TestAppFromNamespaceWithCorruptAnnotation(t *testing.T) {
+	ns := newTeresaNamespace("teresa", "team", "gopher@luizalabs.com")
+	ns.Annotations[app.TeresaAnnotation] = "{corrupt"
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		writeJSON(w, http.StatusOK, &ns)
+	})
+	defer srv.Close()
+
+	_, err := srv.Client().AppFromNamespace("teresa")
+	if err == nil {
+		t.Fatal("expected error; got nil")
+	}
+	if !strings.Contains(err.Error(), "unmarshal app teresa failed") {
+		t.Errorf("got %v; want unmarshal error", err)
+	}
+}
+
+func TestUpdateAppAnnotation(t *testing.T) {
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		writeJSON(w, http.StatusOK, &k8sv1.Namespace{})
+	})
+	defer srv.Close()
+
+	a := &app.App{Name: "teresa", Team: "luizalabs", ProcessType: "web"}
+	if err := srv.Client().UpdateAppAnnotation(a); err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+
+	if len(srv.Requests) != 1 {
+		t.Fatalf("got %d requests; want 1", len(srv.Requests))
+	}
+	req := srv.Requests[0]
+	if req.Method != http.MethodPatch {
+		t.Errorf("got %s; want %s", req.Method, http.MethodPatch)
+	}
+	if expected := "/api/v1/namespaces/teresa"; req.Path != expected {
+		t.Errorf("got %s; want %s", req.Path, expected)
+	}
+
+	var patch map[string]map[string]map[string]string
+	if err := json.Unmarshal(req.Body, &patch); err != nil {
+		t.Fatal("error decoding patch:", err)
+	}
+	if len(patch) != 1 || len(patch["metadata"]) != 1 {
+		t.Errorf("got %s; want only the annotations patched", req.Body)
+	}
+	annotations := patch["metadata"]["annotations"]
+	if len(annotations) != 1 {
+		t.Errorf("got %v; want only the app annotation", annotations)
+	}
+	got := new(app.App)
+	if err := json.Unmarshal([]byte(annotations[app.TeresaAnnotation]), got); err != nil {
+		t.Fatal("error decoding app annotation:", err)
+	}
+	if got.Name != a.Name || got.ProcessType != a.ProcessType {
+		t.Errorf("got %+v; want %+v", got, a)
+	}
+}
+
+func TestDeleteNamespaceLabelsAndAnnotations(t *testing.T) {
+	var testCases = []struct {
+		field  string
+		delete func(c *Client, namespace string, keys []string) error
+	}{
+		{"labels", (*Client).DeleteNamespaceLabels},
+		{"annotations", (*Client).DeleteNamespaceAnnotations},
+	}
+
+	for _, tc := range testCases {
+		srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+			writeJSON(w, http.StatusOK, &k8sv1.Namespace{})
+		})
+
+		err := tc.delete(srv.Client(), "teresa", []string{"old", "deprecated"})
+		srv.Close()
+		if err != nil {
+			t.Fatal("got unexpected error:", err)
+		}
+
+		req := srv.Requests[0]
+		if req.Method != http.MethodPatch {
+			t.Errorf("got %s; want %s", req.Method, http.MethodPatch)
+		}
+		var patch map[string]map[string]map[string]*string
+		if err := json.Unmarshal(req.Body, &patch); err != nil {
+			t.Fatal("error decoding patch:", err)
+		}
+		keys := patch["metadata"][tc.field]
+		if len(keys) != 2 {
+			t.Errorf("got %v; want only the removed %s", keys, tc.field)
+		}
+		for _, key := range []string{"old", "deprecated"} {
+			v, ok := keys[key]
+			if !ok || v != nil {
+				t.Errorf("expected %s %s to be null on patch %s", tc.field, key, req.Body)
+			}
+		}
+	}
+}
+
+func TestSetNamespaceLabelsAndAnnotationsWithNilMaps(t *testing.T) {
+	var testCases = []struct {
+		field string
+		set   func(c *Client, namespace string, m map[string]string) error
+		get   func(ns *k8sv1.Namespace) map[string]string
+	}{
+		{
+			"labels",
+			(*Client).SetNamespaceLabels,
+			func(ns *k8sv1.Namespace) map[string]string { return ns.Labels },
+		},
+		{
+			"annotations",
+			(*Client).SetNamespaceAnnotations,
+			func(ns *k8sv1.Namespace) map[string]string { return ns.Annotations },
+		},
+	}
+
+	for _, tc := range testCases {
+		srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+			writeJSON(w, http.StatusOK, &k8sv1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "teresa"}})
+		})
+
+		err := tc.set(srv.Client(), "teresa", map[string]string{"key": "value"})
+		srv.Close()
+		if err != nil {
+			t.Fatal("got unexpected error:", err)
+		}
+
+		last := srv.Requests[len(srv.Requests)-1]
+		if last.Method != http.MethodPut {
+			t.Fatalf("got %s; want %s", last.Method, http.MethodPut)
+		}
+		ns := new(k8sv1.Namespace)
+		if err := json.Unmarshal(last.Body, ns); err != nil {
+			t.Fatal("error decoding namespace:", err)
+		}
+		if got := tc.get(ns)["key"]; got != "value" {
+			t.Errorf("got %s %q; want %q", tc.field, got, "value")
+		}
+	}
+}
+
+func TestSetNamespaceLabelsRetriesOnConflict(t *testing.T) {
+	updates := 0
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		if r.Method == http.MethodPut {
+			updates++
+			if updates == 1 {
+				writeStatus(w, http.StatusConflict, metav1.StatusReasonConflict)
+				return
+			}
+		}
+		writeJSON(w, http.StatusOK, &k8sv1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "teresa"}})
+	})
+	defer srv.Close()
+
+	if err := srv.Client().SetNamespaceLabels("teresa", map[string]string{"key": "value"}); err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+	if updates != 2 {
+		t.Errorf("got %d updates; want 2", updates)
+	}
+
+	var gets int
+	for _, req := range srv.Requests {
+		if req.Method == http.MethodGet {
+			gets++
+		}
+	}
+	if gets != 2 {
+		t.Errorf("got %d gets; want 2", gets)
+	}
+}
+
+func TestSetNamespaceAnnotationsGivesUpOnConflict(t *testing.T) {
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		if r.Method == http.MethodPut {
+			writeStatus(w, http.StatusConflict, metav1.StatusReasonConflict)
+			return
+		}
+		writeJSON(w, http.StatusOK, &k8sv1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "teresa"}})
+	})
+	defer srv.Close()
+
+	c := srv.Client()
+	err := c.SetNamespaceAnnotations("teresa", map[string]string{"key": "value"})
+	if !c.IsConflict(err) {
+		t.Errorf("got %v; want conflict error", err)
+	}
+}
+
+func TestPodEvents(t *testing.T) {
+	el := &k8sv1.EventList{
+		Items: []k8sv1.Event{
+			{
+				Type:          k8sv1.EventTypeWarning,
+				Reason:        "FailedScheduling",
+				Message:       "No nodes are available",
+				Count:         3,
+				LastTimestamp: metav1.Now(),
+			},
+			{
+				Type:    k8sv1.EventTypeWarning,
+				Reason:  "FailedMount",
+				Message: "Unable to mount volumes",
+				Count:   1,
+			},
+		},
+	}
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		writeJSON(w, http.StatusOK, el)
+	})
+	defer srv.Close()
+
+	events, err := srv.Client().PodEvents("teresa", "teresa-123")
+	if err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+
+	req := srv.Requests[0]
+	if expected := "/api/v1/namespaces/teresa/events"; req.Path != expected {
+		t.Errorf("got %s; want %s", req.Path, expected)
+	}
+	q, _ := url.ParseQuery(req.Query)
+	selector := q.Get("fieldSelector")
+	for _, term := range []string{"involvedObject.name=teresa-123", "involvedObject.kind=Pod"} {
+		if !strings.Contains(selector, term) {
+			t.Errorf("got field selector %s; want %s", selector, term)
+		}
+	}
+
+	if len(events) != len(el.Items) {
+		t.Fatalf("got %d events; want %d", len(events), len(el.Items))
+	}
+	for i, ev := range events {
+		item := el.Items[i]
+		if ev.Reason != item.Reason || ev.Message != item.Message || ev.Count != item.Count {
+			t.Errorf("got %+v; want %+v", ev, item)
+		}
+	}
+}
+
+func newEnvFromDeployHandler(envFrom []k8sv1.EnvFromSource) func(w http.ResponseWriter, r *fakeRequest) {
+	d := &k8s_extensions.Deployment{}
+	d.Spec.Template.Spec.Containers = []k8sv1.Container{{
+		Name:    "teresa",
+		Env:     []k8sv1.EnvVar{{Name: "KEY", Value: "value"}},
+		EnvFrom: envFrom,
+	}}
+	return newDiscoveryHandler(func(w http.ResponseWriter, r *fakeRequest) {
+		writeJSON(w, http.StatusOK, d)
+	}, extensionsV1beta1GroupVersion)
+}
+
+func decodeEnvFromPatch(t *testing.T, srv *fakeAPIServer) map[string]interface{} {
+	last := srv.Requests[len(srv.Requests)-1]
+	if last.Method != http.MethodPatch {
+		t.Fatalf("got %s; want %s", last.Method, http.MethodPatch)
+	}
+	var patch struct {
+		Spec struct {
+			Template struct {
+				Spec struct {
+					Containers []map[string]interface{}
+				}
+			}
+		}
+	}
+	if err := json.Unmarshal(last.Body, &patch); err != nil {
+		t.Fatal("error decoding patch:", err)
+	}
+	containers := patch.Spec.Template.Spec.Containers
+	if len(containers) != 1 {
+		t.Fatalf("got %d containers; want 1", len(containers))
+	}
+	return containers[0]
+}
+
+func TestCreateOrUpdateDeployConfigMapEnvFrom(t *testing.T) {
+	current := []k8sv1.EnvFromSource{{
+		SecretRef: &k8sv1.SecretEnvSource{
+			LocalObjectReference: k8sv1.LocalObjectReference{Name: "credentials"},
+		},
+	}}
+	srv := newFakeAPIServer(newEnvFromDeployHandler(current))
+	defer srv.Close()
+
+	if err := srv.Client().CreateOrUpdateDeployConfigMapEnvFrom("teresa", "teresa", "settings"); err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+
+	c := decodeEnvFromPatch(t, srv)
+	if _, ok := c["env"]; ok {
+		t.Error("expected literal env vars to be left untouched")
+	}
+	b, _ := json.Marshal(c["envFrom"])
+	expected := `[{"secretRef":{"name":"credentials"}},{"configMapRef":{"name":"settings"}}]`
+	if string(b) != expected {
+		t.Errorf("got %s; want %s", b, expected)
+	}
+}
+
+func TestCreateOrUpdateDeployConfigMapEnvFromAlreadySet(t *testing.T) {
+	current := []k8sv1.EnvFromSource{{
+		ConfigMapRef: &k8sv1.ConfigMapEnvSource{
+			LocalObjectReference: k8sv1.LocalObjectReference{Name: "settings"},
+		},
+	}}
+	srv := newFakeAPIServer(newEnvFromDeployHandler(current))
+	defer srv.Close()
+
+	if err := srv.Client().CreateOrUpdateDeployConfigMapEnvFrom("teresa", "teresa", "settings"); err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+	for _, req := range srv.Requests {
+		if req.Method != http.MethodGet {
+			t.Errorf("got request %s %s; want only the deploy get", req.Method, req.Path)
+		}
+	}
+}
+
+func TestCreateOrUpdateDeploySecretEnvFrom(t *testing.T) {
+	srv := newFakeAPIServer(newEnvFromDeployHandler(nil))
+	defer srv.Close()
+
+	if err := srv.Client().CreateOrUpdateDeploySecretEnvFrom("teresa", "teresa", "credentials"); err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+
+	c := decodeEnvFromPatch(t, srv)
+	if c["name"] != "teresa" {
+		t.Errorf("got %v; want teresa", c["name"])
+	}
+	b, _ := json.Marshal(c["envFrom"])
+	expected := `[{"secretRef":{"name":"credentials"}}]`
+	if string(b) != expected {
+		t.Errorf("got %s; want %s", b, expected)
+	}
+}
+
+func TestRenderDeploy(t *testing.T) {
+	ds := &spec.Deploy{
+		Pod: spec.Pod{
+			Name:      "app",
+			Namespace: "teresa",
+			Containers: []*spec.Container{{
+				Name:  "app",
+				Image: "luizalabs/teresa:0.0.1",
+			}},
+		},
+	}
+	var testCases = []struct {
+		groupVersion string
+		replicas     int32
+		expected     []string
+	}{
+		{"", 0, []string{"apiVersion: apps/v1beta1\n", "  replicas: 1\n"}},
+		{extensionsV1beta1GroupVersion, 3, []string{"apiVersion: extensions/v1beta1\n", "  replicas: 3\n"}},
+	}
+
+	for _, tc := range testCases {
+		b, err := RenderDeploy(ds, tc.groupVersion, tc.replicas)
+		if err != nil {
+			t.Fatal("got unexpected error:", err)
+		}
+		expected := append(tc.expected,
+			"kind: Deployment\n",
+			"  name: app\n",
+			"  namespace: teresa\n",
+			"image: luizalabs/teresa:0.0.1\n",
+		)
+		for _, e := range expected {
+			if !strings.Contains(string(b), e) {
+				t.Errorf("expected %q on rendered deploy:\n%s", e, b)
+			}
+		}
+	}
+}
+
+func TestRenderDeployUnsupportedGroupVersion(t *testing.T) {
+	ds := &spec.Deploy{Pod: spec.Pod{Name: "app", Namespace: "teresa"}}
+	if _, err := RenderDeploy(ds, "apps/v1", 1); errors.Cause(err) != ErrUnsupportedAPIVersion {
+		t.Errorf("got %v; want %v", err, ErrUnsupportedAPIVersion)
+	}
+}
+
+func TestPodReadinessGates(t *testing.T) {
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		pod := &k8sv1.Pod{Status: k8sv1.PodStatus{
+			Phase: k8sv1.PodRunning,
+			Conditions: []k8sv1.PodCondition{
+				{Type: k8sv1.PodScheduled, Status: k8sv1.ConditionTrue},
+				{Type: "www.example.com/feature-1", Status: k8sv1.ConditionFalse, Reason: "TargetNotHealthy"},
+				{Type: k8sv1.PodReady, Status: k8sv1.ConditionFalse, Reason: "ReadinessGatesNotReady"},
+			},
+		}}
+		writeJSON(w, http.StatusOK, pod)
+	})
+	defer srv.Close()
+
+	ready, conditions, err := srv.Client().PodReadinessGates("teresa", "teresa-123")
+	if err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+	if wantPath := "/api/v1/namespaces/teresa/pods/teresa-123"; srv.Requests[0].Path != wantPath {
+		t.Errorf("got %s; want %s", srv.Requests[0].Path, wantPath)
+	}
+	if ready {
+		t.Error("got ready; want not ready")
+	}
+	if len(conditions) != 3 {
+		t.Fatalf("got %d conditions; want 3", len(conditions))
+	}
+	expected := app.PodCondition{Type: "www.example.com/feature-1", Status: false, Reason: "TargetNotHealthy"}
+	if conditions[1] != expected {
+		t.Errorf("got %+v; want %+v", conditions[1], expected)
+	}
+}
+
+func TestPodNodeInfo(t *testing.T) {
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		switch r.Path {
+		case "/api/v1/namespaces/teresa/pods/teresa-123":
+			pod := &k8sv1.Pod{Spec: k8sv1.PodSpec{NodeName: "node-1"}}
+			writeJSON(w, http.StatusOK, pod)
+		case "/api/v1/nodes/node-1":
+			node := &k8sv1.Node{ObjectMeta: metav1.ObjectMeta{
+				Name: "node-1",
+				Labels: map[string]string{
+					zoneLabel:   "us-east-1a",
+					regionLabel: "us-east-1",
+				},
+			}}
+			writeJSON(w, http.StatusOK, node)
+		default:
+			writeStatus(w, http.StatusNotFound, metav1.StatusReasonNotFound)
+		}
+	})
+	defer srv.Close()
+
+	ni, err := srv.Client().PodNodeInfo("teresa", "teresa-123")
+	if err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+	expected := &app.NodeInfo{Name: "node-1", Zone: "us-east-1a", Region: "us-east-1"}
+	if *ni != *expected {
+		t.Errorf("got %+v; want %+v", ni, expected)
+	}
+}
+
+func TestPodNodeInfoNotScheduled(t *testing.T) {
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		writeJSON(w, http.StatusOK, &k8sv1.Pod{})
+	})
+	defer srv.Close()
+
+	if _, err := srv.Client().PodNodeInfo("teresa", "teresa-123"); err != ErrPodNotScheduled {
+		t.Errorf("got %v; want %v", err, ErrPodNotScheduled)
+	}
+}
+
+func TestCloudProviderName(t *testing.T) {
+	var testCases = []struct {
+		name     string
+		selector string
+	}{
+		{"self-managed", "kubernetes.io/role=master"},
+		{"kubeadm", "node-role.kubernetes.io/master"},
+		{"managed", ""},
+	}
+
+	for _, tc := range testCases {
+		srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+			q, _ := url.ParseQuery(r.Query)
+			nl := &k8sv1.NodeList{}
+			if q.Get("labelSelector") == tc.selector {
+				nl.Items = []k8sv1.Node{
+					{Spec: k8sv1.NodeSpec{ProviderID: "gce://project/us-central1-a/node"}},
+				}
+			}
+			writeJSON(w, http.StatusOK, nl)
+		})
+
+		name, err := srv.Client().CloudProviderName()
+		if err != nil {
+			t.Errorf("%s: got unexpected error: %v", tc.name, err)
+		} else if name != "gce" {
+			t.Errorf("%s: got %s; want %s", tc.name, name, "gce")
+		}
+		srv.Close()
+	}
+}
+
+func TestCloudProviderNameEmptyCluster(t *testing.T) {
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		writeJSON(w, http.StatusOK, &k8sv1.NodeList{})
+	})
+	defer srv.Close()
+
+	if _, err := srv.Client().CloudProviderName(); err == nil {
+		t.Error("got nil; want error")
+	}
+	if len(srv.Requests) != 3 {
+		t.Errorf("got %d requests; want 3", len(srv.Requests))
+	}
+}
+
+func TestClusterInfo(t *testing.T) {
+	newNode := func(name, instanceType string) k8sv1.Node {
+		return k8sv1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   name,
+				Labels: map[string]string{instanceTypeLabel: instanceType},
+			},
+			Spec: k8sv1.NodeSpec{ProviderID: "aws:///us-east-1a/" + name},
+		}
+	}
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		writeJSON(w, http.StatusOK, &k8sv1.NodeList{
+			Items: []k8sv1.Node{
+				newNode("i-1", "m4.large"),
+				newNode("i-2", "c4.xlarge"),
+				newNode("i-3", "m4.large"),
+			},
+		})
+	})
+	defer srv.Close()
+
+	info, err := srv.Client().ClusterInfo()
+	if err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+	if wantPath := "/api/v1/nodes"; srv.Requests[0].Path != wantPath {
+		t.Errorf("got %s; want %s", srv.Requests[0].Path, wantPath)
+	}
+	if info.Provider != "aws" {
+		t.Errorf("got %s; want %s", info.Provider, "aws")
+	}
+	if info.Nodes != 3 {
+		t.Errorf("got %d; want %d", info.Nodes, 3)
+	}
+	if actual := strings.Join(info.InstanceTypes, ","); actual != "c4.xlarge,m4.large" {
+		t.Errorf("got %s; want %s", actual, "c4.xlarge,m4.large")
+	}
+}
+
+func TestPruneReplicaSets(t *testing.T) {
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		if r.Method == http.MethodDelete {
+			writeStatus(w, http.StatusOK, "")
+			return
+		}
+		writeJSON(w, http.StatusOK, &k8s_extensions.ReplicaSetList{
+			Items: []k8s_extensions.ReplicaSet{
+				newReplicaSet("3", "luizalabs/app:v3", 0),
+				newReplicaSet("1", "luizalabs/app:v1", 0),
+				newReplicaSet("5", "luizalabs/app:v5", 2),
+				newReplicaSet("2", "luizalabs/app:v2", 1),
+				newReplicaSet("4", "luizalabs/app:v4", 0),
+			},
+		})
+	})
+	defer srv.Close()
+
+	if err := srv.Client().PruneReplicaSets("teresa", "run", "app", 2); err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+
+	var deleted []string
+	for _, req := range srv.Requests {
+		if req.Method == http.MethodDelete {
+			deleted = append(deleted, req.Path)
+		}
+	}
+	sort.Strings(deleted)
+	expected := []string{
+		"/apis/extensions/v1beta1/namespaces/teresa/replicasets/app-1",
+		"/apis/extensions/v1beta1/namespaces/teresa/replicasets/app-3",
+	}
+	if strings.Join(deleted, ",") != strings.Join(expected, ",") {
+		t.Errorf("got %v; want %v", deleted, expected)
+	}
+}
+
+func TestPruneReplicaSetsKeepsNewest(t *testing.T) {
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		if r.Method == http.MethodDelete {
+			writeStatus(w, http.StatusOK, "")
+			return
+		}
+		writeJSON(w, http.StatusOK, &k8s_extensions.ReplicaSetList{
+			Items: []k8s_extensions.ReplicaSet{
+				newReplicaSet("1", "luizalabs/app:v1", 0),
+				newReplicaSet("2", "luizalabs/app:v2", 0),
+			},
+		})
+	})
+	defer srv.Close()
+
+	if err := srv.Client().PruneReplicaSets("teresa", "run", "app", 0); err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+	last := srv.Requests[len(srv.Requests)-1]
+	if expected := "/apis/extensions/v1beta1/namespaces/teresa/replicasets/app-1"; last.Path != expected {
+		t.Errorf("got %s %s; want DELETE %s", last.Method, last.Path, expected)
+	}
+	if len(srv.Requests) != 2 {
+		t.Errorf("got %d requests; want 2", len(srv.Requests))
+	}
+}
+
+func TestDeployEnvVars(t *testing.T) {
+	d := &k8s_extensions.Deployment{}
+	d.Spec.Template.Spec.Containers = []k8sv1.Container{
+		{Name: "nginx", Env: []k8sv1.EnvVar{{Name: "NGINX_PORT", Value: "5000"}}},
+		{
+			Name: "app",
+			Env: []k8sv1.EnvVar{
+				{Name: "PORT", Value: "6000"},
+				{
+					Name: "PASSWORD",
+					ValueFrom: &k8sv1.EnvVarSource{
+						SecretKeyRef: &k8sv1.SecretKeySelector{
+							LocalObjectReference: k8sv1.LocalObjectReference{Name: app.TeresaAppSecrets},
+							Key:                  "PASSWORD",
+						},
+					},
+				},
+				{Name: "DEBUG", Value: "false"},
+			},
+		},
+	}
+	srv := newFakeAPIServer(newDiscoveryHandler(func(w http.ResponseWriter, r *fakeRequest) {
+		writeJSON(w, http.StatusOK, d)
+	}, extensionsV1beta1GroupVersion))
+	defer srv.Close()
+
+	evs, secrets, err := srv.Client().DeployEnvVars("teresa", "app")
+	if err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+	if last := srv.Requests[len(srv.Requests)-1]; last.Path != "/apis/extensions/v1beta1/namespaces/teresa/deployments/app" {
+		t.Errorf("got unexpected path %s", last.Path)
+	}
+
+	expected := []*app.EnvVar{{Key: "PORT", Value: "6000"}, {Key: "DEBUG", Value: "false"}}
+	if len(evs) != len(expected) {
+		t.Fatalf("got %d env vars; want %d", len(evs), len(expected))
+	}
+	for i := range expected {
+		if *evs[i] != *expected[i] {
+			t.Errorf("got %v; want %v", evs[i], expected[i])
+		}
+	}
+	if len(secrets) != 1 || secrets[0] != "PASSWORD" {
+		t.Errorf("got %v; want [PASSWORD]", secrets)
+	}
+}
+
+func TestDeployRollbackToPrevious(t *testing.T) {
+	var testCases = []struct {
+		revision    string
+		expected    string
+		expectedErr error
+	}{
+		{"2", `{"spec":{"rollbackTo":{"revision": 1}}}`, nil},
+		{"1", "", ErrNoPreviousRevision},
+	}
+
+	for _, tc := range testCases {
+		d := &k8s_extensions.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Annotations: map[string]string{revisionAnnotation: tc.revision},
+			},
+		}
+		srv := newFakeAPIServer(newDiscoveryHandler(func(w http.ResponseWriter, r *fakeRequest) {
+			if strings.HasSuffix(r.Path, "/deployments/app") {
+				writeJSON(w, http.StatusOK, d)
+				return
+			}
+			writeJSON(w, http.StatusOK, &k8s_extensions.ReplicaSetList{
+				Items: []k8s_extensions.ReplicaSet{
+					newReplicaSet("2", "luizalabs/app:v2", 1),
+					newReplicaSet("1", "luizalabs/app:v1", 0),
+				},
+			})
+		}, extensionsV1beta1GroupVersion))
+
+		err := srv.Client().DeployRollbackToPrevious("teresa", "app")
+		srv.Close()
+		if err != tc.expectedErr {
+			t.Errorf("got %v; want %v", err, tc.expectedErr)
+			continue
+		}
+		var patches []string
+		for _, req := range srv.Requests {
+			if req.Method == http.MethodPatch {
+				patches = append(patches, string(req.Body))
+			}
+		}
+		if tc.expected == "" {
+			if len(patches) != 0 {
+				t.Errorf("got %v; want no patch", patches)
+			}
+			continue
+		}
+		if len(patches) != 1 || patches[0] != tc.expected {
+			t.Errorf("got %v; want %s", patches, tc.expected)
+		}
+	}
+}
+
+func TestCurrentDeployDescription(t *testing.T) {
+	var testCases = []struct {
+		revision    string
+		expected    string
+		expectedErr error
+	}{
+		{"2", "deploy 2", nil},
+		{"3", "", ErrNotFound},
+	}
+
+	for _, tc := range testCases {
+		d := &k8s_extensions.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Annotations: map[string]string{revisionAnnotation: tc.revision},
+			},
+		}
+		srv := newFakeAPIServer(newDiscoveryHandler(func(w http.ResponseWriter, r *fakeRequest) {
+			if strings.HasSuffix(r.Path, "/deployments/app") {
+				writeJSON(w, http.StatusOK, d)
+				return
+			}
+			writeJSON(w, http.StatusOK, &k8s_extensions.ReplicaSetList{
+				Items: []k8s_extensions.ReplicaSet{
+					newReplicaSet("1", "luizalabs/app:v1", 0),
+					newReplicaSet("2", "luizalabs/app:v2", 1),
+				},
+			})
+		}, extensionsV1beta1GroupVersion))
+
+		desc, err := srv.Client().CurrentDeployDescription("teresa", "app")
+		srv.Close()
+		if err != tc.expectedErr {
+			t.Errorf("got %v; want %v", err, tc.expectedErr)
+		}
+		if desc != tc.expected {
+			t.Errorf("got %s; want %s", desc, tc.expected)
+		}
+	}
+}
+
+func TestCreateServiceInvalidSourceRange(t *testing.T) {
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		writeJSON(w, http.StatusCreated, &k8sv1.Service{})
+	})
+	defer srv.Close()
+
+	opts := &service.ServiceOptions{SourceRanges: []string{"not-a-cidr"}}
+	err := srv.Client().createService("teresa", "teresa", "LoadBalancer", opts)
+	if errors.Cause(err) != ErrInvalidSourceRange {
+		t.Errorf("got %v; want %v", err, ErrInvalidSourceRange)
+	}
+	if len(srv.Requests) != 0 {
+		t.Errorf("got %d requests; want 0", len(srv.Requests))
+	}
+}
+
+func TestWaitForAddress(t *testing.T) {
+	gets := 0
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		gets++
+		svc := &k8sv1.Service{}
+		if gets >= 3 {
+			svc.Status.LoadBalancer.Ingress = []k8sv1.LoadBalancerIngress{{IP: "10.0.0.1"}}
+		}
+		writeJSON(w, http.StatusOK, svc)
+	})
+	defer srv.Close()
+
+	addr, err := srv.Client().waitForAddress("teresa", "teresa", time.Millisecond, time.Second)
+	if err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+	if addr != "10.0.0.1" {
+		t.Errorf("got %s; want 10.0.0.1", addr)
+	}
+	if gets != 3 {
+		t.Errorf("got %d polls; want 3", gets)
+	}
+}
+
+func TestWaitForAddressTimeout(t *testing.T) {
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		writeJSON(w, http.StatusOK, &k8sv1.Service{})
+	})
+	defer srv.Close()
+
+	_, err := srv.Client().waitForAddress("teresa", "teresa", time.Millisecond, 20*time.Millisecond)
+	if err != wait.ErrWaitTimeout {
+		t.Errorf("got %v; want %v", err, wait.ErrWaitTimeout)
+	}
+}
+
+func TestWaitForAddressHeadless(t *testing.T) {
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		svc := &k8sv1.Service{Spec: k8sv1.ServiceSpec{ClusterIP: k8sv1.ClusterIPNone}}
+		writeJSON(w, http.StatusOK, svc)
+	})
+	defer srv.Close()
+
+	_, err := srv.Client().waitForAddress("teresa", "teresa", time.Millisecond, time.Second)
+	if err != ErrHeadlessService {
+		t.Errorf("got %v; want %v", err, ErrHeadlessService)
+	}
+	if len(srv.Requests) != 1 {
+		t.Errorf("got %d requests; want 1", len(srv.Requests))
+	}
+}
+
+func TestExposeDeployHeadless(t *testing.T) {
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		if r.Method == http.MethodGet {
+			writeStatus(w, http.StatusNotFound, metav1.StatusReasonNotFound)
+			return
+		}
+		writeJSON(w, http.StatusCreated, &k8sv1.Service{})
+	})
+	defer srv.Close()
+
+	c := srv.Client()
+	c.ingress = true
+	opts := &service.ServiceOptions{Headless: true}
+	if err := c.ExposeDeployWithOptions("teresa", "teresa", "", "LoadBalancer", opts, ioutil.Discard); err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+
+	for _, req := range srv.Requests {
+		if strings.Contains(req.Path, "ingresses") {
+			t.Errorf("got request %s %s; want no ingress", req.Method, req.Path)
+		}
+	}
+	last := srv.Requests[len(srv.Requests)-1]
+	svc := new(k8sv1.Service)
+	if err := json.Unmarshal(last.Body, svc); err != nil {
+		t.Fatal("error decoding service:", err)
+	}
+	if svc.Spec.ClusterIP != k8sv1.ClusterIPNone {
+		t.Errorf("got %q; want %q", svc.Spec.ClusterIP, k8sv1.ClusterIPNone)
+	}
+}
+
+func TestExposeDeployUpdatesTargetPort(t *testing.T) {
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		if r.Method == http.MethodGet {
+			writeJSON(w, http.StatusOK, serviceSpec("teresa", "teresa", "ClusterIP", nil))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(r.Body)
+	})
+	defer srv.Close()
+
+	opts := &service.ServiceOptions{TargetPort: 8080}
+	if err := srv.Client().ExposeDeployWithOptions("teresa", "teresa", "", "ClusterIP", opts, ioutil.Discard); err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+
+	last := srv.Requests[len(srv.Requests)-1]
+	if last.Method != http.MethodPut {
+		t.Fatalf("got %s; want %s", last.Method, http.MethodPut)
+	}
+	svc := new(k8sv1.Service)
+	if err := json.Unmarshal(last.Body, svc); err != nil {
+		t.Fatal("error decoding service:", err)
+	}
+	if actual := svc.Spec.Ports[0].TargetPort.IntValue(); actual != 8080 {
+		t.Errorf("got %d; want 8080", actual)
+	}
+}
+
+func TestExposeDeployKeepsTargetPort(t *testing.T) {
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		writeJSON(w, http.StatusOK, serviceSpec("teresa", "teresa", "ClusterIP", nil))
+	})
+	defer srv.Close()
+
+	opts := &service.ServiceOptions{TargetPort: spec.DefaultPort}
+	if err := srv.Client().ExposeDeployWithOptions("teresa", "teresa", "", "ClusterIP", opts, ioutil.Discard); err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+
+	for _, req := range srv.Requests {
+		if req.Method != http.MethodGet {
+			t.Errorf("got request %s %s; want only reads", req.Method, req.Path)
+		}
+	}
+}
+
+func TestAllServicePorts(t *testing.T) {
+	newService := func(name string, ports ...int32) k8sv1.Service {
+		svc := k8sv1.Service{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		for _, p := range ports {
+			svc.Spec.Ports = append(svc.Spec.Ports, k8sv1.ServicePort{
+				Name:       fmt.Sprintf("port-%d", p),
+				Port:       p,
+				TargetPort: intstr.FromInt(5000),
+			})
+		}
+		return svc
+	}
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		writeJSON(w, http.StatusOK, &k8sv1.ServiceList{
+			Items: []k8sv1.Service{
+				newService("teresa", 80, 443),
+				newService("teresa-admin", 8080),
+			},
+		})
+	})
+	defer srv.Close()
+
+	ports, err := srv.Client().AllServicePorts("teresa")
+	if err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+	expected := map[string][]int{
+		"teresa":       {80, 443},
+		"teresa-admin": {8080},
+	}
+	if len(ports) != len(expected) {
+		t.Fatalf("got %d services; want %d", len(ports), len(expected))
+	}
+	for name, want := range expected {
+		got := ports[name]
+		if len(got) != len(want) {
+			t.Fatalf("got %d ports for %s; want %d", len(got), name, len(want))
+		}
+		for i, p := range want {
+			if got[i].Port != p || got[i].Name != fmt.Sprintf("port-%d", p) || got[i].TargetPort != 5000 {
+				t.Errorf("got %+v for %s; want port %d", got[i], name, p)
+			}
+		}
+	}
+}
+
+func TestUpdateServicePortsDuplicateNames(t *testing.T) {
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		writeJSON(w, http.StatusOK, &k8sv1.Service{})
+	})
+	defer srv.Close()
+
+	ports := []service.ServicePort{
+		{Name: "http", TargetPort: 5000},
+		{Name: "http", Port: 9090, TargetPort: 9090},
+	}
+	err := srv.Client().UpdateServicePorts("teresa", "teresa", ports)
+	if errors.Cause(err) != ErrInvalidServicePorts {
+		t.Errorf("got %v; want %v", err, ErrInvalidServicePorts)
+	}
+	if len(srv.Requests) != 0 {
+		t.Errorf("got %d requests; want 0", len(srv.Requests))
+	}
+}
+
+func TestUpdateServicePortsInvalidProtocol(t *testing.T) {
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		writeJSON(w, http.StatusOK, &k8sv1.Service{})
+	})
+	defer srv.Close()
+
+	ports := []service.ServicePort{{Name: "dns", Port: 53, TargetPort: 53, Protocol: "udp"}}
+	err := srv.Client().UpdateServicePorts("teresa", "teresa", ports)
+	if errors.Cause(err) != ErrInvalidServiceProtocol {
+		t.Errorf("got %v; want %v", err, ErrInvalidServiceProtocol)
+	}
+	if len(srv.Requests) != 0 {
+		t.Errorf("got %d requests; want 0", len(srv.Requests))
+	}
+}
+
+func TestValidateServicePortsMismatch(t *testing.T) {
+	d := &k8s_extensions.Deployment{}
+	d.Spec.Template.Spec.Containers = []k8sv1.Container{{
+		Name:  "teresa",
+		Ports: []k8sv1.ContainerPort{{ContainerPort: 5000}},
+	}}
+	srv := newFakeAPIServer(newDiscoveryHandler(func(w http.ResponseWriter, r *fakeRequest) {
+		writeJSON(w, http.StatusOK, d)
+	}, extensionsV1beta1GroupVersion))
+	defer srv.Close()
+
+	ports := []service.ServicePort{{Name: "tcp", Port: 80, TargetPort: 6000}}
+	err := srv.Client().ValidateServicePorts("teresa", "teresa", ports)
+	if errors.Cause(err) != ErrInvalidTargetPort {
+		t.Errorf("got %v; want %v", err, ErrInvalidTargetPort)
+	}
+}
+
+func TestNamespaceAge(t *testing.T) {
+	created := time.Now().Add(-48 * time.Hour)
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		writeJSON(w, http.StatusOK, &k8sv1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              "teresa",
+				CreationTimestamp: metav1.NewTime(created),
+			},
+		})
+	})
+	defer srv.Close()
+
+	age, err := srv.Client().NamespaceAge("teresa")
+	if err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+	// the timestamp is serialized with second precision
+	if age < 48*time.Hour-time.Second || age > 48*time.Hour+time.Minute {
+		t.Errorf("got %v; want about 48h", age)
+	}
+}
+
+func TestPodCountByState(t *testing.T) {
+	newPod := func(phase k8sv1.PodPhase) k8sv1.Pod {
+		return k8sv1.Pod{Status: k8sv1.PodStatus{Phase: phase}}
+	}
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		writeJSON(w, http.StatusOK, &k8sv1.PodList{
+			Items: []k8sv1.Pod{
+				newPod(k8sv1.PodRunning),
+				newPod(k8sv1.PodPending),
+				newPod(k8sv1.PodRunning),
+				newPod(k8sv1.PodFailed),
+				newPod(k8sv1.PodRunning),
+			},
+		})
+	})
+	defer srv.Close()
+
+	count, err := srv.Client().PodCountByState("teresa")
+	if err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+	expected := map[string]int{"Running": 3, "Pending": 1, "Failed": 1}
+	if len(count) != len(expected) {
+		t.Errorf("got %v; want %v", count, expected)
+	}
+	for state, n := range expected {
+		if count[state] != n {
+			t.Errorf("got %d %s pods; want %d", count[state], state, n)
+		}
+	}
+}
+
+func TestPodMetrics(t *testing.T) {
+	metrics := `{"kind": "PodMetricsList", "apiVersion": "metrics.k8s.io/v1beta1", "items": [
+		{"metadata": {"name": "teresa-1"}, "containers": [
+			{"name": "teresa", "usage": {"cpu": "150m", "memory": "64Mi"}},
+			{"name": "sidecar", "usage": {"cpu": "50m", "memory": "64Mi"}}
+		]}
+	]}`
+	srv := newFakeAPIServer(newDiscoveryHandler(func(w http.ResponseWriter, r *fakeRequest) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(metrics))
+	}, metricsV1beta1GroupVersion))
+	defer srv.Close()
+
+	pms, err := srv.Client().PodMetrics("teresa")
+	if err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+
+	last := srv.Requests[len(srv.Requests)-1]
+	if expected := "/apis/metrics.k8s.io/v1beta1/namespaces/teresa/pods"; last.Path != expected {
+		t.Errorf("got %s; want %s", last.Path, expected)
+	}
+	if len(pms) != 1 {
+		t.Fatalf("got %d; want %d", len(pms), 1)
+	}
+	expected := &app.PodMetric{Name: "teresa-1", CPU: "200m", Memory: "128Mi"}
+	if *pms[0] != *expected {
+		t.Errorf("got %+v; want %+v", pms[0], expected)
+	}
+}
+
+func TestPodMetricsWithoutMetricsServer(t *testing.T) {
+	srv := newFakeAPIServer(newDiscoveryHandler(func(w http.ResponseWriter, r *fakeRequest) {
+		t.Errorf("got unexpected request %s %s", r.Method, r.Path)
+	}, autoscalingV1GroupVersion))
+	defer srv.Close()
+
+	if _, err := srv.Client().PodMetrics("teresa"); err != ErrMetricsUnavailable {
+		t.Errorf("got %v; want %v", err, ErrMetricsUnavailable)
+	}
+}
+
+func TestPodListByOwner(t *testing.T) {
+	newPod := func(name, kind, owner string) k8sv1.Pod {
+		controller := true
+		return k8sv1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			OwnerReferences: []metav1.OwnerReference{
+				{Kind: kind, Name: owner, Controller: &controller},
+			},
+		}}
+	}
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		writeJSON(w, http.StatusOK, &k8sv1.PodList{
+			Items: []k8sv1.Pod{
+				newPod("web-1", "ReplicaSet", "web-123"),
+				newPod("cron-1", "Job", "cron-456"),
+				newPod("web-2", "ReplicaSet", "web-123"),
+				newPod("web-old", "ReplicaSet", "web-000"),
+				{ObjectMeta: metav1.ObjectMeta{Name: "orphan"}},
+			},
+		})
+	})
+	defer srv.Close()
+
+	var testCases = []struct {
+		opts     *app.PodListOptions
+		expected []string
+	}{
+		{&app.PodListOptions{}, []string{"web-1", "cron-1", "web-2", "web-old", "orphan"}},
+		{&app.PodListOptions{OwnerKind: "ReplicaSet"}, []string{"web-1", "web-2", "web-old"}},
+		{&app.PodListOptions{OwnerKind: "ReplicaSet", OwnerName: "web-123"}, []string{"web-1", "web-2"}},
+		{&app.PodListOptions{OwnerKind: "Job"}, []string{"cron-1"}},
+	}
+
+	for _, tc := range testCases {
+		pods, err := srv.Client().PodList("teresa", tc.opts)
+		if err != nil {
+			t.Fatal("got unexpected error:", err)
+		}
+		var names []string
+		for _, p := range pods {
+			names = append(names, p.Name)
+		}
+		if strings.Join(names, ",") != strings.Join(tc.expected, ",") {
+			t.Errorf("got %v; want %v", names, tc.expected)
+		}
+	}
+}
+
+func TestEvictPodsOnNode(t *testing.T) {
+	newPod := func(name, node string) k8sv1.Pod {
+		return k8sv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "teresa"},
+			Spec:       k8sv1.PodSpec{NodeName: node},
+		}
+	}
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		if r.Method == http.MethodPost {
+			writeStatus(w, http.StatusCreated, "")
+			return
+		}
+		writeJSON(w, http.StatusOK, &k8sv1.PodList{
+			Items: []k8sv1.Pod{
+				newPod("teresa-1", "node-1"),
+				newPod("teresa-2", "node-2"),
+				newPod("teresa-3", "node-1"),
+			},
+		})
+	})
+	defer srv.Close()
+
+	if err := srv.Client().EvictPodsOnNode("teresa", "node-1"); err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+
+	q, _ := url.ParseQuery(srv.Requests[0].Query)
+	if selector := q.Get("fieldSelector"); selector != "spec.nodeName=node-1" {
+		t.Errorf("got field selector %s; want spec.nodeName=node-1", selector)
+	}
+
+	var evicted []string
+	for _, req := range srv.Requests[1:] {
+		if req.Method != http.MethodPost {
+			t.Errorf("got %s; want %s", req.Method, http.MethodPost)
+		}
+		evicted = append(evicted, req.Path)
+	}
+	expected := []string{
+		"/api/v1/namespaces/teresa/pods/teresa-1/eviction",
+		"/api/v1/namespaces/teresa/pods/teresa-3/eviction",
+	}
+	if strings.Join(evicted, ",") != strings.Join(expected, ",") {
+		t.Errorf("got %v; want %v", evicted, expected)
+	}
+}
+
+func TestEvictPodsOnNodeDisruptionBudget(t *testing.T) {
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		if r.Method == http.MethodPost {
+			writeStatus(w, http.StatusTooManyRequests, "TooManyRequests")
+			return
+		}
+		writeJSON(w, http.StatusOK, &k8sv1.PodList{
+			Items: []k8sv1.Pod{
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "teresa-1", Namespace: "teresa"},
+					Spec:       k8sv1.PodSpec{NodeName: "node-1"},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "teresa-2", Namespace: "teresa"},
+					Spec:       k8sv1.PodSpec{NodeName: "node-1"},
+				},
+			},
+		})
+	})
+	defer srv.Close()
+
+	err := srv.Client().EvictPodsOnNode("teresa", "node-1")
+	if err == nil {
+		t.Fatal("expected error; got nil")
+	}
+	evictions := 0
+	for _, req := range srv.Requests {
+		if req.Method == http.MethodPost {
+			evictions++
+		}
+	}
+	if evictions != 2 {
+		t.Errorf("got %d evictions; want 2", evictions)
+	}
+	for _, name := range []string{"teresa-1", "teresa-2"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("got %q; want it to contain %s", err, name)
+		}
+	}
+}
+
+func TestNewPDB(t *testing.T) {
+	a := &app.App{Name: "teresa"}
+	pdb := newPDB(a, 3)
+
+	if pdb.Name != a.Name || pdb.Namespace != a.Name {
+		t.Errorf("got %s/%s; want %s/%s", pdb.Namespace, pdb.Name, a.Name, a.Name)
+	}
+	if actual := pdb.Spec.MinAvailable.IntValue(); actual != 2 {
+		t.Errorf("got %d; want %d", actual, 2)
+	}
+	if actual := pdb.Spec.Selector.MatchLabels["run"]; actual != a.Name {
+		t.Errorf("got %s; want %s", actual, a.Name)
+	}
+}
+
+func TestCreateOrUpdatePDB(t *testing.T) {
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		switch r.Method {
+		case http.MethodGet:
+			writeStatus(w, http.StatusNotFound, metav1.StatusReasonNotFound)
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			w.Write(r.Body)
+		}
+	})
+	defer srv.Close()
+
+	a := &app.App{Name: "teresa", Autoscale: &app.Autoscale{Min: 4, Max: 8}}
+	if err := srv.Client().CreateOrUpdatePDB(a); err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+
+	last := srv.Requests[len(srv.Requests)-1]
+	expectedPath := "/apis/policy/v1beta1/namespaces/teresa/poddisruptionbudgets"
+	if last.Method != http.MethodPost || last.Path != expectedPath {
+		t.Fatalf("got %s %s; want POST %s", last.Method, last.Path, expectedPath)
+	}
+	pdb := new(policy.PodDisruptionBudget)
+	if err := json.Unmarshal(last.Body, pdb); err != nil {
+		t.Fatal("error decoding pdb:", err)
+	}
+	if actual := pdb.Spec.MinAvailable.IntValue(); actual != 3 {
+		t.Errorf("got %d; want %d", actual, 3)
+	}
+}
+
+func TestCreateOrUpdatePDBSingleReplica(t *testing.T) {
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		writeStatus(w, http.StatusNotFound, metav1.StatusReasonNotFound)
+	})
+	defer srv.Close()
+
+	a := &app.App{Name: "teresa", Autoscale: &app.Autoscale{Min: 1, Max: 2}}
+	if err := srv.Client().CreateOrUpdatePDB(a); err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+	for _, req := range srv.Requests {
+		if strings.Contains(req.Path, "poddisruptionbudgets") && req.Method != http.MethodDelete {
+			t.Errorf("got unexpected request %s %s", req.Method, req.Path)
+		}
+	}
+}
+
+func TestCreateOrUpdatePDBDeletesOnSingleReplica(t *testing.T) {
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		if r.Method == http.MethodDelete {
+			writeJSON(w, http.StatusOK, &metav1.Status{Status: metav1.StatusSuccess})
+			return
+		}
+		writeStatus(w, http.StatusNotFound, metav1.StatusReasonNotFound)
+	})
+	defer srv.Close()
+
+	a := &app.App{Name: "teresa", Autoscale: &app.Autoscale{Min: 1, Max: 2}}
+	if err := srv.Client().CreateOrUpdatePDB(a); err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+
+	last := srv.Requests[len(srv.Requests)-1]
+	expectedPath := "/apis/policy/v1beta1/namespaces/teresa/poddisruptionbudgets/teresa"
+	if last.Method != http.MethodDelete || last.Path != expectedPath {
+		t.Errorf("got %s %s; want DELETE %s", last.Method, last.Path, expectedPath)
+	}
+}
+
+func TestPDBMinAvailable(t *testing.T) {
+	minAvailable := intstr.FromInt(2)
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		writeJSON(w, http.StatusOK, &policy.PodDisruptionBudget{
+			ObjectMeta: metav1.ObjectMeta{Name: "teresa", Namespace: "teresa"},
+			Spec:       policy.PodDisruptionBudgetSpec{MinAvailable: &minAvailable},
+		})
+	})
+	defer srv.Close()
+
+	actual, err := srv.Client().PDBMinAvailable("teresa")
+	if err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+	if actual != 2 {
+		t.Errorf("got %d; want %d", actual, 2)
+	}
+}
+
+func TestSecretKeys(t *testing.T) {
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		writeJSON(w, http.StatusOK, &k8sv1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "credentials", Namespace: "teresa"},
+			Data: map[string][]byte{
+				"PASSWORD": []byte("s3cr3t"),
+				"API_KEY":  []byte("k3y"),
+			},
+		})
+	})
+	defer srv.Close()
+
+	keys, err := srv.Client().SecretKeys("teresa", "credentials")
+	if err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+	expected := []string{"API_KEY", "PASSWORD"}
+	if strings.Join(keys, ",") != strings.Join(expected, ",") {
+		t.Errorf("got %v; want %v", keys, expected)
+	}
+	for _, key := range keys {
+		if strings.Contains(key, "s3cr3t") || strings.Contains(key, "k3y") {
+			t.Errorf("got secret value on %s", key)
+		}
+	}
+}
+
+// newSecretPatchHandler keeps the secret data, applying the patches it
+// receives the way the API server would for the data field
+func newSecretPatchHandler(data map[string][]byte) func(w http.ResponseWriter, r *fakeRequest) {
+	return func(w http.ResponseWriter, r *fakeRequest) {
+		if r.Method == http.MethodPatch {
+			patch := struct {
+				Data map[string]json.RawMessage `json:"data"`
+			}{}
+			if err := json.Unmarshal(r.Body, &patch); err != nil {
+				writeStatus(w, http.StatusBadRequest, metav1.StatusReasonBadRequest)
+				return
+			}
+			for key, raw := range patch.Data {
+				if string(raw) == "null" {
+					delete(data, key)
+					continue
+				}
+				var value []byte
+				if err := json.Unmarshal(raw, &value); err != nil {
+					writeStatus(w, http.StatusBadRequest, metav1.StatusReasonBadRequest)
+					return
+				}
+				data[key] = value
+			}
+		}
+		writeJSON(w, http.StatusOK, &k8sv1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "credentials", Namespace: "teresa"},
+			Data:       data,
+		})
+	}
+}
+
+func TestPatchSecretData(t *testing.T) {
+	data := map[string][]byte{
+		"USER":     []byte("teresa"),
+		"PASSWORD": []byte("old"),
+		"HOST":     []byte("db"),
+	}
+	srv := newFakeAPIServer(newSecretPatchHandler(data))
+	defer srv.Close()
+
+	patch := map[string][]byte{"PASSWORD": []byte("new")}
+	if err := srv.Client().PatchSecretData("teresa", "credentials", patch); err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+
+	req := srv.Requests[0]
+	if req.Method != http.MethodPatch {
+		t.Errorf("got %s; want %s", req.Method, http.MethodPatch)
+	}
+	if expected := "/api/v1/namespaces/teresa/secrets/credentials"; req.Path != expected {
+		t.Errorf("got %s; want %s", req.Path, expected)
+	}
+
+	expected := map[string]string{"USER": "teresa", "PASSWORD": "new", "HOST": "db"}
+	if len(data) != len(expected) {
+		t.Errorf("got %d keys; want %d", len(data), len(expected))
+	}
+	for key, value := range expected {
+		if actual := string(data[key]); actual != value {
+			t.Errorf("got %s; want %s", actual, value)
+		}
+	}
+}
+
+func TestDeleteSecretKeys(t *testing.T) {
+	data := map[string][]byte{
+		"USER":         []byte("teresa"),
+		"PASSWORD":     []byte("new"),
+		"OLD_PASSWORD": []byte("old"),
+	}
+	srv := newFakeAPIServer(newSecretPatchHandler(data))
+	defer srv.Close()
+
+	if err := srv.Client().DeleteSecretKeys("teresa", "credentials", []string{"OLD_PASSWORD"}); err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+
+	req := srv.Requests[0]
+	if req.Method != http.MethodPatch {
+		t.Errorf("got %s; want %s", req.Method, http.MethodPatch)
+	}
+	if _, ok := data["OLD_PASSWORD"]; ok {
+		t.Error("expected OLD_PASSWORD to be removed")
+	}
+	expected := map[string]string{"USER": "teresa", "PASSWORD": "new"}
+	if len(data) != len(expected) {
+		t.Errorf("got %d keys; want %d", len(data), len(expected))
+	}
+	for key, value := range expected {
+		if actual := string(data[key]); actual != value {
+			t.Errorf("got %s; want %s", actual, value)
+		}
+	}
+}
+
+func newTestKeyPair(t *testing.T) ([]byte, []byte) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal("error generating key:", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "teresa.example.com"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &priv.PublicKey, priv)
+	if err != nil {
+		t.Fatal("error creating certificate:", err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(priv)
+	if err != nil {
+		t.Fatal("error encoding key:", err)
+	}
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	key := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	return cert, key
+}
+
+func TestCreateOrUpdateTLSSecret(t *testing.T) {
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(r.Body)
+	})
+	defer srv.Close()
+
+	cert, key := newTestKeyPair(t)
+	if err := srv.Client().CreateOrUpdateTLSSecret("teresa", "teresa-tls", cert, key); err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+
+	req := srv.Requests[0]
+	if req.Method != http.MethodPut {
+		t.Errorf("got %s; want %s", req.Method, http.MethodPut)
+	}
+	s := new(k8sv1.Secret)
+	if err := json.Unmarshal(req.Body, s); err != nil {
+		t.Fatal("error decoding secret:", err)
+	}
+	if s.Type != k8sv1.SecretTypeTLS {
+		t.Errorf("got %s; want %s", s.Type, k8sv1.SecretTypeTLS)
+	}
+	if string(s.Data[k8sv1.TLSCertKey]) != string(cert) {
+		t.Errorf("got %s; want %s", s.Data[k8sv1.TLSCertKey], cert)
+	}
+	if string(s.Data[k8sv1.TLSPrivateKeyKey]) != string(key) {
+		t.Errorf("got %s; want %s", s.Data[k8sv1.TLSPrivateKeyKey], key)
+	}
+}
+
+func TestCreateOrUpdateTLSSecretMismatchedKeyPair(t *testing.T) {
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		t.Errorf("got unexpected request %s %s", r.Method, r.Path)
+	})
+	defer srv.Close()
+
+	cert, _ := newTestKeyPair(t)
+	_, key := newTestKeyPair(t)
+	err := srv.Client().CreateOrUpdateTLSSecret("teresa", "teresa-tls", cert, key)
+	if errors.Cause(err) != ErrInvalidTLSKeyPair {
+		t.Errorf("got %v; want %v", err, ErrInvalidTLSKeyPair)
+	}
+	if err != nil && !strings.Contains(err.Error(), "private key does not match public key") {
+		t.Errorf("got %q; want the key pair parse error", err)
+	}
+}
+
+func TestValidateDeploySpec(t *testing.T) {
+	newDeploy := func(containers ...*spec.Container) *spec.Deploy {
+		return &spec.Deploy{Pod: spec.Pod{Name: "teresa", Containers: containers}}
+	}
+	var testCases = []struct {
+		deploySpec *spec.Deploy
+		problems   []string
+	}{
+		{
+			newDeploy(&spec.Container{
+				Name:              "teresa",
+				Image:             "luizalabs/teresa:0.0.1",
+				Env:               map[string]string{"PORT": "5000"},
+				Secrets:           []string{"PASSWORD"},
+				ContainerLimits:   &spec.ContainerLimits{CPU: "500m", Memory: "512Mi"},
+				ContainerRequests: &spec.ContainerLimits{CPU: "100m"},
+			}),
+			nil,
+		},
+		{
+			newDeploy(&spec.Container{Name: "teresa"}),
+			[]string{"container teresa: empty image"},
+		},
+		{
+			newDeploy(
+				&spec.Container{
+					Name:            "teresa",
+					Image:           "luizalabs/teresa:0.0.1",
+					ContainerLimits: &spec.ContainerLimits{CPU: "lots"},
+				},
+				&spec.Container{
+					Name:    "nginx",
+					Env:     map[string]string{"PASSWORD": "s3cr3t"},
+					Secrets: []string{"PASSWORD"},
+				},
+			),
+			[]string{
+				"container teresa",
+				"container nginx: empty image",
+				"container nginx: duplicate env key PASSWORD",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		err := new(Client).ValidateDeploySpec(tc.deploySpec)
+		if len(tc.problems) == 0 {
+			if err != nil {
+				t.Errorf("got unexpected error: %v", err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("expected error; got nil")
+			continue
+		}
+		for _, p := range tc.problems {
+			if !strings.Contains(err.Error(), p) {
+				t.Errorf("got %q; want it to contain %q", err, p)
+			}
+		}
+	}
+}
+
+// newDeployEnvPatchHandler keeps the deploy, merging the env of the patches
+// it receives by name, as the API server strategic merge does
+func newDeployEnvPatchHandler(d *k8s_extensions.Deployment) func(w http.ResponseWriter, r *fakeRequest) {
+	return newDiscoveryHandler(func(w http.ResponseWriter, r *fakeRequest) {
+		if r.Method == http.MethodPatch {
+			patch := new(k8s_extensions.Deployment)
+			if err := json.Unmarshal(r.Body, patch); err != nil {
+				writeStatus(w, http.StatusBadRequest, metav1.StatusReasonBadRequest)
+				return
+			}
+			c := &d.Spec.Template.Spec.Containers[0]
+			for _, pe := range patch.Spec.Template.Spec.Containers[0].Env {
+				found := false
+				for i := range c.Env {
+					if c.Env[i].Name == pe.Name {
+						c.Env[i], found = pe, true
+					}
+				}
+				if !found {
+					c.Env = append(c.Env, pe)
+				}
+			}
+		}
+		writeJSON(w, http.StatusOK, d)
+	}, extensionsV1beta1GroupVersion)
+}
+
+func TestAddDeployEnvVars(t *testing.T) {
+	d := &k8s_extensions.Deployment{}
+	d.Spec.Template.Spec.Containers = []k8sv1.Container{
+		{Name: "app", Env: []k8sv1.EnvVar{{Name: "PORT", Value: "5000"}}},
+	}
+	srv := newFakeAPIServer(newDeployEnvPatchHandler(d))
+	defer srv.Close()
+
+	cli := srv.Client()
+	if err := cli.AddDeployEnvVars("teresa", "app", []*app.EnvVar{{Key: "FOO", Value: "foo"}}); err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+	evs := []*app.EnvVar{{Key: "BAR", Value: "bar"}, {Key: "PORT", Value: "8080"}}
+	if err := cli.AddDeployEnvVars("teresa", "app", evs); err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+
+	expected := map[string]string{"PORT": "5000", "FOO": "foo", "BAR": "bar"}
+	env := d.Spec.Template.Spec.Containers[0].Env
+	if len(env) != len(expected) {
+		t.Fatalf("got %v; want %v", env, expected)
+	}
+	for _, e := range env {
+		if expected[e.Name] != e.Value {
+			t.Errorf("got %s=%s; want %s=%s", e.Name, e.Value, e.Name, expected[e.Name])
+		}
+	}
+
+	for _, req := range srv.Requests {
+		if req.Method == http.MethodPatch && strings.Contains(string(req.Body), `"PORT"`) {
+			t.Errorf("got patch overwriting PORT: %s", req.Body)
+		}
+	}
+}
+
+func TestUpdateDeployEnvVar(t *testing.T) {
+	d := &k8s_extensions.Deployment{}
+	d.Spec.Template.Spec.Containers = []k8sv1.Container{
+		{Name: "app", Env: []k8sv1.EnvVar{
+			{Name: "PORT", Value: "5000"},
+			{Name: "DEBUG", Value: "false"},
+		}},
+	}
+	srv := newFakeAPIServer(newDeployEnvPatchHandler(d))
+	defer srv.Close()
+
+	if err := srv.Client().UpdateDeployEnvVar("teresa", "app", "DEBUG", "true"); err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+
+	expected := map[string]string{"PORT": "5000", "DEBUG": "true"}
+	env := d.Spec.Template.Spec.Containers[0].Env
+	if len(env) != len(expected) {
+		t.Fatalf("got %v; want %v", env, expected)
+	}
+	for _, e := range env {
+		if expected[e.Name] != e.Value {
+			t.Errorf("got %s=%s; want %s=%s", e.Name, e.Value, e.Name, expected[e.Name])
+		}
+	}
+
+	body := string(srv.Requests[0].Body)
+	if strings.Contains(body, `"PORT"`) {
+		t.Errorf("got patch overwriting PORT: %s", body)
+	}
+	if !strings.Contains(body, "update env var DEBUG") {
+		t.Errorf("got %s; want the change cause", body)
+	}
+}
+
+func TestCronJobLatestLogs(t *testing.T) {
+	controller := true
+	newJob := func(name string, start time.Time) k8sbatch.Job {
+		job := k8sbatch.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: name,
+				OwnerReferences: []metav1.OwnerReference{
+					{Kind: "CronJob", Name: "cron", Controller: &controller},
+				},
+			},
+		}
+		job.Status.StartTime = &metav1.Time{Time: start}
+		return job
+	}
+	newPod := func(name string, created time.Time) k8sv1.Pod {
+		return k8sv1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			CreationTimestamp: metav1.Time{Time: created},
+		}}
+	}
+	start := time.Date(2017, 10, 1, 12, 0, 0, 0, time.UTC)
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		switch {
+		case strings.HasSuffix(r.Path, "/jobs"):
+			writeJSON(w, http.StatusOK, &k8sbatch.JobList{
+				Items: []k8sbatch.Job{
+					newJob("cron-1", start),
+					newJob("cron-2", start.Add(time.Hour)),
+				},
+			})
+		case strings.HasSuffix(r.Path, "/pods"):
+			writeJSON(w, http.StatusOK, &k8sv1.PodList{
+				Items: []k8sv1.Pod{
+					newPod("cron-2-abcde", start.Add(time.Hour)),
+					newPod("cron-2-fghij", start.Add(time.Hour+time.Minute)),
+				},
+			})
+		case strings.HasSuffix(r.Path, "/log"):
+			fmt.Fprintln(w, "done")
+		}
+	})
+	defer srv.Close()
+
+	rc, err := srv.Client().CronJobLatestLogs("teresa", "cron", &app.LogOptions{})
+	if err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+	defer rc.Close()
+
+	q, _ := url.ParseQuery(srv.Requests[1].Query)
+	if selector := q.Get("labelSelector"); selector != "job-name=cron-2" {
+		t.Errorf("got %s; want job-name=cron-2", selector)
+	}
+	if wantPath := "/api/v1/namespaces/teresa/pods/cron-2-fghij/log"; srv.Requests[2].Path != wantPath {
+		t.Errorf("got %s; want %s", srv.Requests[2].Path, wantPath)
+	}
+	b, err := ioutil.ReadAll(rc)
+	if err != nil {
+		t.Fatal("error reading logs:", err)
+	}
+	if string(b) != "done\n" {
+		t.Errorf("got %q; want %q", string(b), "done\n")
+	}
+}
+
+func TestCronJobLatestLogsNeverRan(t *testing.T) {
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		writeJSON(w, http.StatusOK, &k8sbatch.JobList{})
+	})
+	defer srv.Close()
+
+	if _, err := srv.Client().CronJobLatestLogs("teresa", "cron", &app.LogOptions{}); err != ErrCronJobNeverRan {
+		t.Errorf("got %v; want %v", err, ErrCronJobNeverRan)
+	}
+}
+
+func TestWaitPodEndWhileRestarting(t *testing.T) {
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		writeJSON(w, http.StatusOK, &k8sv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "run", Namespace: "teresa"},
+			Status: k8sv1.PodStatus{
+				Phase: k8sv1.PodRunning,
+				ContainerStatuses: []k8sv1.ContainerStatus{{
+					Name:         "app",
+					RestartCount: 1,
+					State: k8sv1.ContainerState{
+						Waiting: &k8sv1.ContainerStateWaiting{Reason: "CrashLoopBackOff"},
+					},
+					LastTerminationState: k8sv1.ContainerState{
+						Terminated: &k8sv1.ContainerStateTerminated{ExitCode: 2},
+					},
+				}},
+			},
+		})
+	})
+	defer srv.Close()
+
+	pod := &k8sv1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "run", Namespace: "teresa"}}
+	err := srv.Client().waitPodEnd(pod, time.Millisecond, 50*time.Millisecond)
+	if err != wait.ErrWaitTimeout {
+		t.Errorf("got %v; want %v", err, wait.ErrWaitTimeout)
+	}
+}
+
+func TestPodExitCodeOfContainer(t *testing.T) {
+	terminated := func(name string, exitCode int32) k8sv1.ContainerStatus {
+		return k8sv1.ContainerStatus{
+			Name: name,
+			State: k8sv1.ContainerState{
+				Terminated: &k8sv1.ContainerStateTerminated{ExitCode: exitCode},
+			},
+		}
+	}
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		writeJSON(w, http.StatusOK, &k8sv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "run", Namespace: "teresa"},
+			Status: k8sv1.PodStatus{
+				ContainerStatuses: []k8sv1.ContainerStatus{
+					terminated("sidecar", 0),
+					terminated("app", 1),
+				},
+			},
+		})
+	})
+	defer srv.Close()
+
+	pod := &k8sv1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "run", Namespace: "teresa"}}
+	var testCases = []struct {
+		container string
+		expected  int
+	}{
+		{"app", 1},
+		{"sidecar", 0},
+		{"", 0},
+	}
+	for _, tc := range testCases {
+		exitCode, err := srv.Client().podExitCode(pod, tc.container)
+		if err != nil {
+			t.Fatal("got unexpected error:", err)
+		}
+		if exitCode != tc.expected {
+			t.Errorf("got %d; want %d", exitCode, tc.expected)
+		}
+	}
+
+	if _, err := srv.Client().podExitCode(pod, "missing"); err != ErrPodStillRunning {
+		t.Errorf("got %v; want %v", err, ErrPodStillRunning)
+	}
+}
+
+func TestWaitPodStartImagePullBackOff(t *testing.T) {
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		writeJSON(w, http.StatusOK, &k8sv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "run", Namespace: "teresa"},
+			Status: k8sv1.PodStatus{
+				Phase: k8sv1.PodPending,
+				ContainerStatuses: []k8sv1.ContainerStatus{{
+					Name: "app",
+					State: k8sv1.ContainerState{
+						Waiting: &k8sv1.ContainerStateWaiting{
+							Reason:  "ImagePullBackOff",
+							Message: `Back-off pulling image "luizalabs/missing:v1"`,
+						},
+					},
+				}},
+			},
+		})
+	})
+	defer srv.Close()
+
+	pod := &k8sv1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "run", Namespace: "teresa"}}
+	err := srv.Client().waitPodStart(pod, time.Millisecond, time.Second)
+	if errors.Cause(err) != ErrPodRunFailed {
+		t.Fatalf("got %v; want %v", err, ErrPodRunFailed)
+	}
+	for _, expected := range []string{"ImagePullBackOff", "luizalabs/missing:v1"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("got %q; want it to contain %q", err, expected)
+		}
+	}
+}
+
+func TestWaitPodStartFailed(t *testing.T) {
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		writeJSON(w, http.StatusOK, &k8sv1.Pod{
+			Status: k8sv1.PodStatus{
+				Phase: k8sv1.PodFailed,
+				InitContainerStatuses: []k8sv1.ContainerStatus{{
+					Name: "slugstore",
+					State: k8sv1.ContainerState{
+						Terminated: &k8sv1.ContainerStateTerminated{Reason: "Error", ExitCode: 2},
+					},
+				}},
+			},
+		})
+	})
+	defer srv.Close()
+
+	pod := &k8sv1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "run", Namespace: "teresa"}}
+	err := srv.Client().waitPodStart(pod, time.Millisecond, time.Second)
+	if errors.Cause(err) != ErrPodRunFailed {
+		t.Fatalf("got %v; want %v", err, ErrPodRunFailed)
+	}
+	if !strings.Contains(err.Error(), "slugstore") {
+		t.Errorf("got %q; want it to contain the failed container", err)
+	}
+}
+
+func TestDeployReplicas(t *testing.T) {
+	var replicas int32 = 5
+	srv := newFakeAPIServer(newDiscoveryHandler(func(w http.ResponseWriter, r *fakeRequest) {
+		d := &k8s_extensions.Deployment{}
+		d.Spec.Replicas = &replicas
+		d.Status.Replicas = 4
+		d.Status.AvailableReplicas = 3
+		writeJSON(w, http.StatusOK, d)
+	}, extensionsV1beta1GroupVersion))
+	defer srv.Close()
+
+	desired, available, err := srv.Client().DeployReplicas("teresa", "app")
+	if err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+	if wantPath := "/apis/extensions/v1beta1/namespaces/teresa/deployments/app"; srv.Requests[len(srv.Requests)-1].Path != wantPath {
+		t.Errorf("got %s; want %s", srv.Requests[len(srv.Requests)-1].Path, wantPath)
+	}
+	if desired != replicas {
+		t.Errorf("got %d; want %d", desired, replicas)
+	}
+	if available != 3 {
+		t.Errorf("got %d; want %d", available, 3)
+	}
+}
+
+func TestWaitForDeployRollout(t *testing.T) {
+	var replicas int32 = 3
+	gets := 0
+	srv := newFakeAPIServer(newDiscoveryHandler(func(w http.ResponseWriter, r *fakeRequest) {
+		gets++
+		d := &k8s_extensions.Deployment{}
+		d.Generation = 2
+		d.Spec.Replicas = &replicas
+		d.Status.ObservedGeneration = 1
+		if gets >= 2 {
+			d.Status.ObservedGeneration = 2
+			d.Status.Replicas = 4
+			d.Status.UpdatedReplicas = 2
+			d.Status.AvailableReplicas = 3
+		}
+		if gets >= 3 {
+			d.Status.Replicas = 3
+			d.Status.UpdatedReplicas = 3
+		}
+		writeJSON(w, http.StatusOK, d)
+	}, appsV1beta1GroupVersion, extensionsV1beta1GroupVersion))
+	defer srv.Close()
+
+	if err := srv.Client().waitForDeployRollout("teresa", "app", time.Millisecond, time.Second); err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+	if gets != 3 {
+		t.Errorf("got %d polls; want 3", gets)
+	}
+	last := srv.Requests[len(srv.Requests)-1]
+	if expected := "/apis/apps/v1beta1/namespaces/teresa/deployments/app"; last.Path != expected {
+		t.Errorf("got %s; want %s", last.Path, expected)
+	}
+}
+
+func TestWaitForDeployRolloutTimeout(t *testing.T) {
+	var replicas int32 = 3
+	srv := newFakeAPIServer(newDiscoveryHandler(func(w http.ResponseWriter, r *fakeRequest) {
+		d := &k8s_extensions.Deployment{}
+		d.Spec.Replicas = &replicas
+		d.Status.Replicas = 3
+		d.Status.UpdatedReplicas = 1
+		d.Status.AvailableReplicas = 2
+		writeJSON(w, http.StatusOK, d)
+	}, extensionsV1beta1GroupVersion))
+	defer srv.Close()
+
+	err := srv.Client().waitForDeployRollout("teresa", "app", time.Millisecond, 20*time.Millisecond)
+	if s, _ := status.FromError(err); s == nil || s.Code() != codes.DeadlineExceeded {
+		t.Errorf("got %v; want a %s error", err, codes.DeadlineExceeded)
+	}
+	if err != nil && !strings.Contains(err.Error(), "1 of 3 pods updated, 2 available") {
+		t.Errorf("got %q; want the pods count", err)
+	}
+	last := srv.Requests[len(srv.Requests)-1]
+	if expected := "/apis/extensions/v1beta1/namespaces/teresa/deployments/app"; last.Path != expected {
+		t.Errorf("got %s; want %s", last.Path, expected)
+	}
+}
+
+func TestWaitForDeployRolloutProgressDeadlineExceeded(t *testing.T) {
+	var replicas int32 = 3
+	srv := newFakeAPIServer(newDiscoveryHandler(func(w http.ResponseWriter, r *fakeRequest) {
+		d := &k8s_extensions.Deployment{}
+		d.Spec.Replicas = &replicas
+		d.Status.Replicas = 3
+		d.Status.UpdatedReplicas = 1
+		d.Status.Conditions = []k8s_extensions.DeploymentCondition{{
+			Type:    k8s_extensions.DeploymentProgressing,
+			Status:  k8sv1.ConditionFalse,
+			Reason:  "ProgressDeadlineExceeded",
+			Message: `ReplicaSet "app-123" has timed out progressing.`,
+		}}
+		writeJSON(w, http.StatusOK, d)
+	}, appsV1beta1GroupVersion))
+	defer srv.Close()
+
+	err := srv.Client().waitForDeployRollout("teresa", "app", time.Millisecond, time.Minute)
+	if s, _ := status.FromError(err); s == nil || s.Code() != codes.Aborted {
+		t.Errorf("got %v; want a %s error", err, codes.Aborted)
+	}
+	gets := 0
+	for _, req := range srv.Requests {
+		if strings.Contains(req.Path, "/deployments/") {
+			gets++
+		}
+	}
+	if gets != 1 {
+		t.Errorf("got %d polls; want 1", gets)
+	}
+}
+
+func TestDeployImage(t *testing.T) {
+	srv := newFakeAPIServer(newDiscoveryHandler(func(w http.ResponseWriter, r *fakeRequest) {
+		d := &k8s_extensions.Deployment{}
+		d.Spec.Template.Spec.Containers = []k8sv1.Container{
+			{Name: "app", Image: "luizalabs/app:v2"},
+			{Name: "nginx", Image: "nginx"},
+		}
+		writeJSON(w, http.StatusOK, d)
+	}, extensionsV1beta1GroupVersion))
+	defer srv.Close()
+
+	image, err := srv.Client().DeployImage("teresa", "app")
+	if err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+	if wantPath := "/apis/extensions/v1beta1/namespaces/teresa/deployments/app"; srv.Requests[len(srv.Requests)-1].Path != wantPath {
+		t.Errorf("got %s; want %s", srv.Requests[len(srv.Requests)-1].Path, wantPath)
+	}
+	if expected := "luizalabs/app:v2"; image != expected {
+		t.Errorf("got %s; want %s", image, expected)
+	}
+}
+
+func TestDeployAnnotations(t *testing.T) {
+	annotations := map[string]string{
+		"kubernetes.io/change-cause":        "update env vars",
+		"deployment.kubernetes.io/revision": "3",
+		"teresa.io/app-type":                "web",
+	}
+	srv := newFakeAPIServer(newDiscoveryHandler(func(w http.ResponseWriter, r *fakeRequest) {
+		d := &k8s_extensions.Deployment{}
+		d.Annotations = annotations
+		writeJSON(w, http.StatusOK, d)
+	}, appsV1beta1GroupVersion))
+	defer srv.Close()
+
+	actual, err := srv.Client().DeployAnnotations("teresa", "app")
+	if err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+	if wantPath := "/apis/apps/v1beta1/namespaces/teresa/deployments/app"; srv.Requests[len(srv.Requests)-1].Path != wantPath {
+		t.Errorf("got %s; want %s", srv.Requests[len(srv.Requests)-1].Path, wantPath)
+	}
+	if len(actual) != len(annotations) {
+		t.Errorf("got %d annotations; want %d", len(actual), len(annotations))
+	}
+	for key, value := range annotations {
+		if actual[key] != value {
+			t.Errorf("got %s; want %s", actual[key], value)
+		}
+	}
+}
+
+func TestDeployLastApplied(t *testing.T) {
+	conf := `{"apiVersion":"extensions/v1beta1","kind":"Deployment"}`
+	var testCases = []struct {
+		annotations map[string]string
+		expected    string
+		err         error
+	}{
+		{map[string]string{lastAppliedAnnotation: conf}, conf, nil},
+		{nil, "", ErrNoLastApplied},
+	}
+
+	for _, tc := range testCases {
+		srv := newFakeAPIServer(newDiscoveryHandler(func(w http.ResponseWriter, r *fakeRequest) {
+			d := &k8s_extensions.Deployment{}
+			d.Annotations = tc.annotations
+			writeJSON(w, http.StatusOK, d)
+		}, appsV1beta1GroupVersion))
+
+		actual, err := srv.Client().DeployLastApplied("teresa", "app")
+		srv.Close()
+		if err != tc.err {
+			t.Errorf("got %v; want %v", err, tc.err)
+		}
+		if string(actual) != tc.expected {
+			t.Errorf("got %s; want %s", actual, tc.expected)
+		}
+	}
+}
+
+func TestNewHPAV2alpha1(t *testing.T) {
+	a := &app.App{
+		Name:      "teresa",
+		Autoscale: &app.Autoscale{CPUTargetUtilization: 70, Min: 1, Max: 3},
+	}
+
+	hpa, err := newHPAV2alpha1(a)
+	if err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+
+	if hpa.Spec.MaxReplicas != a.Autoscale.Max {
+		t.Errorf("got %d; want %d", hpa.Spec.MaxReplicas, a.Autoscale.Max)
+	}
+	if *hpa.Spec.MinReplicas != a.Autoscale.Min {
+		t.Errorf("got %d; want %d", *hpa.Spec.MinReplicas, a.Autoscale.Min)
+	}
+	if len(hpa.Spec.Metrics) != 1 {
+		t.Fatalf("got %d metrics; want 1", len(hpa.Spec.Metrics))
+	}
+	m := hpa.Spec.Metrics[0]
+	if m.Type != asv2alpha1.ResourceMetricSourceType || m.Resource.Name != k8sv1.ResourceCPU {
+		t.Errorf("got %s %v; want cpu resource metric", m.Type, m.Resource)
+	}
+	if *m.Resource.TargetAverageUtilization != a.Autoscale.CPUTargetUtilization {
+		t.Errorf("got %d; want %d", *m.Resource.TargetAverageUtilization, a.Autoscale.CPUTargetUtilization)
+	}
+}
+
+func TestNewHPAV2alpha1WithCustomMetric(t *testing.T) {
+	a := &app.App{
+		Name:         "teresa",
+		Autoscale:    &app.Autoscale{Min: 1, Max: 3},
+		CustomMetric: &app.CustomMetric{Name: "queue_depth", TargetAverageValue: "100"},
+	}
+
+	hpa, err := newHPAV2alpha1(a)
+	if err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+	if len(hpa.Spec.Metrics) != 1 {
+		t.Fatalf("got %d metrics; want 1", len(hpa.Spec.Metrics))
+	}
+	m := hpa.Spec.Metrics[0]
+	if m.Type != asv2alpha1.PodsMetricSourceType {
+		t.Fatalf("got %s; want %s", m.Type, asv2alpha1.PodsMetricSourceType)
+	}
+	if m.Pods.MetricName != "queue_depth" {
+		t.Errorf("got %s; want queue_depth", m.Pods.MetricName)
+	}
+	if m.Pods.TargetAverageValue.String() != "100" {
+		t.Errorf("got %s; want 100", m.Pods.TargetAverageValue.String())
+	}
+}
+
+func TestNewHPAV2alpha1WithInvalidCustomMetric(t *testing.T) {
+	a := &app.App{
+		Name:         "teresa",
+		Autoscale:    &app.Autoscale{Min: 1, Max: 3},
+		CustomMetric: &app.CustomMetric{Name: "queue_depth", TargetAverageValue: "many"},
+	}
+
+	if _, err := newHPAV2alpha1(a); err == nil {
+		t.Error("expected error; got nil")
+	}
+}
+
+func TestCustomMetricRoundTrip(t *testing.T) {
+	a := &app.App{
+		Name:         "teresa",
+		Autoscale:    &app.Autoscale{CPUTargetUtilization: 70, Min: 1, Max: 3},
+		CustomMetric: &app.CustomMetric{Name: "queue_depth", TargetAverageValue: "500m"},
+	}
+	hpa, err := newHPAV2alpha1(a)
+	if err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+
+	srv := newFakeAPIServer(newDiscoveryHandler(func(w http.ResponseWriter, r *fakeRequest) {
+		writeJSON(w, http.StatusOK, hpa)
+	}, autoscalingV1GroupVersion, autoscalingV2alpha1GroupVersion))
+	defer srv.Close()
+
+	cm, err := srv.Client().CustomMetric("teresa")
+	if err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+	if cm == nil || *cm != *a.CustomMetric {
+		t.Errorf("got %+v; want %+v", cm, a.CustomMetric)
+	}
+}
+
+func TestHasAutoscale(t *testing.T) {
+	var testCases = []struct {
+		found    bool
+		expected bool
+	}{
+		{true, true},
+		{false, false},
+	}
+
+	for _, tc := range testCases {
+		srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+			if !tc.found {
+				writeStatus(w, http.StatusNotFound, metav1.StatusReasonNotFound)
+				return
+			}
+			writeJSON(w, http.StatusOK, &asv1.HorizontalPodAutoscaler{
+				ObjectMeta: metav1.ObjectMeta{Name: "teresa", Namespace: "teresa"},
+				Spec:       asv1.HorizontalPodAutoscalerSpec{MaxReplicas: 3},
+			})
+		})
+
+		actual, err := srv.Client().HasAutoscale("teresa")
+		srv.Close()
+		if err != nil {
+			t.Fatal("got unexpected error:", err)
+		}
+		if actual != tc.expected {
+			t.Errorf("got %v; want %v", actual, tc.expected)
+		}
+	}
+}
+
+func TestDeleteAutoscale(t *testing.T) {
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		writeStatus(w, http.StatusOK, "")
+	})
+	defer srv.Close()
+
+	if err := srv.Client().DeleteAutoscale("teresa"); err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+
+	req := srv.Requests[0]
+	if req.Method != http.MethodDelete {
+		t.Errorf("got %s; want %s", req.Method, http.MethodDelete)
+	}
+	wantPath := "/apis/autoscaling/v1/namespaces/teresa/horizontalpodautoscalers/teresa"
+	if req.Path != wantPath {
+		t.Errorf("got %s; want %s", req.Path, wantPath)
+	}
+}
+
+func TestDeleteAutoscaleNotFound(t *testing.T) {
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		writeStatus(w, http.StatusNotFound, metav1.StatusReasonNotFound)
+	})
+	defer srv.Close()
+
+	if err := srv.Client().DeleteAutoscale("teresa"); err != nil {
+		t.Error("got unexpected error:", err)
+	}
+}
+
+func newRunningPod(name string) k8sv1.Pod {
+	return k8sv1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "teresa"},
+		Status:     k8sv1.PodStatus{Phase: k8sv1.PodRunning},
+	}
+}
+
+func TestAppLogs(t *testing.T) {
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		if strings.HasSuffix(r.Path, "/log") {
+			podName := strings.Split(r.Path, "/")[6]
+			fmt.Fprintf(w, "hello from %s\n", podName)
+			return
+		}
+		writeJSON(w, http.StatusOK, &k8sv1.PodList{
+			Items: []k8sv1.Pod{newRunningPod("teresa-1"), newRunningPod("teresa-2")},
+		})
+	})
+	defer srv.Close()
+
+	rc, err := srv.Client().AppLogs("teresa", &app.LogOptions{})
+	if err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+	defer rc.Close()
+
+	q, _ := url.ParseQuery(srv.Requests[0].Query)
+	if selector := q.Get("labelSelector"); selector != "run=teresa" {
+		t.Errorf("got %s; want run=teresa", selector)
+	}
+
+	b, err := ioutil.ReadAll(rc)
+	if err != nil {
+		t.Fatal("error reading logs:", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	sort.Strings(lines)
+	expected := []string{"[teresa-1] hello from teresa-1", "[teresa-2] hello from teresa-2"}
+	if strings.Join(lines, ",") != strings.Join(expected, ",") {
+		t.Errorf("got %v; want %v", lines, expected)
+	}
+}
+
+func TestAppLogsFollowPicksNewPods(t *testing.T) {
+	var lists int
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		if strings.HasSuffix(r.Path, "/log") {
+			podName := strings.Split(r.Path, "/")[6]
+			fmt.Fprintf(w, "hello from %s\n", podName)
+			return
+		}
+		items := []k8sv1.Pod{newRunningPod("teresa-1")}
+		if lists > 0 {
+			items = append(items, newRunningPod("teresa-2"))
+		}
+		lists++
+		writeJSON(w, http.StatusOK, &k8sv1.PodList{Items: items})
+	})
+	defer srv.Close()
+
+	rc, err := srv.Client().appLogs("teresa", &app.LogOptions{Follow: true}, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+	defer rc.Close()
+
+	seen := make(map[string]bool)
+	lines := make(chan string)
+	go func() {
+		br := bufio.NewReader(rc)
+		for {
+			line, err := br.ReadString('\n')
+			if err != nil {
+				close(lines)
+				return
+			}
+			lines <- strings.TrimSpace(line)
+		}
+	}()
+	timeout := time.After(5 * time.Second)
+	for len(seen) < 2 {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatalf("stream closed early; got %v", seen)
+			}
+			if seen[line] {
+				t.Errorf("got duplicated line %s", line)
+			}
+			seen[line] = true
+		case <-timeout:
+			t.Fatalf("timeout waiting for new pod logs; got %v", seen)
+		}
+	}
+	if !seen["[teresa-2] hello from teresa-2"] {
+		t.Errorf("got %v; want the logs of teresa-2", seen)
+	}
+}
+
+func TestPodLogsBySelector(t *testing.T) {
+	created := time.Date(2017, 10, 1, 12, 0, 0, 0, time.UTC)
+	newPod := func(name string, created time.Time) k8sv1.Pod {
+		return k8sv1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			CreationTimestamp: metav1.Time{Time: created},
+		}}
+	}
+	srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+		if strings.HasSuffix(r.Path, "/log") {
+			fmt.Fprintln(w, "newest")
+			return
+		}
+		writeJSON(w, http.StatusOK, &k8sv1.PodList{
+			Items: []k8sv1.Pod{
+				newPod("worker-2", created.Add(time.Minute)),
+				newPod("worker-1", created),
+			},
+		})
+	})
+	defer srv.Close()
+
+	rc, err := srv.Client().PodLogsBySelector("teresa", "run=worker", &app.LogOptions{})
+	if err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+	defer rc.Close()
+
+	q, _ := url.ParseQuery(srv.Requests[0].Query)
+	if selector := q.Get("labelSelector"); selector != "run=worker" {
+		t.Errorf("got %s; want run=worker", selector)
+	}
+	if wantPath := "/api/v1/namespaces/teresa/pods/worker-2/log"; srv.Requests[1].Path != wantPath {
+		t.Errorf("got %s; want %s", srv.Requests[1].Path, wantPath)
+	}
+}
+
+func TestPodLogsBySelectorErrors(t *testing.T) {
+	created := metav1.Time{Time: time.Date(2017, 10, 1, 12, 0, 0, 0, time.UTC)}
+	var testCases = []struct {
+		pods []k8sv1.Pod
+		err  error
+	}{
+		{nil, ErrNotFound},
+		{
+			[]k8sv1.Pod{
+				{ObjectMeta: metav1.ObjectMeta{Name: "worker-1", CreationTimestamp: created}},
+				{ObjectMeta: metav1.ObjectMeta{Name: "worker-2", CreationTimestamp: created}},
+			},
+			ErrAmbiguousPodSelector,
+		},
+	}
+
+	for _, tc := range testCases {
+		srv := newFakeAPIServer(func(w http.ResponseWriter, r *fakeRequest) {
+			writeJSON(w, http.StatusOK, &k8sv1.PodList{Items: tc.pods})
+		})
+		_, err := srv.Client().PodLogsBySelector("teresa", "run=worker", &app.LogOptions{})
+		srv.Close()
+		if err != tc.err {
+			t.Errorf("got %v; want %v", err, tc.err)
+		}
+	}
+}
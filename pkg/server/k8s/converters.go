@@ -2,14 +2,18 @@ package k8s
 
 import (
 	"fmt"
+	"net"
 	"strconv"
+	"strings"
 
 	"github.com/luizalabs/teresa/pkg/server/app"
 	"github.com/luizalabs/teresa/pkg/server/service"
 	"github.com/luizalabs/teresa/pkg/server/spec"
+	"github.com/pkg/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation"
 	k8sv1 "k8s.io/client-go/pkg/api/v1"
 	"k8s.io/client-go/pkg/apis/apps/v1beta1"
 	k8sbatch "k8s.io/client-go/pkg/apis/batch/v1"
@@ -21,6 +25,12 @@ const (
 	changeCauseAnnotation = "kubernetes.io/change-cause"
 	appTypeAnnotation     = "teresa.io/app-type"
 	defaultServicePort    = 80
+	hostnameTopologyKey   = "kubernetes.io/hostname"
+	zoneLabel             = "failure-domain.beta.kubernetes.io/zone"
+	regionLabel           = "failure-domain.beta.kubernetes.io/region"
+	instanceTypeLabel     = "beta.kubernetes.io/instance-type"
+
+	defaultRevisionHistoryLimit = 10
 )
 
 func podSpecToK8sContainers(podSpec *spec.Pod) ([]k8sv1.Container, error) {
@@ -36,21 +46,17 @@ func containerSpecsToK8sContainers(containerSpecs []*spec.Container) ([]k8sv1.Co
 			Image:           cs.Image,
 		}
 
-		if cs.ContainerLimits != nil {
-			cpu, err := resource.ParseQuantity(cs.ContainerLimits.CPU)
-			if err != nil {
-				return nil, err
-			}
-			memory, err := resource.ParseQuantity(cs.ContainerLimits.Memory)
-			if err != nil {
-				return nil, err
-			}
-			c.Resources = k8sv1.ResourceRequirements{
-				Limits: k8sv1.ResourceList{
-					k8sv1.ResourceCPU:    cpu,
-					k8sv1.ResourceMemory: memory,
-				},
-			}
+		limits, err := containerLimitsToK8sResourceList(cs.ContainerLimits)
+		if err != nil {
+			return nil, err
+		}
+		requests, err := containerLimitsToK8sResourceList(cs.ContainerRequests)
+		if err != nil {
+			return nil, err
+		}
+		c.Resources = k8sv1.ResourceRequirements{
+			Limits:   limits,
+			Requests: requests,
 		}
 
 		if len(cs.Command) > 0 {
@@ -92,6 +98,59 @@ func containerSpecsToK8sContainers(containerSpecs []*spec.Container) ([]k8sv1.Co
 	return containers, nil
 }
 
+// containerLimitsToK8sResourceList leaves the empty resources out, they
+// fall back to the namespace defaults
+func containerLimitsToK8sResourceList(cl *spec.ContainerLimits) (k8sv1.ResourceList, error) {
+	if cl == nil {
+		return nil, nil
+	}
+	rl := k8sv1.ResourceList{}
+	if cl.CPU != "" {
+		cpu, err := resource.ParseQuantity(cl.CPU)
+		if err != nil {
+			return nil, err
+		}
+		rl[k8sv1.ResourceCPU] = cpu
+	}
+	if cl.Memory != "" {
+		memory, err := resource.ParseQuantity(cl.Memory)
+		if err != nil {
+			return nil, err
+		}
+		rl[k8sv1.ResourceMemory] = memory
+	}
+	return rl, nil
+}
+
+// appContainer returns the container named after the app, falling back to
+// the first one
+func appContainer(containers []k8sv1.Container, name string) *k8sv1.Container {
+	for i := range containers {
+		if containers[i].Name == name {
+			return &containers[i]
+		}
+	}
+	if len(containers) > 0 {
+		return &containers[0]
+	}
+	return nil
+}
+
+// k8sEnvToEnvVars splits the container env in literal values and the names
+// of the ones read from the app secrets, which values are left out
+func k8sEnvToEnvVars(env []k8sv1.EnvVar) ([]*app.EnvVar, []string) {
+	evs := make([]*app.EnvVar, 0)
+	secrets := make([]string, 0)
+	for _, e := range env {
+		if e.ValueFrom == nil {
+			evs = append(evs, &app.EnvVar{Key: e.Name, Value: e.Value})
+		} else if e.ValueFrom.SecretKeyRef != nil {
+			secrets = append(secrets, e.Name)
+		}
+	}
+	return evs, secrets
+}
+
 func podSpecVolumesToK8sVolumes(vols []*spec.Volume) []k8sv1.Volume {
 	volumes := make([]k8sv1.Volume, 0)
 	for _, v := range vols {
@@ -111,6 +170,115 @@ func podSpecVolumesToK8sVolumes(vols []*spec.Volume) []k8sv1.Volume {
 	return volumes
 }
 
+func keyToPathToK8sKeyToPath(items []*spec.KeyToPath) []k8sv1.KeyToPath {
+	if len(items) == 0 {
+		return nil
+	}
+	k8sItems := make([]k8sv1.KeyToPath, len(items))
+	for i, item := range items {
+		k8sItems[i] = k8sv1.KeyToPath{Key: item.Key, Path: item.Path}
+	}
+	return k8sItems
+}
+
+// volumeName turns an object name into a valid volume name, dots are not
+// allowed and the length is limited
+func volumeName(prefix, name string) string {
+	n := prefix + strings.Replace(name, ".", "-", -1)
+	if len(n) > validation.DNS1123LabelMaxLength {
+		n = strings.TrimRight(n[:validation.DNS1123LabelMaxLength], "-")
+	}
+	return n
+}
+
+// secretVolumesToK8sVolumes shares a volume between the mounts of the same
+// secret items, mounting other items of it needs another volume
+func secretVolumesToK8sVolumes(svs []spec.SecretVolume) ([]k8sv1.Volume, []k8sv1.VolumeMount) {
+	volumes := make([]k8sv1.Volume, 0)
+	mounts := make([]k8sv1.VolumeMount, len(svs))
+	names := make(map[string]string)
+	used := make(map[string]bool)
+	for i, sv := range svs {
+		items := keyToPathToK8sKeyToPath(sv.Items)
+		key := fmt.Sprintf("%s%v", sv.SecretName, items)
+		name, ok := names[key]
+		if !ok {
+			base := volumeName("secret-", sv.SecretName)
+			name = base
+			for n := 1; used[name]; n++ {
+				name = fmt.Sprintf("%s-%d", base, n)
+			}
+			names[key] = name
+			used[name] = true
+			volumes = append(volumes, k8sv1.Volume{
+				Name: name,
+				VolumeSource: k8sv1.VolumeSource{
+					Secret: &k8sv1.SecretVolumeSource{
+						SecretName: sv.SecretName,
+						Items:      items,
+					},
+				},
+			})
+		}
+		mounts[i] = k8sv1.VolumeMount{
+			Name:      name,
+			MountPath: sv.MountPath,
+			ReadOnly:  true,
+		}
+	}
+	return volumes, mounts
+}
+
+func configMapVolumesToK8sVolumes(cvs []spec.ConfigMapVolume) ([]k8sv1.Volume, []k8sv1.VolumeMount) {
+	volumes := make([]k8sv1.Volume, 0)
+	mounts := make([]k8sv1.VolumeMount, len(cvs))
+	seen := make(map[string]bool)
+	for i, cv := range cvs {
+		name := volumeName("configmap-", cv.ConfigMapName)
+		if !seen[name] {
+			seen[name] = true
+			vol := k8sv1.Volume{Name: name}
+			vol.ConfigMap = &k8sv1.ConfigMapVolumeSource{}
+			vol.ConfigMap.Name = cv.ConfigMapName
+			volumes = append(volumes, vol)
+		}
+		mounts[i] = k8sv1.VolumeMount{
+			Name:      name,
+			MountPath: cv.MountPath,
+			SubPath:   cv.SubPath,
+			ReadOnly:  true,
+		}
+	}
+	return volumes, mounts
+}
+
+// emptyDirVolumesToK8sVolumes also mounts the volumes on the given containers
+func emptyDirVolumesToK8sVolumes(evs []spec.EmptyDirVolume, containers []k8sv1.Container) []k8sv1.Volume {
+	volumes := make([]k8sv1.Volume, len(evs))
+	for i, ev := range evs {
+		volumes[i] = k8sv1.Volume{
+			Name: ev.Name,
+			VolumeSource: k8sv1.VolumeSource{
+				EmptyDir: &k8sv1.EmptyDirVolumeSource{},
+			},
+		}
+		if ev.Memory {
+			volumes[i].EmptyDir.Medium = k8sv1.StorageMediumMemory
+		}
+		for j := range containers {
+			mountPath, ok := ev.MountPaths[containers[j].Name]
+			if !ok {
+				continue
+			}
+			containers[j].VolumeMounts = append(containers[j].VolumeMounts, k8sv1.VolumeMount{
+				Name:      ev.Name,
+				MountPath: mountPath,
+			})
+		}
+	}
+	return volumes
+}
+
 func podSpecToK8sPod(podSpec *spec.Pod) (*k8sv1.Pod, error) {
 	containers, err := podSpecToK8sContainers(podSpec)
 	if err != nil {
@@ -119,13 +287,24 @@ func podSpecToK8sPod(podSpec *spec.Pod) (*k8sv1.Pod, error) {
 	volumes := podSpecVolumesToK8sVolumes(podSpec.Volumes)
 	f := false
 
+	if len(containers) > 0 {
+		if err := setPodResources(&containers[0], podSpec); err != nil {
+			return nil, err
+		}
+	}
+
 	initContainers, err := podSpecToK8sInitContainers(podSpec)
 	if err != nil {
 		return nil, err
 	}
 
+	restartPolicy, err := podRestartPolicy(podSpec.RestartPolicy)
+	if err != nil {
+		return nil, err
+	}
+
 	ps := k8sv1.PodSpec{
-		RestartPolicy: k8sv1.RestartPolicyNever,
+		RestartPolicy: restartPolicy,
 		Containers:    containers,
 		Volumes:       volumes,
 		AutomountServiceAccountToken: &f,
@@ -143,6 +322,35 @@ func podSpecToK8sPod(podSpec *spec.Pod) (*k8sv1.Pod, error) {
 	return pod, nil
 }
 
+// podRestartPolicy refuses Always, the pod would never end
+func podRestartPolicy(policy string) (k8sv1.RestartPolicy, error) {
+	switch k8sv1.RestartPolicy(policy) {
+	case "", k8sv1.RestartPolicyNever:
+		return k8sv1.RestartPolicyNever, nil
+	case k8sv1.RestartPolicyOnFailure:
+		return k8sv1.RestartPolicyOnFailure, nil
+	}
+	return "", errors.Wrapf(ErrInvalidRestartPolicy, "%q", policy)
+}
+
+func setPodResources(c *k8sv1.Container, podSpec *spec.Pod) error {
+	if c.Resources.Limits == nil {
+		limits, err := containerLimitsToK8sResourceList(podSpec.Limits)
+		if err != nil {
+			return err
+		}
+		c.Resources.Limits = limits
+	}
+	if c.Resources.Requests == nil {
+		requests, err := containerLimitsToK8sResourceList(podSpec.Requests)
+		if err != nil {
+			return err
+		}
+		c.Resources.Requests = requests
+	}
+	return nil
+}
+
 func deploySpecToK8sDeploy(deploySpec *spec.Deploy, replicas int32) (*v1beta1.Deployment, error) {
 	containers, err := podSpecToK8sContainers(&deploySpec.Pod)
 	if err != nil {
@@ -150,12 +358,17 @@ func deploySpecToK8sDeploy(deploySpec *spec.Deploy, replicas int32) (*v1beta1.De
 	}
 	volumes := podSpecVolumesToK8sVolumes(deploySpec.Volumes)
 
+	port := int32(spec.DefaultPort)
+	if deploySpec.ContainerPort > 0 {
+		port = deploySpec.ContainerPort
+	}
+
 	if deploySpec.HealthCheck != nil {
 		if deploySpec.HealthCheck.Liveness != nil {
-			containers[0].LivenessProbe = healthCheckProbeToK8sProbe(deploySpec.HealthCheck.Liveness)
+			containers[0].LivenessProbe = healthCheckProbeToK8sProbe(deploySpec.HealthCheck.Liveness, port)
 		}
 		if deploySpec.HealthCheck.Readiness != nil {
-			containers[0].ReadinessProbe = healthCheckProbeToK8sProbe(deploySpec.HealthCheck.Readiness)
+			containers[0].ReadinessProbe = healthCheckProbeToK8sProbe(deploySpec.HealthCheck.Readiness, port)
 		}
 	}
 
@@ -163,6 +376,24 @@ func deploySpecToK8sDeploy(deploySpec *spec.Deploy, replicas int32) (*v1beta1.De
 		containers[0].Lifecycle = lifecycleToK8sLifecycle(deploySpec.Lifecycle)
 	}
 
+	if len(deploySpec.SecretVolumes) > 0 {
+		vols, mounts := secretVolumesToK8sVolumes(deploySpec.SecretVolumes)
+		volumes = append(volumes, vols...)
+		containers[0].VolumeMounts = append(containers[0].VolumeMounts, mounts...)
+	}
+
+	if len(deploySpec.ConfigMapVolumes) > 0 {
+		vols, mounts := configMapVolumesToK8sVolumes(deploySpec.ConfigMapVolumes)
+		volumes = append(volumes, vols...)
+		containers[0].VolumeMounts = append(containers[0].VolumeMounts, mounts...)
+	}
+
+	volumes = append(volumes, emptyDirVolumesToK8sVolumes(deploySpec.EmptyDirVolumes, containers)...)
+
+	if !deploySpec.DisableStandardEnvVars && len(containers) > 0 {
+		addStandardEnvVars(&containers[0], deploySpec)
+	}
+
 	f := false
 	initContainers, err := podSpecToK8sInitContainers(&deploySpec.Pod)
 	if err != nil {
@@ -175,14 +406,28 @@ func deploySpecToK8sDeploy(deploySpec *spec.Deploy, replicas int32) (*v1beta1.De
 		AutomountServiceAccountToken: &f,
 		InitContainers:               initContainers,
 	}
+	ps.TerminationGracePeriodSeconds = deploySpec.TerminationGracePeriodSeconds
+	ps.NodeSelector = deploySpec.NodeSelector
+	ps.Affinity = deploySpecToK8sAffinity(deploySpec)
+	ps.Tolerations = tolerationsToK8sTolerations(deploySpec.Tolerations)
+	ps.ImagePullSecrets = imagePullSecretsToK8sLocalObjectReferences(deploySpec.ImagePullSecrets)
 
 	var maxSurge, maxUnavailable *intstr.IntOrString
 	if deploySpec.RollingUpdate != nil {
 		vMaxSurge, vMaxUnavailable := rollingUpdateToK8sRollingUpdate(deploySpec.RollingUpdate)
-		maxSurge, maxUnavailable = &vMaxSurge, &vMaxUnavailable
+		// an empty value keeps the cluster default
+		if deploySpec.RollingUpdate.MaxSurge != "" {
+			maxSurge = &vMaxSurge
+		}
+		if deploySpec.RollingUpdate.MaxUnavailable != "" {
+			maxUnavailable = &vMaxUnavailable
+		}
 	}
 
-	rhl := int32(deploySpec.RevisionHistoryLimit)
+	rhl := int32(defaultRevisionHistoryLimit)
+	if deploySpec.RevisionHistoryLimit != nil {
+		rhl = *deploySpec.RevisionHistoryLimit
+	}
 	d := &v1beta1.Deployment{
 		TypeMeta: metav1.TypeMeta{
 			APIVersion: "extensions/v1beta1",
@@ -213,6 +458,7 @@ func deploySpecToK8sDeploy(deploySpec *spec.Deploy, replicas int32) (*v1beta1.De
 				Spec: ps,
 			},
 			RevisionHistoryLimit: &rhl,
+			MinReadySeconds:      deploySpec.MinReadySeconds,
 		},
 	}
 	return d, nil
@@ -260,7 +506,9 @@ func cronJobSpecToK8sCronJob(cronJobSpec *spec.CronJob) (*k8sv2alpha.CronJob, er
 			},
 		},
 		Spec: k8sv2alpha.CronJobSpec{
-			Schedule: cronJobSpec.Schedule,
+			Schedule:                cronJobSpec.Schedule,
+			ConcurrencyPolicy:       k8sv2alpha.ConcurrencyPolicy(cronJobSpec.ConcurrencyPolicy),
+			StartingDeadlineSeconds: cronJobSpec.StartingDeadlineSeconds,
 			JobTemplate: k8sv2alpha.JobTemplateSpec{
 				Spec: k8sbatch.JobSpec{
 					Template: k8sv1.PodTemplateSpec{
@@ -275,6 +523,17 @@ func cronJobSpecToK8sCronJob(cronJobSpec *spec.CronJob) (*k8sv2alpha.CronJob, er
 	return cj, nil
 }
 
+func imagePullSecretsToK8sLocalObjectReferences(secrets []string) []k8sv1.LocalObjectReference {
+	if len(secrets) == 0 {
+		return nil
+	}
+	refs := make([]k8sv1.LocalObjectReference, len(secrets))
+	for i, name := range secrets {
+		refs[i] = k8sv1.LocalObjectReference{Name: name}
+	}
+	return refs
+}
+
 func rollingUpdateToK8sRollingUpdate(ru *spec.RollingUpdate) (maxSurge, maxUnavailable intstr.IntOrString) {
 	conv := func(value string) intstr.IntOrString {
 		v, err := strconv.Atoi(value)
@@ -286,7 +545,7 @@ func rollingUpdateToK8sRollingUpdate(ru *spec.RollingUpdate) (maxSurge, maxUnava
 	return conv(ru.MaxSurge), conv(ru.MaxUnavailable)
 }
 
-func healthCheckProbeToK8sProbe(probe *spec.HealthCheckProbe) *k8sv1.Probe {
+func healthCheckProbeToK8sProbe(probe *spec.HealthCheckProbe, port int32) *k8sv1.Probe {
 	return &k8sv1.Probe{
 		InitialDelaySeconds: probe.InitialDelaySeconds,
 		TimeoutSeconds:      probe.TimeoutSeconds,
@@ -295,30 +554,96 @@ func healthCheckProbeToK8sProbe(probe *spec.HealthCheckProbe) *k8sv1.Probe {
 		SuccessThreshold:    probe.SuccessThreshold,
 		Handler: k8sv1.Handler{
 			HTTPGet: &k8sv1.HTTPGetAction{
-				Port: intstr.FromInt(spec.DefaultPort),
+				Port: intstr.FromInt(int(port)),
 				Path: probe.Path,
 			},
 		},
 	}
 }
 
+func deploySpecToK8sAffinity(deploySpec *spec.Deploy) *k8sv1.Affinity {
+	if len(deploySpec.NodeAffinity) == 0 && !deploySpec.SpreadAcrossNodes {
+		return nil
+	}
+	aff := new(k8sv1.Affinity)
+	if len(deploySpec.NodeAffinity) > 0 {
+		aff.NodeAffinity = nodeAffinityToK8sNodeAffinity(deploySpec.NodeAffinity)
+	}
+	if deploySpec.SpreadAcrossNodes {
+		aff.PodAntiAffinity = spreadAcrossNodesPodAntiAffinity(deploySpec.Name)
+	}
+	return aff
+}
+
+func spreadAcrossNodesPodAntiAffinity(name string) *k8sv1.PodAntiAffinity {
+	return &k8sv1.PodAntiAffinity{
+		PreferredDuringSchedulingIgnoredDuringExecution: []k8sv1.WeightedPodAffinityTerm{
+			{
+				Weight: 100,
+				PodAffinityTerm: k8sv1.PodAffinityTerm{
+					LabelSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{"run": name},
+					},
+					TopologyKey: hostnameTopologyKey,
+				},
+			},
+		},
+	}
+}
+
+func nodeAffinityToK8sNodeAffinity(reqs []*spec.NodeSelectorRequirement) *k8sv1.NodeAffinity {
+	exprs := make([]k8sv1.NodeSelectorRequirement, len(reqs))
+	for i, r := range reqs {
+		exprs[i] = k8sv1.NodeSelectorRequirement{
+			Key:      r.Key,
+			Operator: k8sv1.NodeSelectorOperator(r.Operator),
+			Values:   r.Values,
+		}
+	}
+	return &k8sv1.NodeAffinity{
+		RequiredDuringSchedulingIgnoredDuringExecution: &k8sv1.NodeSelector{
+			NodeSelectorTerms: []k8sv1.NodeSelectorTerm{
+				{MatchExpressions: exprs},
+			},
+		},
+	}
+}
+
+func tolerationsToK8sTolerations(tols []app.Toleration) []k8sv1.Toleration {
+	if len(tols) == 0 {
+		return nil
+	}
+	k8sTols := make([]k8sv1.Toleration, len(tols))
+	for i, t := range tols {
+		k8sTols[i] = k8sv1.Toleration{
+			Key:      t.Key,
+			Operator: k8sv1.TolerationOperator(t.Operator),
+			Value:    t.Value,
+			Effect:   k8sv1.TaintEffect(t.Effect),
+		}
+	}
+	return k8sTols
+}
+
 func lifecycleToK8sLifecycle(lc *spec.Lifecycle) *k8sv1.Lifecycle {
 	k8sLc := new(k8sv1.Lifecycle)
 
 	if lc.PreStop != nil {
+		cmd := lc.PreStop.Command
+		if len(cmd) == 0 {
+			cmd = []string{"/bin/sleep", strconv.Itoa(lc.PreStop.DrainTimeoutSeconds)}
+		}
 		k8sLc.PreStop = &k8sv1.Handler{
-			Exec: &k8sv1.ExecAction{
-				Command: []string{"/bin/sleep", strconv.Itoa(lc.PreStop.DrainTimeoutSeconds)},
-			},
+			Exec: &k8sv1.ExecAction{Command: cmd},
 		}
 	}
 
 	return k8sLc
 }
 
-func serviceSpec(namespace, name, srvType string) *k8sv1.Service {
+func serviceSpec(namespace, name, srvType string, opts *service.ServiceOptions) *k8sv1.Service {
 	serviceType := k8sv1.ServiceType(srvType)
-	return &k8sv1.Service{
+	svc := &k8sv1.Service{
 		TypeMeta: metav1.TypeMeta{
 			APIVersion: "v1",
 			Kind:       "Service",
@@ -345,6 +670,136 @@ func serviceSpec(namespace, name, srvType string) *k8sv1.Service {
 			},
 		},
 	}
+	if opts == nil {
+		return svc
+	}
+	if opts.TargetPort > 0 {
+		svc.Spec.Ports[0].TargetPort = intstr.FromInt(int(opts.TargetPort))
+	}
+	if len(opts.Ports) > 0 {
+		svc.Spec.Ports = servicePortsToK8sServicePorts(opts.Ports)
+	}
+	if opts.ExternalTrafficLocal {
+		svc.Spec.ExternalTrafficPolicy = k8sv1.ServiceExternalTrafficPolicyTypeLocal
+	}
+	svc.Spec.LoadBalancerSourceRanges = opts.SourceRanges
+	if opts.Headless {
+		svc.Spec.Type = k8sv1.ServiceTypeClusterIP
+		svc.Spec.ClusterIP = k8sv1.ClusterIPNone
+		svc.Spec.ExternalTrafficPolicy = ""
+		svc.Spec.LoadBalancerSourceRanges = nil
+	}
+	return svc
+}
+
+func k8sServicePortsToServicePorts(k8sPorts []k8sv1.ServicePort) []*service.ServicePort {
+	ports := make([]*service.ServicePort, len(k8sPorts))
+	for i := range k8sPorts {
+		ports[i] = &service.ServicePort{
+			Port:       int(k8sPorts[i].Port),
+			Name:       k8sPorts[i].Name,
+			TargetPort: int(k8sPorts[i].TargetPort.IntVal),
+			Protocol:   string(k8sPorts[i].Protocol),
+		}
+	}
+	return ports
+}
+
+// validateTargetPorts skips the check when no container declares its ports
+func validateTargetPorts(ports []service.ServicePort, containers []k8sv1.Container) error {
+	exposed := make(map[int]bool)
+	for _, c := range containers {
+		for _, p := range c.Ports {
+			exposed[int(p.ContainerPort)] = true
+		}
+	}
+	if len(exposed) == 0 {
+		return nil
+	}
+	for _, p := range ports {
+		if !exposed[p.TargetPort] {
+			return errors.Wrapf(ErrInvalidTargetPort, "%d", p.TargetPort)
+		}
+	}
+	return nil
+}
+
+// addStandardEnvVars sets the app name, team and namespace env vars on the
+// container, unless they are already set
+func addStandardEnvVars(c *k8sv1.Container, deploySpec *spec.Deploy) {
+	set := make(map[string]bool)
+	for _, e := range c.Env {
+		set[e.Name] = true
+	}
+	std := []k8sv1.EnvVar{
+		{Name: "APP_NAME", Value: deploySpec.Name},
+		{Name: "TEAM", Value: deploySpec.Team},
+		{
+			Name: "NAMESPACE",
+			ValueFrom: &k8sv1.EnvVarSource{
+				FieldRef: &k8sv1.ObjectFieldSelector{FieldPath: "metadata.namespace"},
+			},
+		},
+	}
+	for _, e := range std {
+		if !set[e.Name] {
+			c.Env = append(c.Env, e)
+		}
+	}
+}
+
+func validateContainerSpec(cs *spec.Container) []error {
+	var errs []error
+	if cs.Image == "" {
+		errs = append(errs, fmt.Errorf("container %s: empty image", cs.Name))
+	}
+	for _, cl := range []*spec.ContainerLimits{cs.ContainerLimits, cs.ContainerRequests} {
+		if _, err := containerLimitsToK8sResourceList(cl); err != nil {
+			errs = append(errs, errors.Wrapf(err, "container %s", cs.Name))
+		}
+	}
+	for _, secret := range cs.Secrets {
+		if _, found := cs.Env[secret]; found {
+			errs = append(errs, fmt.Errorf("container %s: duplicate env key %s", cs.Name, secret))
+		}
+	}
+	return errs
+}
+
+// validateServicePortNames checks the names k8s requires once the service
+// has more than one port
+func validateServicePortNames(names []string) error {
+	if len(names) < 2 {
+		return nil
+	}
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if name == "" || seen[name] {
+			return errors.Wrapf(ErrInvalidServicePorts, "%q", name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+func validateServicePortProtocols(ports []service.ServicePort) error {
+	for _, p := range ports {
+		switch p.Protocol {
+		case "", service.ProtocolTCP, service.ProtocolUDP:
+		default:
+			return errors.Wrapf(ErrInvalidServiceProtocol, "%q", p.Protocol)
+		}
+	}
+	return nil
+}
+
+func validateSourceRanges(ranges []string) error {
+	for _, r := range ranges {
+		if _, _, err := net.ParseCIDR(r); err != nil {
+			return errors.Wrapf(ErrInvalidSourceRange, "%q", r)
+		}
+	}
+	return nil
 }
 
 func ingressSpec(namespace, name, vHost string) *k8s_extensions.Ingress {
@@ -390,6 +845,65 @@ func appPodListOptsToK8s(opts *app.PodListOptions) *metav1.ListOptions {
 	return &k8sOpts
 }
 
+// isPodOwnedBy checks the pod controller, empty kind or name match any
+func isPodOwnedBy(pod *k8sv1.Pod, kind, name string) bool {
+	return isControlledBy(pod.OwnerReferences, kind, name)
+}
+
+func isControlledBy(refs []metav1.OwnerReference, kind, name string) bool {
+	if kind == "" && name == "" {
+		return true
+	}
+	for _, ref := range refs {
+		if ref.Controller == nil || !*ref.Controller {
+			continue
+		}
+		return (kind == "" || ref.Kind == kind) && (name == "" || ref.Name == name)
+	}
+	return false
+}
+
+func k8sJobToJobRun(job *k8sbatch.Job) *spec.JobRun {
+	run := &spec.JobRun{Name: job.Name, Status: spec.JobRunRunning}
+	if job.Status.StartTime != nil {
+		t := job.Status.StartTime.Time
+		run.StartTime = &t
+	}
+	if job.Status.CompletionTime != nil {
+		t := job.Status.CompletionTime.Time
+		run.CompletionTime = &t
+	}
+	for _, c := range job.Status.Conditions {
+		if c.Status != k8sv1.ConditionTrue {
+			continue
+		}
+		switch c.Type {
+		case k8sbatch.JobComplete:
+			run.Status = spec.JobRunSucceeded
+		case k8sbatch.JobFailed:
+			run.Status = spec.JobRunFailed
+		}
+	}
+	return run
+}
+
+func appLogOptsToK8s(opts *app.LogOptions) *k8sv1.PodLogOptions {
+	k8sOpts := &k8sv1.PodLogOptions{
+		Follow:       opts.Follow,
+		TailLines:    &opts.Lines,
+		Previous:     opts.Previous,
+		Container:    opts.Container,
+		SinceSeconds: opts.SinceSeconds,
+		Timestamps:   opts.Timestamps,
+		LimitBytes:   opts.LimitBytes,
+	}
+	if opts.SinceTime != nil {
+		t := metav1.NewTime(*opts.SinceTime)
+		k8sOpts.SinceTime = &t
+	}
+	return k8sOpts
+}
+
 func configMapSpec(namespace, name string, data map[string]string) *k8sv1.ConfigMap {
 	return &k8sv1.ConfigMap{
 		TypeMeta: metav1.TypeMeta{
@@ -411,11 +925,23 @@ func servicePortsToK8sServicePorts(ports []service.ServicePort) []k8sv1.ServiceP
 		if p == 0 {
 			p = defaultServicePort
 		}
+		tp := ports[i].TargetPort
+		if tp == 0 {
+			tp = spec.DefaultPort
+		}
 		k8sPorts[i] = k8sv1.ServicePort{
 			Name:       ports[i].Name,
 			Port:       int32(p),
-			TargetPort: intstr.FromInt(ports[i].TargetPort),
+			Protocol:   serviceProtocol(ports[i].Protocol),
+			TargetPort: intstr.FromInt(tp),
 		}
 	}
 	return k8sPorts
 }
+
+func serviceProtocol(protocol string) k8sv1.Protocol {
+	if protocol == "" {
+		return k8sv1.ProtocolTCP
+	}
+	return k8sv1.Protocol(protocol)
+}
@@ -1,15 +1,20 @@
 package k8s
 
 import (
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	k8sv1 "k8s.io/client-go/pkg/api/v1"
+	k8sv2alpha "k8s.io/client-go/pkg/apis/batch/v2alpha1"
 
 	"github.com/luizalabs/teresa/pkg/server/app"
 	"github.com/luizalabs/teresa/pkg/server/service"
 	"github.com/luizalabs/teresa/pkg/server/spec"
+	"github.com/pkg/errors"
 )
 
 func TestPodSpecToK8sContainers(t *testing.T) {
@@ -109,6 +114,57 @@ func TestPodSpecToK8sContainers(t *testing.T) {
 	}
 }
 
+func TestContainerSpecsToK8sContainersResourcesPerContainer(t *testing.T) {
+	cs := []*spec.Container{
+		{
+			Name:              "app",
+			ContainerLimits:   &spec.ContainerLimits{CPU: "1", Memory: "1Gi"},
+			ContainerRequests: &spec.ContainerLimits{CPU: "500m", Memory: "512Mi"},
+		},
+		{
+			Name:              "sidecar",
+			ContainerLimits:   &spec.ContainerLimits{Memory: "64Mi"},
+			ContainerRequests: &spec.ContainerLimits{CPU: "10m"},
+		},
+	}
+	containers, err := containerSpecsToK8sContainers(cs)
+	if err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+
+	var testCases = []struct {
+		resources k8sv1.ResourceList
+		expected  map[k8sv1.ResourceName]string
+	}{
+		{containers[0].Resources.Limits, map[k8sv1.ResourceName]string{k8sv1.ResourceCPU: "1", k8sv1.ResourceMemory: "1Gi"}},
+		{containers[0].Resources.Requests, map[k8sv1.ResourceName]string{k8sv1.ResourceCPU: "500m", k8sv1.ResourceMemory: "512Mi"}},
+		{containers[1].Resources.Limits, map[k8sv1.ResourceName]string{k8sv1.ResourceMemory: "64Mi"}},
+		{containers[1].Resources.Requests, map[k8sv1.ResourceName]string{k8sv1.ResourceCPU: "10m"}},
+	}
+	for _, tc := range testCases {
+		if len(tc.resources) != len(tc.expected) {
+			t.Errorf("got %v; want %v", tc.resources, tc.expected)
+			continue
+		}
+		for name, value := range tc.expected {
+			q := tc.resources[name]
+			if actual := q.String(); actual != value {
+				t.Errorf("got %s; want %s", actual, value)
+			}
+		}
+	}
+}
+
+func TestContainerSpecsToK8sContainersInvalidResources(t *testing.T) {
+	cs := []*spec.Container{{
+		Name:              "app",
+		ContainerRequests: &spec.ContainerLimits{CPU: "lots"},
+	}}
+	if _, err := containerSpecsToK8sContainers(cs); err == nil {
+		t.Error("expected error; got nil")
+	}
+}
+
 func TestPodSpecSecretVolumesToK8s(t *testing.T) {
 	vols := []*spec.Volume{
 		{Name: "Vol-Test", SecretName: "Bond"},
@@ -200,6 +256,85 @@ func TestPodSpecToK8sPod(t *testing.T) {
 	}
 }
 
+func TestPodSpecToK8sPodResources(t *testing.T) {
+	ps := &spec.Pod{
+		Containers: []*spec.Container{{
+			Name:  "Teresa",
+			Image: "luizalabs/teresa:0.0.1",
+		}},
+		Limits:   &spec.ContainerLimits{CPU: "500m", Memory: "512Mi"},
+		Requests: &spec.ContainerLimits{CPU: "100m", Memory: "256Mi"},
+	}
+	pod, err := podSpecToK8sPod(ps)
+	if err != nil {
+		t.Fatal("error converting spec:", err)
+	}
+
+	res := pod.Spec.Containers[0].Resources
+	cpu, mem := res.Limits[k8sv1.ResourceCPU], res.Limits[k8sv1.ResourceMemory]
+	if cpu.String() != "500m" || mem.String() != "512Mi" {
+		t.Errorf("got limits %s/%s; want 500m/512Mi", cpu.String(), mem.String())
+	}
+	cpu, mem = res.Requests[k8sv1.ResourceCPU], res.Requests[k8sv1.ResourceMemory]
+	if cpu.String() != "100m" || mem.String() != "256Mi" {
+		t.Errorf("got requests %s/%s; want 100m/256Mi", cpu.String(), mem.String())
+	}
+}
+
+func TestPodSpecToK8sPodContainerResourcesPrecedence(t *testing.T) {
+	ps := &spec.Pod{
+		Containers: []*spec.Container{{
+			Name:            "Teresa",
+			Image:           "luizalabs/teresa:0.0.1",
+			ContainerLimits: &spec.ContainerLimits{CPU: "1", Memory: "1Gi"},
+		}},
+		Limits: &spec.ContainerLimits{CPU: "500m", Memory: "512Mi"},
+	}
+	pod, err := podSpecToK8sPod(ps)
+	if err != nil {
+		t.Fatal("error converting spec:", err)
+	}
+
+	res := pod.Spec.Containers[0].Resources
+	if mem := res.Limits[k8sv1.ResourceMemory]; mem.String() != "1Gi" {
+		t.Errorf("got %s; want 1Gi", mem.String())
+	}
+	if res.Requests != nil {
+		t.Errorf("got %v; want the namespace defaults", res.Requests)
+	}
+}
+
+func TestPodSpecToK8sPodRestartPolicy(t *testing.T) {
+	var testCases = []struct {
+		policy   string
+		expected k8sv1.RestartPolicy
+		err      error
+	}{
+		{"", k8sv1.RestartPolicyNever, nil},
+		{"Never", k8sv1.RestartPolicyNever, nil},
+		{"OnFailure", k8sv1.RestartPolicyOnFailure, nil},
+		{"Always", "", ErrInvalidRestartPolicy},
+	}
+
+	for _, tc := range testCases {
+		ps := &spec.Pod{
+			Containers:    []*spec.Container{{Name: "Teresa", Image: "luizalabs/teresa:0.0.1"}},
+			RestartPolicy: tc.policy,
+		}
+		pod, err := podSpecToK8sPod(ps)
+		if errors.Cause(err) != tc.err {
+			t.Errorf("got %v; want %v", err, tc.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if pod.Spec.RestartPolicy != tc.expected {
+			t.Errorf("got %s; want %s", pod.Spec.RestartPolicy, tc.expected)
+		}
+	}
+}
+
 func TestRollingUpdateToK8sRollingUpdate(t *testing.T) {
 	ru := &spec.RollingUpdate{MaxSurge: "3", MaxUnavailable: "30%"}
 	maxSurge, maxUnavailable := rollingUpdateToK8sRollingUpdate(ru)
@@ -222,7 +357,7 @@ func TestHealthCheckProbeToK8sProbe(t *testing.T) {
 		TimeoutSeconds:      3,
 		Path:                "/hc/",
 	}
-	k8sHC := healthCheckProbeToK8sProbe(hc)
+	k8sHC := healthCheckProbeToK8sProbe(hc, spec.DefaultPort)
 
 	if k8sHC.InitialDelaySeconds != hc.InitialDelaySeconds {
 		t.Errorf("expected %d, got %d", hc.InitialDelaySeconds, k8sHC.InitialDelaySeconds)
@@ -242,6 +377,46 @@ func TestHealthCheckProbeToK8sProbe(t *testing.T) {
 	if k8sHC.Handler.HTTPGet.Path != hc.Path {
 		t.Errorf("expected %s, got %s", hc.Path, k8sHC.Handler.HTTPGet.Path)
 	}
+	if k8sHC.Handler.HTTPGet.Port.IntValue() != spec.DefaultPort {
+		t.Errorf("expected %d, got %d", spec.DefaultPort, k8sHC.Handler.HTTPGet.Port.IntValue())
+	}
+}
+
+func TestLifecycleToK8sLifecycle(t *testing.T) {
+	lc := &spec.Lifecycle{PreStop: &spec.PreStop{DrainTimeoutSeconds: 5}}
+	k8sLc := lifecycleToK8sLifecycle(lc)
+
+	if k8sLc.PreStop == nil || k8sLc.PreStop.Exec == nil {
+		t.Fatal("expected preStop exec hook; got nil")
+	}
+	want := "/bin/sleep 5"
+	if got := strings.Join(k8sLc.PreStop.Exec.Command, " "); got != want {
+		t.Errorf("got %s; want %s", got, want)
+	}
+}
+
+func TestLifecycleToK8sLifecycleWithCommand(t *testing.T) {
+	lc := &spec.Lifecycle{
+		PreStop: &spec.PreStop{Command: []string{"/bin/sh", "-c", "kill -QUIT 1"}},
+	}
+	k8sLc := lifecycleToK8sLifecycle(lc)
+
+	if k8sLc.PreStop == nil || k8sLc.PreStop.Exec == nil {
+		t.Fatal("expected preStop exec hook; got nil")
+	}
+	got := strings.Join(k8sLc.PreStop.Exec.Command, " ")
+	want := strings.Join(lc.PreStop.Command, " ")
+	if got != want {
+		t.Errorf("got %s; want %s", got, want)
+	}
+}
+
+func TestLifecycleToK8sLifecycleWithoutPreStop(t *testing.T) {
+	k8sLc := lifecycleToK8sLifecycle(&spec.Lifecycle{})
+
+	if k8sLc.PreStop != nil {
+		t.Errorf("got %v; want nil", k8sLc.PreStop)
+	}
 }
 
 func TestDeploySpecToK8sDeploy(t *testing.T) {
@@ -307,12 +482,569 @@ func TestDeploySpecToK8sDeploy(t *testing.T) {
 	}
 }
 
+func TestDeploySpecToK8sDeployStandardEnvVars(t *testing.T) {
+	ds := &spec.Deploy{
+		Pod: spec.Pod{
+			Name: "teresa",
+			Containers: []*spec.Container{{
+				Name:  "teresa",
+				Image: "luizalabs/teresa:0.0.1",
+				Env:   map[string]string{"TEAM": "custom"},
+			}},
+		},
+		Team: "luizalabs",
+	}
+
+	k8sDeploy, err := deploySpecToK8sDeploy(ds, 1)
+	if err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+	env := make(map[string]k8sv1.EnvVar)
+	for _, e := range k8sDeploy.Spec.Template.Spec.Containers[0].Env {
+		env[e.Name] = e
+	}
+	if actual := env["APP_NAME"].Value; actual != "teresa" {
+		t.Errorf("got %s; want %s", actual, "teresa")
+	}
+	if actual := env["TEAM"].Value; actual != "custom" {
+		t.Errorf("got %s; want %s", actual, "custom")
+	}
+	if vf := env["NAMESPACE"].ValueFrom; vf == nil || vf.FieldRef == nil || vf.FieldRef.FieldPath != "metadata.namespace" {
+		t.Errorf("got %v; want the namespace field ref", vf)
+	}
+
+	ds.DisableStandardEnvVars = true
+	k8sDeploy, err = deploySpecToK8sDeploy(ds, 1)
+	if err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+	if env := k8sDeploy.Spec.Template.Spec.Containers[0].Env; len(env) != 1 {
+		t.Errorf("got %v; want only the user env var", env)
+	}
+}
+
+func TestDeploySpecToK8sDeployRollingUpdate(t *testing.T) {
+	intOrStr := func(v intstr.IntOrString) *intstr.IntOrString { return &v }
+
+	var testCases = []struct {
+		rollingUpdate          *spec.RollingUpdate
+		expectedMaxSurge       *intstr.IntOrString
+		expectedMaxUnavailable *intstr.IntOrString
+	}{
+		{nil, nil, nil},
+		{
+			&spec.RollingUpdate{MaxSurge: "25%", MaxUnavailable: "10%"},
+			intOrStr(intstr.FromString("25%")),
+			intOrStr(intstr.FromString("10%")),
+		},
+		{
+			&spec.RollingUpdate{MaxSurge: "2", MaxUnavailable: "0"},
+			intOrStr(intstr.FromInt(2)),
+			intOrStr(intstr.FromInt(0)),
+		},
+		{
+			&spec.RollingUpdate{MaxSurge: "1"},
+			intOrStr(intstr.FromInt(1)),
+			nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		ds := &spec.Deploy{
+			TeresaYaml:      spec.TeresaYaml{RollingUpdate: tc.rollingUpdate},
+			MinReadySeconds: 15,
+		}
+		d, err := deploySpecToK8sDeploy(ds, 1)
+		if err != nil {
+			t.Fatal("error converting spec:", err)
+		}
+
+		ru := d.Spec.Strategy.RollingUpdate
+		if !reflect.DeepEqual(ru.MaxSurge, tc.expectedMaxSurge) {
+			t.Errorf("got max surge %v; want %v", ru.MaxSurge, tc.expectedMaxSurge)
+		}
+		if !reflect.DeepEqual(ru.MaxUnavailable, tc.expectedMaxUnavailable) {
+			t.Errorf("got max unavailable %v; want %v", ru.MaxUnavailable, tc.expectedMaxUnavailable)
+		}
+		if d.Spec.MinReadySeconds != ds.MinReadySeconds {
+			t.Errorf("got %d; want %d", d.Spec.MinReadySeconds, ds.MinReadySeconds)
+		}
+	}
+}
+
+func TestDeploySpecToK8sDeployRevisionHistoryLimit(t *testing.T) {
+	var limit int32 = 3
+
+	var testCases = []struct {
+		limit    *int32
+		expected int32
+	}{
+		{nil, defaultRevisionHistoryLimit},
+		{&limit, limit},
+	}
+
+	for _, tc := range testCases {
+		ds := &spec.Deploy{RevisionHistoryLimit: tc.limit}
+		d, err := deploySpecToK8sDeploy(ds, 1)
+		if err != nil {
+			t.Fatal("error converting spec:", err)
+		}
+		if got := *d.Spec.RevisionHistoryLimit; got != tc.expected {
+			t.Errorf("got %d; want %d", got, tc.expected)
+		}
+	}
+}
+
+func TestDeploySpecToK8sDeployContainerPort(t *testing.T) {
+	ds := &spec.Deploy{
+		Pod: spec.Pod{
+			Containers: []*spec.Container{{
+				Name:  "teresa",
+				Ports: []spec.Port{{Name: "app", ContainerPort: 8080}},
+			}},
+		},
+		TeresaYaml: spec.TeresaYaml{
+			HealthCheck: &spec.HealthCheck{
+				Readiness: &spec.HealthCheckProbe{Path: "/healthz"},
+			},
+		},
+		ContainerPort: 8080,
+	}
+
+	k8sDeploy, err := deploySpecToK8sDeploy(ds, 1)
+	if err != nil {
+		t.Fatal("error converting spec:", err)
+	}
+	c := k8sDeploy.Spec.Template.Spec.Containers[0]
+	if actual := c.Ports[0].ContainerPort; actual != ds.ContainerPort {
+		t.Errorf("got %d; want %d", actual, ds.ContainerPort)
+	}
+	if actual := c.ReadinessProbe.HTTPGet.Port.IntValue(); actual != int(ds.ContainerPort) {
+		t.Errorf("got %d; want %d", actual, ds.ContainerPort)
+	}
+
+	s := serviceSpec("teresa", "teresa", "ClusterIP", &service.ServiceOptions{TargetPort: ds.ContainerPort})
+	if actual := s.Spec.Ports[0].TargetPort.IntValue(); actual != int(ds.ContainerPort) {
+		t.Errorf("got %d; want %d", actual, ds.ContainerPort)
+	}
+}
+
+func TestDeploySpecToK8sDeployImagePullSecrets(t *testing.T) {
+	ds := &spec.Deploy{ImagePullSecrets: []string{"registry", "private-registry"}}
+
+	k8sDeploy, err := deploySpecToK8sDeploy(ds, 1)
+	if err != nil {
+		t.Fatal("error converting spec:", err)
+	}
+	secrets := k8sDeploy.Spec.Template.Spec.ImagePullSecrets
+	if len(secrets) != len(ds.ImagePullSecrets) {
+		t.Fatalf("got %d secrets; want %d", len(secrets), len(ds.ImagePullSecrets))
+	}
+	for i, name := range ds.ImagePullSecrets {
+		if secrets[i].Name != name {
+			t.Errorf("got %s; want %s", secrets[i].Name, name)
+		}
+	}
+
+	ds.ImagePullSecrets = nil
+	k8sDeploy, err = deploySpecToK8sDeploy(ds, 1)
+	if err != nil {
+		t.Fatal("error converting spec:", err)
+	}
+	if secrets := k8sDeploy.Spec.Template.Spec.ImagePullSecrets; secrets != nil {
+		t.Errorf("got %v; want nil", secrets)
+	}
+}
+
+func TestSecretVolumesToK8sVolumesSameSecret(t *testing.T) {
+	items := []*spec.KeyToPath{{Key: "tls.key", Path: "server.key"}}
+	svs := []spec.SecretVolume{
+		{SecretName: "tls.example.com", MountPath: "/etc/tls"},
+		{SecretName: "tls.example.com", MountPath: "/etc/nginx/tls"},
+		{SecretName: "tls.example.com", MountPath: "/etc/key", Items: items},
+	}
+
+	volumes, mounts := secretVolumesToK8sVolumes(svs)
+	if len(volumes) != 2 {
+		t.Fatalf("got %d volumes; want 2", len(volumes))
+	}
+	var expected = []string{"secret-tls-example-com", "secret-tls-example-com", "secret-tls-example-com-1"}
+	for i, name := range expected {
+		if mounts[i].Name != name {
+			t.Errorf("got %s; want %s", mounts[i].Name, name)
+		}
+	}
+	if volumes[1].Name != expected[2] || len(volumes[1].Secret.Items) != 1 {
+		t.Errorf("got %+v; want volume %s with the items", volumes[1], expected[2])
+	}
+}
+
+func TestDeploySpecToK8sDeploySecretVolumes(t *testing.T) {
+	ds := &spec.Deploy{
+		Pod: spec.Pod{
+			Containers: []*spec.Container{{
+				Name:  "Teresa",
+				Image: "luizalabs/teresa:0.0.1",
+			}},
+		},
+		SecretVolumes: []spec.SecretVolume{{
+			SecretName: "tls",
+			MountPath:  "/etc/tls",
+			Items:      []*spec.KeyToPath{{Key: "tls.key", Path: "server.key"}},
+		}},
+	}
+
+	k8sDeploy, err := deploySpecToK8sDeploy(ds, 1)
+	if err != nil {
+		t.Fatal("error converting spec:", err)
+	}
+
+	volumes := k8sDeploy.Spec.Template.Spec.Volumes
+	if len(volumes) != 1 {
+		t.Fatalf("got %d volumes; want 1", len(volumes))
+	}
+	v := volumes[0]
+	if v.Secret == nil || v.Secret.SecretName != "tls" {
+		t.Fatalf("got %+v; want secret volume tls", v.VolumeSource)
+	}
+	if len(v.Secret.Items) != 1 || v.Secret.Items[0].Key != "tls.key" || v.Secret.Items[0].Path != "server.key" {
+		t.Errorf("got %v; want tls.key on server.key", v.Secret.Items)
+	}
+
+	mounts := k8sDeploy.Spec.Template.Spec.Containers[0].VolumeMounts
+	if len(mounts) != 1 {
+		t.Fatalf("got %d volume mounts; want 1", len(mounts))
+	}
+	m := mounts[0]
+	if m.Name != v.Name || m.MountPath != "/etc/tls" || !m.ReadOnly {
+		t.Errorf("got %+v; want read only mount of %s on /etc/tls", m, v.Name)
+	}
+}
+
+func TestDeploySpecToK8sDeployConfigMapVolumes(t *testing.T) {
+	ds := &spec.Deploy{
+		Pod: spec.Pod{
+			Containers: []*spec.Container{{
+				Name:  "Teresa",
+				Image: "luizalabs/teresa:0.0.1",
+			}},
+		},
+		ConfigMapVolumes: []spec.ConfigMapVolume{
+			{ConfigMapName: "settings", MountPath: "/etc/settings"},
+			{ConfigMapName: "nginx", MountPath: "/etc/nginx/nginx.conf", SubPath: "nginx.conf"},
+			{ConfigMapName: "nginx", MountPath: "/etc/nginx/mime.types", SubPath: "mime.types"},
+		},
+	}
+
+	k8sDeploy, err := deploySpecToK8sDeploy(ds, 1)
+	if err != nil {
+		t.Fatal("error converting spec:", err)
+	}
+
+	volumes := k8sDeploy.Spec.Template.Spec.Volumes
+	if len(volumes) != 2 {
+		t.Fatalf("got %d volumes; want 2", len(volumes))
+	}
+	for i, name := range []string{"settings", "nginx"} {
+		if volumes[i].ConfigMap == nil || volumes[i].ConfigMap.Name != name {
+			t.Errorf("got %+v; want config map volume %s", volumes[i].VolumeSource, name)
+		}
+	}
+
+	mounts := k8sDeploy.Spec.Template.Spec.Containers[0].VolumeMounts
+	if len(mounts) != len(ds.ConfigMapVolumes) {
+		t.Fatalf("got %d volume mounts; want %d", len(mounts), len(ds.ConfigMapVolumes))
+	}
+	var expected = []struct {
+		volume, mountPath, subPath string
+	}{
+		{volumes[0].Name, "/etc/settings", ""},
+		{volumes[1].Name, "/etc/nginx/nginx.conf", "nginx.conf"},
+		{volumes[1].Name, "/etc/nginx/mime.types", "mime.types"},
+	}
+	for i, e := range expected {
+		m := mounts[i]
+		if m.Name != e.volume || m.MountPath != e.mountPath || m.SubPath != e.subPath {
+			t.Errorf("got %+v; want %+v", m, e)
+		}
+	}
+}
+
+func TestDeploySpecToK8sDeployEmptyDirVolumes(t *testing.T) {
+	ds := &spec.Deploy{
+		Pod: spec.Pod{
+			Containers: []*spec.Container{
+				{Name: "app", Image: "luizalabs/teresa:0.0.1"},
+				{Name: "shipper", Image: "luizalabs/shipper:0.0.1"},
+			},
+		},
+		EmptyDirVolumes: []spec.EmptyDirVolume{{
+			Name: "logs",
+			MountPaths: map[string]string{
+				"app":     "/var/log/app",
+				"shipper": "/logs",
+			},
+			Memory: true,
+		}},
+	}
+
+	k8sDeploy, err := deploySpecToK8sDeploy(ds, 1)
+	if err != nil {
+		t.Fatal("error converting spec:", err)
+	}
+
+	volumes := k8sDeploy.Spec.Template.Spec.Volumes
+	if len(volumes) != 1 {
+		t.Fatalf("got %d volumes; want 1", len(volumes))
+	}
+	v := volumes[0]
+	if v.Name != "logs" || v.EmptyDir == nil {
+		t.Fatalf("got %+v; want empty dir volume logs", v)
+	}
+	if v.EmptyDir.Medium != k8sv1.StorageMediumMemory {
+		t.Errorf("got %s; want %s", v.EmptyDir.Medium, k8sv1.StorageMediumMemory)
+	}
+
+	for _, c := range k8sDeploy.Spec.Template.Spec.Containers {
+		if len(c.VolumeMounts) != 1 {
+			t.Fatalf("got %d volume mounts on %s; want 1", len(c.VolumeMounts), c.Name)
+		}
+		m := c.VolumeMounts[0]
+		expected := ds.EmptyDirVolumes[0].MountPaths[c.Name]
+		if m.Name != "logs" || m.MountPath != expected {
+			t.Errorf("got %s on %s; want logs on %s", m.Name, m.MountPath, expected)
+		}
+	}
+}
+
+func TestDeploySpecToK8sDeployTerminationGracePeriod(t *testing.T) {
+	var grace int64 = 45
+	ds := &spec.Deploy{
+		Pod: spec.Pod{
+			Containers: []*spec.Container{{
+				Name:  "Teresa",
+				Image: "luizalabs/teresa:0.0.1",
+			}},
+		},
+		TerminationGracePeriodSeconds: &grace,
+	}
+
+	k8sDeploy, err := deploySpecToK8sDeploy(ds, 1)
+	if err != nil {
+		t.Fatal("error converting spec:", err)
+	}
+	got := k8sDeploy.Spec.Template.Spec.TerminationGracePeriodSeconds
+	if got == nil {
+		t.Fatal("got nil TerminationGracePeriodSeconds")
+	}
+	if *got != grace {
+		t.Errorf("got %d; want %d", *got, grace)
+	}
+
+	ds.TerminationGracePeriodSeconds = nil
+	k8sDeploy, err = deploySpecToK8sDeploy(ds, 1)
+	if err != nil {
+		t.Fatal("error converting spec:", err)
+	}
+	if got := k8sDeploy.Spec.Template.Spec.TerminationGracePeriodSeconds; got != nil {
+		t.Errorf("got %d; want nil", *got)
+	}
+}
+
+func TestDeploySpecToK8sDeployNodeSelector(t *testing.T) {
+	ds := &spec.Deploy{
+		Pod: spec.Pod{
+			Containers: []*spec.Container{{
+				Name:  "Teresa",
+				Image: "luizalabs/teresa:0.0.1",
+			}},
+		},
+		NodeSelector: map[string]string{"pool": "gpu"},
+		NodeAffinity: []*spec.NodeSelectorRequirement{
+			{Key: "lifecycle", Operator: "In", Values: []string{"spot", "preemptible"}},
+		},
+	}
+
+	k8sDeploy, err := deploySpecToK8sDeploy(ds, 1)
+	if err != nil {
+		t.Fatal("error converting spec:", err)
+	}
+	ps := k8sDeploy.Spec.Template.Spec
+
+	if ps.NodeSelector["pool"] != "gpu" {
+		t.Errorf("got %s; want gpu", ps.NodeSelector["pool"])
+	}
+
+	if ps.Affinity == nil || ps.Affinity.NodeAffinity == nil {
+		t.Fatal("expected node affinity; got nil")
+	}
+	terms := ps.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	if len(terms) != 1 || len(terms[0].MatchExpressions) != 1 {
+		t.Fatalf("got %v; want one term with one expression", terms)
+	}
+	expr := terms[0].MatchExpressions[0]
+	if expr.Key != "lifecycle" {
+		t.Errorf("got %s; want lifecycle", expr.Key)
+	}
+	if expr.Operator != k8sv1.NodeSelectorOpIn {
+		t.Errorf("got %s; want %s", expr.Operator, k8sv1.NodeSelectorOpIn)
+	}
+	if strings.Join(expr.Values, ",") != "spot,preemptible" {
+		t.Errorf("got %v; want [spot preemptible]", expr.Values)
+	}
+}
+
+func TestDeploySpecToK8sDeployWithoutNodeAffinity(t *testing.T) {
+	ds := &spec.Deploy{
+		Pod: spec.Pod{
+			Containers: []*spec.Container{{
+				Name:  "Teresa",
+				Image: "luizalabs/teresa:0.0.1",
+			}},
+		},
+	}
+
+	k8sDeploy, err := deploySpecToK8sDeploy(ds, 1)
+	if err != nil {
+		t.Fatal("error converting spec:", err)
+	}
+	if aff := k8sDeploy.Spec.Template.Spec.Affinity; aff != nil {
+		t.Errorf("got %v; want nil", aff)
+	}
+}
+
+func TestDeploySpecToK8sDeploySpreadAcrossNodes(t *testing.T) {
+	ds := &spec.Deploy{
+		Pod: spec.Pod{
+			Name: "teresa",
+			Containers: []*spec.Container{{
+				Name:  "Teresa",
+				Image: "luizalabs/teresa:0.0.1",
+			}},
+		},
+		SpreadAcrossNodes: true,
+	}
+
+	k8sDeploy, err := deploySpecToK8sDeploy(ds, 1)
+	if err != nil {
+		t.Fatal("error converting spec:", err)
+	}
+	aff := k8sDeploy.Spec.Template.Spec.Affinity
+	if aff == nil || aff.PodAntiAffinity == nil {
+		t.Fatal("expected pod anti-affinity; got nil")
+	}
+	if aff.NodeAffinity != nil {
+		t.Errorf("got %v; want nil", aff.NodeAffinity)
+	}
+	terms := aff.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution
+	if len(terms) != 1 {
+		t.Fatalf("got %d terms; want 1", len(terms))
+	}
+	term := terms[0].PodAffinityTerm
+	if term.TopologyKey != hostnameTopologyKey {
+		t.Errorf("got %s; want %s", term.TopologyKey, hostnameTopologyKey)
+	}
+	if term.LabelSelector.MatchLabels["run"] != ds.Name {
+		t.Errorf("got %s; want %s", term.LabelSelector.MatchLabels["run"], ds.Name)
+	}
+}
+
+func TestDeploySpecToK8sDeployTolerations(t *testing.T) {
+	ds := &spec.Deploy{
+		Pod: spec.Pod{
+			Containers: []*spec.Container{{
+				Name:  "Teresa",
+				Image: "luizalabs/teresa:0.0.1",
+			}},
+		},
+		Tolerations: []app.Toleration{
+			{Key: "spot", Operator: "Exists", Effect: "NoSchedule"},
+			{Key: "dedicated", Operator: "Equal", Value: "teresa", Effect: "NoExecute"},
+		},
+	}
+
+	k8sDeploy, err := deploySpecToK8sDeploy(ds, 1)
+	if err != nil {
+		t.Fatal("error converting spec:", err)
+	}
+	tols := k8sDeploy.Spec.Template.Spec.Tolerations
+	if len(tols) != len(ds.Tolerations) {
+		t.Fatalf("got %d tolerations; want %d", len(tols), len(ds.Tolerations))
+	}
+
+	if tols[0].Operator != k8sv1.TolerationOpExists {
+		t.Errorf("got %s; want %s", tols[0].Operator, k8sv1.TolerationOpExists)
+	}
+	if tols[0].Value != "" {
+		t.Errorf("got %s; want empty value", tols[0].Value)
+	}
+	if tols[0].Effect != k8sv1.TaintEffectNoSchedule {
+		t.Errorf("got %s; want %s", tols[0].Effect, k8sv1.TaintEffectNoSchedule)
+	}
+
+	if tols[1].Operator != k8sv1.TolerationOpEqual {
+		t.Errorf("got %s; want %s", tols[1].Operator, k8sv1.TolerationOpEqual)
+	}
+	if tols[1].Key != "dedicated" || tols[1].Value != "teresa" {
+		t.Errorf("got %s=%s; want dedicated=teresa", tols[1].Key, tols[1].Value)
+	}
+	if tols[1].Effect != k8sv1.TaintEffectNoExecute {
+		t.Errorf("got %s; want %s", tols[1].Effect, k8sv1.TaintEffectNoExecute)
+	}
+}
+
+func TestDeploySpecToK8sDeployMigrationInitContainer(t *testing.T) {
+	ds := &spec.Deploy{
+		Pod: spec.Pod{
+			Containers: []*spec.Container{{
+				Name:  "Teresa",
+				Image: "luizalabs/teresa:0.0.1",
+			}},
+			InitContainers: []*spec.Container{{
+				Name:    "migrate",
+				Image:   "luizalabs/teresa:0.0.1",
+				Command: []string{"python", "manage.py", "migrate"},
+				Env:     map[string]string{"DJANGO_SETTINGS_MODULE": "app.settings"},
+				Secrets: []string{"DATABASE_URL"},
+			}},
+		},
+	}
+
+	k8sDeploy, err := deploySpecToK8sDeploy(ds, 1)
+	if err != nil {
+		t.Fatal("error converting spec:", err)
+	}
+	initContainers := k8sDeploy.Spec.Template.Spec.InitContainers
+	if len(initContainers) != 1 {
+		t.Fatalf("got %d init containers; want 1", len(initContainers))
+	}
+	ic := initContainers[0]
+	if got := strings.Join(ic.Command, " "); got != "python manage.py migrate" {
+		t.Errorf("got %s; want python manage.py migrate", got)
+	}
+
+	env := make(map[string]k8sv1.EnvVar)
+	for _, e := range ic.Env {
+		env[e.Name] = e
+	}
+	if env["DJANGO_SETTINGS_MODULE"].Value != "app.settings" {
+		t.Errorf("got %s; want app.settings", env["DJANGO_SETTINGS_MODULE"].Value)
+	}
+	secret, found := env["DATABASE_URL"]
+	if !found || secret.ValueFrom == nil || secret.ValueFrom.SecretKeyRef == nil {
+		t.Fatal("expected env with secret key ref for DATABASE_URL")
+	}
+	if secret.ValueFrom.SecretKeyRef.Name != app.TeresaAppSecrets {
+		t.Errorf("got %s; want %s", secret.ValueFrom.SecretKeyRef.Name, app.TeresaAppSecrets)
+	}
+}
+
 func TestServiceSpec(t *testing.T) {
 	name := "teresa"
 	namespace := "teresa"
 	srvType := "LoadBalancer"
 
-	s := serviceSpec(namespace, name, srvType)
+	s := serviceSpec(namespace, name, srvType, nil)
 	if s.ObjectMeta.Name != name {
 		t.Errorf("expected %s, got %s", name, s.ObjectMeta.Name)
 	}
@@ -322,6 +1054,189 @@ func TestServiceSpec(t *testing.T) {
 	if s.Spec.Type != k8sv1.ServiceType(srvType) {
 		t.Errorf("expected %s, got %v", srvType, s.Spec.Type)
 	}
+	if s.Spec.ExternalTrafficPolicy != "" {
+		t.Errorf("got %s; want the cluster default", s.Spec.ExternalTrafficPolicy)
+	}
+}
+
+func TestServiceSpecExternalTrafficLocal(t *testing.T) {
+	opts := &service.ServiceOptions{ExternalTrafficLocal: true}
+
+	s := serviceSpec("teresa", "teresa", "LoadBalancer", opts)
+	if s.Spec.ExternalTrafficPolicy != k8sv1.ServiceExternalTrafficPolicyTypeLocal {
+		t.Errorf("got %s; want %s", s.Spec.ExternalTrafficPolicy, k8sv1.ServiceExternalTrafficPolicyTypeLocal)
+	}
+}
+
+func TestServiceSpecSourceRanges(t *testing.T) {
+	opts := &service.ServiceOptions{SourceRanges: []string{"10.0.0.0/8", "192.168.1.1/32"}}
+
+	s := serviceSpec("teresa", "teresa", "LoadBalancer", opts)
+	if strings.Join(s.Spec.LoadBalancerSourceRanges, ",") != strings.Join(opts.SourceRanges, ",") {
+		t.Errorf("got %v; want %v", s.Spec.LoadBalancerSourceRanges, opts.SourceRanges)
+	}
+}
+
+func TestServiceSpecTargetPort(t *testing.T) {
+	s := serviceSpec("teresa", "teresa", "LoadBalancer", &service.ServiceOptions{TargetPort: 8080})
+	if actual := s.Spec.Ports[0].TargetPort.IntValue(); actual != 8080 {
+		t.Errorf("got %d; want %d", actual, 8080)
+	}
+
+	s = serviceSpec("teresa", "teresa", "LoadBalancer", &service.ServiceOptions{})
+	if actual := s.Spec.Ports[0].TargetPort.IntValue(); actual != spec.DefaultPort {
+		t.Errorf("got %d; want %d", actual, spec.DefaultPort)
+	}
+}
+
+func TestServicePortsToK8sServicePortsProtocol(t *testing.T) {
+	ports := []service.ServicePort{
+		{Name: "tcp", TargetPort: 5000},
+		{Name: "dns", Port: 53, TargetPort: 5353, Protocol: service.ProtocolUDP},
+	}
+
+	k8sPorts := servicePortsToK8sServicePorts(ports)
+
+	if k8sPorts[0].Protocol != k8sv1.ProtocolTCP {
+		t.Errorf("got %s; want %s", k8sPorts[0].Protocol, k8sv1.ProtocolTCP)
+	}
+	if k8sPorts[1].Protocol != k8sv1.ProtocolUDP {
+		t.Errorf("got %s; want %s", k8sPorts[1].Protocol, k8sv1.ProtocolUDP)
+	}
+}
+
+func TestServiceSpecHeadless(t *testing.T) {
+	opts := &service.ServiceOptions{
+		Headless:             true,
+		ExternalTrafficLocal: true,
+		SourceRanges:         []string{"10.0.0.0/8"},
+	}
+
+	s := serviceSpec("teresa", "teresa", "LoadBalancer", opts)
+	if s.Spec.ClusterIP != k8sv1.ClusterIPNone {
+		t.Errorf("got %q; want %q", s.Spec.ClusterIP, k8sv1.ClusterIPNone)
+	}
+	if s.Spec.Type != k8sv1.ServiceTypeClusterIP {
+		t.Errorf("got %s; want %s", s.Spec.Type, k8sv1.ServiceTypeClusterIP)
+	}
+	if s.Spec.ExternalTrafficPolicy != "" || len(s.Spec.LoadBalancerSourceRanges) != 0 {
+		t.Errorf("got %+v; want no load balancer settings", s.Spec)
+	}
+}
+
+func TestServiceSpecPorts(t *testing.T) {
+	opts := &service.ServiceOptions{
+		Ports: []service.ServicePort{
+			{Name: "http", TargetPort: 8080},
+			{Name: "metrics", Port: 9090, TargetPort: 9090},
+		},
+	}
+
+	s := serviceSpec("teresa", "teresa", "LoadBalancer", opts)
+	if len(s.Spec.Ports) != 2 {
+		t.Fatalf("got %d ports; want 2", len(s.Spec.Ports))
+	}
+	var expected = []struct {
+		name       string
+		port       int32
+		targetPort int
+	}{
+		{"http", defaultServicePort, 8080},
+		{"metrics", 9090, 9090},
+	}
+	for i, e := range expected {
+		p := s.Spec.Ports[i]
+		if p.Name != e.name {
+			t.Errorf("got %s; want %s", p.Name, e.name)
+		}
+		if p.Port != e.port {
+			t.Errorf("got %d; want %d", p.Port, e.port)
+		}
+		if actual := p.TargetPort.IntValue(); actual != e.targetPort {
+			t.Errorf("got %d; want %d", actual, e.targetPort)
+		}
+	}
+}
+
+func TestValidateServicePortNames(t *testing.T) {
+	var testCases = []struct {
+		names []string
+		err   error
+	}{
+		{nil, nil},
+		{[]string{""}, nil},
+		{[]string{"http", "metrics"}, nil},
+		{[]string{"http", "http"}, ErrInvalidServicePorts},
+		{[]string{"http", ""}, ErrInvalidServicePorts},
+	}
+
+	for _, tc := range testCases {
+		if err := validateServicePortNames(tc.names); errors.Cause(err) != tc.err {
+			t.Errorf("got %v; want %v", err, tc.err)
+		}
+	}
+}
+
+func TestValidateServicePortProtocols(t *testing.T) {
+	var testCases = []struct {
+		protocol string
+		err      error
+	}{
+		{"", nil},
+		{service.ProtocolTCP, nil},
+		{service.ProtocolUDP, nil},
+		{"udp", ErrInvalidServiceProtocol},
+		{"SCTP", ErrInvalidServiceProtocol},
+	}
+
+	for _, tc := range testCases {
+		ports := []service.ServicePort{{Name: "tcp", Protocol: tc.protocol}}
+		if err := validateServicePortProtocols(ports); errors.Cause(err) != tc.err {
+			t.Errorf("got %v; want %v", err, tc.err)
+		}
+	}
+}
+
+func TestValidateSourceRanges(t *testing.T) {
+	var testCases = []struct {
+		ranges []string
+		err    error
+	}{
+		{nil, nil},
+		{[]string{"10.0.0.0/8", "2001:db8::/32"}, nil},
+		{[]string{"10.0.0.0/8", "10.0.0.1"}, ErrInvalidSourceRange},
+		{[]string{"10.0.0.0/33"}, ErrInvalidSourceRange},
+	}
+
+	for _, tc := range testCases {
+		if err := validateSourceRanges(tc.ranges); errors.Cause(err) != tc.err {
+			t.Errorf("got %v; want %v", err, tc.err)
+		}
+	}
+}
+
+func TestValidateTargetPorts(t *testing.T) {
+	containers := []k8sv1.Container{
+		{Name: "nginx", Ports: []k8sv1.ContainerPort{{ContainerPort: 5000}}},
+		{Name: "app", Ports: []k8sv1.ContainerPort{{ContainerPort: 6000}}},
+	}
+
+	var testCases = []struct {
+		ports      []service.ServicePort
+		containers []k8sv1.Container
+		err        error
+	}{
+		{[]service.ServicePort{{Port: 80, TargetPort: 5000}}, containers, nil},
+		{[]service.ServicePort{{Port: 80, TargetPort: 5000}, {Port: 443, TargetPort: 6000}}, containers, nil},
+		{[]service.ServicePort{{Port: 80, TargetPort: 5000}, {Port: 443, TargetPort: 8000}}, containers, ErrInvalidTargetPort},
+		{[]service.ServicePort{{Port: 80, TargetPort: 8000}}, []k8sv1.Container{{Name: "app"}}, nil},
+	}
+
+	for _, tc := range testCases {
+		if err := validateTargetPorts(tc.ports, tc.containers); errors.Cause(err) != tc.err {
+			t.Errorf("got %v; want %v", err, tc.err)
+		}
+	}
 }
 
 func TestIngressSpec(t *testing.T) {
@@ -399,6 +1314,67 @@ func TestAppPodListOptsToK8s(t *testing.T) {
 	}
 }
 
+func TestAppLogOptsToK8s(t *testing.T) {
+	var since int64 = 300
+	sinceTime := time.Date(2017, 10, 1, 12, 0, 0, 0, time.UTC)
+	opts := &app.LogOptions{
+		Lines:        10,
+		Follow:       true,
+		Container:    "nginx",
+		SinceSeconds: &since,
+		SinceTime:    &sinceTime,
+	}
+
+	k8sOpts := appLogOptsToK8s(opts)
+
+	if *k8sOpts.TailLines != opts.Lines {
+		t.Errorf("got %d; want %d", *k8sOpts.TailLines, opts.Lines)
+	}
+	if !k8sOpts.Follow {
+		t.Error("got false; want true")
+	}
+	if k8sOpts.Container != opts.Container {
+		t.Errorf("got %s; want %s", k8sOpts.Container, opts.Container)
+	}
+	if k8sOpts.SinceSeconds == nil || *k8sOpts.SinceSeconds != since {
+		t.Errorf("got %v; want %d", k8sOpts.SinceSeconds, since)
+	}
+	if k8sOpts.SinceTime == nil || !k8sOpts.SinceTime.Time.Equal(sinceTime) {
+		t.Errorf("got %v; want %v", k8sOpts.SinceTime, sinceTime)
+	}
+}
+
+func TestAppLogOptsToK8sLimitBytes(t *testing.T) {
+	var limit int64 = 4096
+	k8sOpts := appLogOptsToK8s(&app.LogOptions{Lines: 10, LimitBytes: &limit})
+
+	if k8sOpts.LimitBytes == nil || *k8sOpts.LimitBytes != limit {
+		t.Errorf("got %v; want %d", k8sOpts.LimitBytes, limit)
+	}
+}
+
+func TestAppLogOptsToK8sWithoutSince(t *testing.T) {
+	k8sOpts := appLogOptsToK8s(&app.LogOptions{Lines: 10})
+
+	if k8sOpts.SinceSeconds != nil {
+		t.Errorf("got %d; want nil", *k8sOpts.SinceSeconds)
+	}
+	if k8sOpts.SinceTime != nil {
+		t.Errorf("got %v; want nil", k8sOpts.SinceTime)
+	}
+	if k8sOpts.Timestamps {
+		t.Error("got true; want false")
+	}
+}
+
+func TestAppLogOptsToK8sTimestamps(t *testing.T) {
+	k8sOpts := appLogOptsToK8s(&app.LogOptions{Lines: 10, Timestamps: true})
+
+	if !k8sOpts.Timestamps {
+		t.Error("got false; want true")
+	}
+}
+
 func TestPodSpecToK8sInitContainers(t *testing.T) {
 	ps := &spec.Pod{
 		InitContainers: []*spec.Container{
@@ -482,6 +1458,50 @@ func TestCronJobSpecToK8sCronJob(t *testing.T) {
 	}
 }
 
+func TestCronJobSpecToK8sCronJobConcurrencyPolicy(t *testing.T) {
+	var testCases = []struct {
+		policy   string
+		expected k8sv2alpha.ConcurrencyPolicy
+	}{
+		{"", ""},
+		{"Forbid", k8sv2alpha.ForbidConcurrent},
+		{"Replace", k8sv2alpha.ReplaceConcurrent},
+	}
+
+	for _, tc := range testCases {
+		cs := &spec.CronJob{Schedule: "@hourly", ConcurrencyPolicy: tc.policy}
+		k8sCron, err := cronJobSpecToK8sCronJob(cs)
+		if err != nil {
+			t.Fatal("error converting spec:", err)
+		}
+		if actual := k8sCron.Spec.ConcurrencyPolicy; actual != tc.expected {
+			t.Errorf("got %s; want %s", actual, tc.expected)
+		}
+	}
+}
+
+func TestCronJobSpecToK8sCronJobStartingDeadlineSeconds(t *testing.T) {
+	var deadline int64 = 300
+	cs := &spec.CronJob{Schedule: "@hourly", StartingDeadlineSeconds: &deadline}
+
+	k8sCron, err := cronJobSpecToK8sCronJob(cs)
+	if err != nil {
+		t.Fatal("error converting spec:", err)
+	}
+	if actual := k8sCron.Spec.StartingDeadlineSeconds; actual == nil || *actual != deadline {
+		t.Errorf("got %v; want %d", actual, deadline)
+	}
+
+	cs.StartingDeadlineSeconds = nil
+	k8sCron, err = cronJobSpecToK8sCronJob(cs)
+	if err != nil {
+		t.Fatal("error converting spec:", err)
+	}
+	if actual := k8sCron.Spec.StartingDeadlineSeconds; actual != nil {
+		t.Errorf("got %d; want nil", *actual)
+	}
+}
+
 func TestConfigMapSpec(t *testing.T) {
 	name := "teresa"
 	namespace := "teresa"
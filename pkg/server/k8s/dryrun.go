@@ -0,0 +1,56 @@
+package k8s
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// WithDryRun returns a copy of the client that writes the objects and
+// patches it would apply to w, leaving the cluster untouched. The API
+// versions supported by teresa lack server side dry-run, so it's done here.
+// Methods without dry-run support fail instead of writing to the cluster
+func (k *Client) WithDryRun(w io.Writer) *Client {
+	c := *k
+	c.dryRun = w
+	if k.conf != nil {
+		conf := *k.conf
+		wrap := conf.WrapTransport
+		conf.WrapTransport = func(rt http.RoundTripper) http.RoundTripper {
+			if wrap != nil {
+				rt = wrap(rt)
+			}
+			return &readOnlyTransport{rt: rt}
+		}
+		c.conf = &conf
+	}
+	return &c
+}
+
+// readOnlyTransport refuses the requests that would change the cluster
+type readOnlyTransport struct {
+	rt http.RoundTripper
+}
+
+func (t *readOnlyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return nil, errors.Wrapf(ErrDryRunWrite, "%s %s", req.Method, req.URL.Path)
+	}
+	return t.rt.RoundTrip(req)
+}
+
+func (k *Client) writeDryRun(v interface{}) error {
+	b, ok := v.([]byte)
+	if !ok {
+		var err error
+		b, err = json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return errors.Wrap(err, "failed to json encode dry run object")
+		}
+	}
+	_, err := fmt.Fprintf(k.dryRun, "%s\n", b)
+	return err
+}
@@ -0,0 +1,172 @@
+package k8s
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/pkg/apis/apps/v1beta1"
+	k8sv2alpha "k8s.io/client-go/pkg/apis/batch/v2alpha1"
+
+	"github.com/luizalabs/teresa/pkg/server/spec"
+)
+
+func newDryRunServer() *fakeAPIServer {
+	return newFakeAPIServer(newDiscoveryHandler(func(w http.ResponseWriter, r *fakeRequest) {
+		writeStatus(w, http.StatusNotFound, metav1.StatusReasonNotFound)
+	}, appsV1beta1GroupVersion, extensionsV1beta1GroupVersion))
+}
+
+func assertNoWrites(t *testing.T, srv *fakeAPIServer) {
+	for _, req := range srv.Requests {
+		if req.Method != http.MethodGet {
+			t.Errorf("got %s %s on dry run; want only reads", req.Method, req.Path)
+		}
+	}
+}
+
+func TestCreateOrUpdateDeployDryRun(t *testing.T) {
+	srv := newDryRunServer()
+	defer srv.Close()
+
+	ds := &spec.Deploy{
+		Pod: spec.Pod{
+			Name:      "app",
+			Namespace: "teresa",
+			Containers: []*spec.Container{{
+				Name:  "app",
+				Image: "luizalabs/teresa:0.0.1",
+			}},
+		},
+	}
+	var buf bytes.Buffer
+	if err := srv.Client().WithDryRun(&buf).CreateOrUpdateDeploy(ds); err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+	assertNoWrites(t, srv)
+
+	d := new(v1beta1.Deployment)
+	if err := json.Unmarshal(buf.Bytes(), d); err != nil {
+		t.Fatal("error decoding dry run output:", err)
+	}
+	if d.Name != ds.Name || d.Spec.Template.Spec.Containers[0].Image != ds.Containers[0].Image {
+		t.Errorf("got %s %s; want %s %s", d.Name, d.Spec.Template.Spec.Containers[0].Image, ds.Name, ds.Containers[0].Image)
+	}
+}
+
+func TestCreateOrUpdateCronJobDryRun(t *testing.T) {
+	srv := newDryRunServer()
+	defer srv.Close()
+
+	cs := &spec.CronJob{
+		Deploy: spec.Deploy{
+			Pod: spec.Pod{
+				Name:       "cron",
+				Namespace:  "teresa",
+				Containers: []*spec.Container{{Name: "cron", Image: "luizalabs/teresa:0.0.1"}},
+			},
+		},
+		Schedule: "*/1 * * * *",
+	}
+	var buf bytes.Buffer
+	if err := srv.Client().WithDryRun(&buf).CreateOrUpdateCronJob(cs); err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+	assertNoWrites(t, srv)
+
+	cj := new(k8sv2alpha.CronJob)
+	if err := json.Unmarshal(buf.Bytes(), cj); err != nil {
+		t.Fatal("error decoding dry run output:", err)
+	}
+	if cj.Spec.Schedule != cs.Schedule {
+		t.Errorf("got %s; want %s", cj.Spec.Schedule, cs.Schedule)
+	}
+}
+
+func TestSetDeployImageDryRun(t *testing.T) {
+	srv := newDryRunServer()
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	c := srv.Client()
+	if err := c.WithDryRun(&buf).SetDeployImage("teresa", "app", "luizalabs/teresa:0.0.2"); err != nil {
+		t.Fatal("got unexpected error:", err)
+	}
+	if len(srv.Requests) != 0 {
+		t.Errorf("got %d requests; want 0", len(srv.Requests))
+	}
+	if !strings.Contains(buf.String(), `"image": "luizalabs/teresa:0.0.2"`) {
+		t.Errorf("got %s; want the image patch", buf.String())
+	}
+	if c.dryRun != nil {
+		t.Error("expected the original client to be left as is")
+	}
+}
+
+func TestDeployPatchesDryRun(t *testing.T) {
+	var testCases = []struct {
+		op       func(c *Client) error
+		expected string
+	}{
+		{
+			func(c *Client) error { return c.DeployRollbackToRevision("teresa", "app", "2") },
+			`"rollbackTo":{"revision": 2}`,
+		},
+		{
+			func(c *Client) error { return c.DeploySetReplicas("teresa", "app", 3) },
+			`"replicas": 3`,
+		},
+		{
+			func(c *Client) error { return c.PauseDeploy("teresa", "app") },
+			`"paused": true`,
+		},
+		{
+			func(c *Client) error { return c.ResumeDeploy("teresa", "app") },
+			`"paused": false`,
+		},
+	}
+
+	for _, tc := range testCases {
+		srv := newDryRunServer()
+		var buf bytes.Buffer
+		err := tc.op(srv.Client().WithDryRun(&buf))
+		srv.Close()
+		if err != nil {
+			t.Fatal("got unexpected error:", err)
+		}
+		if len(srv.Requests) != 0 {
+			t.Errorf("got %d requests; want 0", len(srv.Requests))
+		}
+		if !strings.Contains(buf.String(), tc.expected) {
+			t.Errorf("got %s; want it to contain %s", buf.String(), tc.expected)
+		}
+	}
+}
+
+func TestDryRunRefusesWrites(t *testing.T) {
+	srv := newFakeAPIServer(newDiscoveryHandler(func(w http.ResponseWriter, r *fakeRequest) {
+		writeJSON(w, http.StatusOK, &v1beta1.Deployment{})
+	}, appsV1beta1GroupVersion))
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	c := srv.Client()
+	dc := c.WithDryRun(&buf)
+	ops := []func() error{
+		func() error { return dc.DeleteDeploy("teresa", "app") },
+		func() error { return dc.DeleteSecretKeys("teresa", "secret", []string{"KEY"}) },
+	}
+	for _, op := range ops {
+		if err := op(); err == nil || !strings.Contains(err.Error(), ErrDryRunWrite.Error()) {
+			t.Errorf("got %v; want %v", err, ErrDryRunWrite)
+		}
+	}
+	assertNoWrites(t, srv)
+
+	if c.conf.WrapTransport != nil {
+		t.Error("expected the original client config to be left as is")
+	}
+}
@@ -10,10 +10,28 @@ import (
 )
 
 var (
-	ErrInvalidServiceType = errors.New("Invalid service type")
-	ErrNotFound           = status.Errorf(codes.NotFound, "Resource not found")
-	ErrPodRunFailed       = status.Errorf(codes.Aborted, "Pod went into failed status")
-	ErrPodStillRunning    = status.Errorf(codes.Unknown, "Pod still running")
+	ErrAmbiguousPodSelector   = status.Errorf(codes.FailedPrecondition, "More than one pod matches the selector, use a more specific one")
+	ErrAppAnnotationNotFound  = errors.New("App annotation not found on namespace")
+	ErrClientClosed           = status.Errorf(codes.Unavailable, "Server is shutting down")
+	ErrCronJobNeverRan        = status.Errorf(codes.NotFound, "Cron job has no runs yet")
+	ErrDryRunWrite            = errors.New("Operation not supported on dry run")
+	ErrHeadlessService        = status.Errorf(codes.FailedPrecondition, "Headless service has no load balancer")
+	ErrInvalidRestartPolicy   = errors.New("Invalid pod restart policy, use Never or OnFailure")
+	ErrInvalidServicePorts    = errors.New("Service ports need unique names")
+	ErrInvalidServiceProtocol = errors.New("Invalid service protocol, use TCP or UDP")
+	ErrInvalidServiceType     = errors.New("Invalid service type")
+	ErrInvalidSourceRange     = errors.New("Invalid load balancer source range")
+	ErrInvalidTargetPort      = errors.New("Service target port not exposed by any container")
+	ErrInvalidTLSKeyPair      = errors.New("Invalid TLS certificate and key pair")
+	ErrMetricsUnavailable     = status.Errorf(codes.Unavailable, "Metrics API not available, is the metrics-server installed?")
+	ErrNoLastApplied          = status.Errorf(codes.NotFound, "Deploy has no last applied configuration")
+	ErrNoPreviousRevision     = status.Errorf(codes.FailedPrecondition, "Deploy has no previous revision to rollback to")
+	ErrNotFound               = status.Errorf(codes.NotFound, "Resource not found")
+	ErrPodNotScheduled        = status.Errorf(codes.FailedPrecondition, "Pod not scheduled to a node yet")
+	ErrPodRunFailed           = status.Errorf(codes.Aborted, "Pod went into failed status")
+	ErrPodRunsStillRunning    = errors.New("Pod runs did not finish after being cancelled")
+	ErrPodStillRunning        = status.Errorf(codes.Unknown, "Pod still running")
+	ErrUnsupportedAPIVersion  = errors.New("None of the API versions is supported by the cluster")
 )
 
 func (k *Client) IsNotFound(err error) bool {
@@ -27,3 +45,11 @@ func (k *Client) IsAlreadyExists(err error) bool {
 func (k *Client) IsInvalid(err error) bool {
 	return k8serrors.IsInvalid(errors.Cause(err))
 }
+
+func (k *Client) IsConflict(err error) bool {
+	return k8serrors.IsConflict(errors.Cause(err))
+}
+
+func (k *Client) IsBadRequest(err error) bool {
+	return k8serrors.IsBadRequest(errors.Cause(err))
+}
@@ -10,6 +10,7 @@ import (
 
 	"golang.org/x/sync/errgroup"
 
+	log "github.com/Sirupsen/logrus"
 	"github.com/grpc-ecosystem/go-grpc-middleware"
 	"github.com/grpc-ecosystem/go-grpc-middleware/recovery"
 	"github.com/jinzhu/gorm"
@@ -74,6 +75,11 @@ func (s *Server) Run() error {
 	case err := <-gChan:
 		return err
 	case <-exitChan:
+		if s.opt.K8s != nil {
+			if err := s.opt.K8s.Close(); err != nil {
+				log.WithError(err).Error("Error deleting the running pods")
+			}
+		}
 		s.grpcServer.GracefulStop()
 		s.hcServer.GracefulStop()
 		return nil
@@ -11,12 +11,37 @@ const (
 	defaultPortName    = "tcp"
 	defaultSSLPortName = "ssl"
 	sslPort            = 443
+	ProtocolTCP        = "TCP"
+	ProtocolUDP        = "UDP"
 )
 
+// ServicePort is a named port of the app service, a zero Port means 80 and
+// a zero TargetPort means spec.DefaultPort
 type ServicePort struct {
 	Name       string
 	Port       int
 	TargetPort int
+	// Protocol is ProtocolTCP or ProtocolUDP, empty means ProtocolTCP
+	Protocol string
+}
+
+// ServiceOptions holds the optional settings of the app service, nil keeps
+// the defaults
+type ServiceOptions struct {
+	// ExternalTrafficLocal routes the load balancer traffic only to the node
+	// local pods, preserving the client source IP
+	ExternalTrafficLocal bool
+	// SourceRanges restricts the load balancer access to these CIDRs
+	SourceRanges []string
+	// TargetPort is the pod port receiving the traffic, the deploy
+	// ContainerPort. Zero means spec.DefaultPort
+	TargetPort int32
+	// Ports replaces the default port, every one needs a unique name
+	Ports []ServicePort
+	// Headless creates a ClusterIP service without the cluster IP, resolving
+	// to the pod IPs for peer discovery. There is no ingress nor load
+	// balancer, so the settings above about them are ignored
+	Headless bool
 }
 
 type CloudProviderOperations interface {
@@ -34,15 +34,16 @@ type Port struct {
 }
 
 type Container struct {
-	Name            string
-	Image           string
-	ContainerLimits *ContainerLimits
-	Env             map[string]string
-	VolumeMounts    []*VolumeMounts
-	Command         []string
-	Args            []string
-	Ports           []Port
-	Secrets         []string
+	Name              string
+	Image             string
+	ContainerLimits   *ContainerLimits
+	ContainerRequests *ContainerLimits
+	Env               map[string]string
+	VolumeMounts      []*VolumeMounts
+	Command           []string
+	Args              []string
+	Ports             []Port
+	Secrets           []string
 }
 
 func newSlugVolumeMount() *VolumeMounts {
@@ -88,11 +89,10 @@ func newNginxVolumeMount() *VolumeMounts {
 	}
 }
 
-func newNginxContainer(image string) *Container {
-	port := strconv.Itoa(DefaultPort)
-	backend := fmt.Sprintf(nginxBackendTmpl, secondaryPort)
+func newNginxContainer(image string, port, backendPort int) *Container {
+	backend := fmt.Sprintf(nginxBackendTmpl, backendPort)
 	env := map[string]string{
-		"NGINX_PORT":    port,
+		"NGINX_PORT":    strconv.Itoa(port),
 		"NGINX_BACKEND": backend,
 	}
 	args := newNginxContainerArgs(env)
@@ -104,7 +104,7 @@ func newNginxContainer(image string) *Container {
 		Args:    []string{"-c", args},
 		Ports: []Port{{
 			Name:          "nginx",
-			ContainerPort: int32(DefaultPort),
+			ContainerPort: int32(port),
 		}},
 		Env: env,
 		VolumeMounts: []*VolumeMounts{
@@ -1,6 +1,8 @@
 package spec
 
 import (
+	"time"
+
 	"github.com/luizalabs/teresa/pkg/server/app"
 	"github.com/luizalabs/teresa/pkg/server/storage"
 )
@@ -9,13 +11,40 @@ const (
 	defaultJobHistoryLimit = 3
 )
 
+// CronJob runs concurrently with the previous runs, unless the
+// ConcurrencyPolicy is Forbid (skip the new run) or Replace. The runs missed
+// by more than StartingDeadlineSeconds are dropped
 type CronJob struct {
 	Deploy
 	Schedule                   string
+	ConcurrencyPolicy          string
+	StartingDeadlineSeconds    *int64
 	SuccessfulJobsHistoryLimit int32
 	FailedJobsHistoryLimit     int32
 }
 
+// CronJobStatus has a nil LastScheduleTime when the cron job never ran
+type CronJobStatus struct {
+	Schedule         string
+	LastScheduleTime *time.Time
+	Active           int
+}
+
+const (
+	JobRunRunning   = "Running"
+	JobRunSucceeded = "Succeeded"
+	JobRunFailed    = "Failed"
+)
+
+// JobRun is a job created by a cron job, CompletionTime is only set when it
+// succeeds
+type JobRun struct {
+	Name           string
+	Status         string
+	StartTime      *time.Time
+	CompletionTime *time.Time
+}
+
 func NewCronJob(description, slugURL, schedule string, imgs *Images, a *app.App, fs storage.Storage, args ...string) *CronJob {
 	ps := NewPod(
 		a.Name,
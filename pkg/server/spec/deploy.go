@@ -34,7 +34,8 @@ type RollingUpdate struct {
 }
 
 type PreStop struct {
-	DrainTimeoutSeconds int `yaml:"drainTimeoutSeconds,omitempty"`
+	DrainTimeoutSeconds int      `yaml:"drainTimeoutSeconds,omitempty"`
+	Command             []string `yaml:"command,omitempty"`
 }
 
 type Lifecycle struct {
@@ -50,14 +51,69 @@ type TeresaYaml struct {
 	RollingUpdate *RollingUpdate `yaml:"rollingUpdate,omitempty"`
 	Lifecycle     *Lifecycle     `yaml:"lifecycle,omitempty"`
 	Cron          *CronArgs      `yaml:"cron,omitempty"`
+	// ContainerPort is the port receiving the service traffic, zero means
+	// DefaultPort
+	ContainerPort int32 `yaml:"containerPort,omitempty"`
+}
+
+type NodeSelectorRequirement struct {
+	Key      string
+	Operator string
+	Values   []string
+}
+
+type KeyToPath struct {
+	Key  string
+	Path string
+}
+
+// SecretVolume mounts the secret keys as files on the app container, Items
+// restricts the keys and sets their paths
+type SecretVolume struct {
+	SecretName string
+	MountPath  string
+	Items      []*KeyToPath
+}
+
+// ConfigMapVolume mounts the config map keys as files on the app container.
+// With SubPath only that key is mounted, as the MountPath file, keeping the
+// rest of the directory untouched
+type ConfigMapVolume struct {
+	ConfigMapName string
+	MountPath     string
+	SubPath       string
+}
+
+// EmptyDirVolume is shared by the containers on MountPaths, keyed by the
+// container name, Memory backs it with tmpfs
+type EmptyDirVolume struct {
+	Name       string
+	MountPaths map[string]string
+	Memory     bool
 }
 
 type Deploy struct {
 	Pod
 	TeresaYaml
-	RevisionHistoryLimit int
-	Description          string
-	SlugURL              string
+	RevisionHistoryLimit          *int32
+	Description                   string
+	SlugURL                       string
+	TerminationGracePeriodSeconds *int64
+	NodeSelector                  map[string]string
+	NodeAffinity                  []*NodeSelectorRequirement
+	SpreadAcrossNodes             bool
+	Tolerations                   []app.Toleration
+	MinReadySeconds               int32
+	ImagePullSecrets              []string
+	SecretVolumes                 []SecretVolume
+	ConfigMapVolumes              []ConfigMapVolume
+	EmptyDirVolumes               []EmptyDirVolume
+	ContainerPort                 int32
+	// Team is injected on the app container as TEAM, with APP_NAME and
+	// NAMESPACE, unless DisableStandardEnvVars is set. The ones set by the
+	// user are kept
+	Team                   string
+	DisableStandardEnvVars bool
 }
 
 type Images struct {
@@ -69,32 +125,36 @@ type Images struct {
 
 func NewDeploy(imgs *Images, description, slugURL string, rhl int, a *app.App, tYaml *TeresaYaml, fs storage.Storage) *Deploy {
 	port := DefaultPort
-	if imgs.Nginx != "" {
-		port = secondaryPort
+	if tYaml != nil && tYaml.ContainerPort > 0 {
+		port = int(tYaml.ContainerPort)
 	}
 
-	ps := NewPod(
+	ps := newPod(
 		a.Name,
 		imgs.Nginx,
 		imgs.SlugRunner,
 		a,
 		map[string]string{
 			"APP":      a.Name,
-			"PORT":     strconv.Itoa(port),
+			"PORT":     strconv.Itoa(appPort(imgs.Nginx, port)),
 			"SLUG_URL": slugURL,
 			"SLUG_DIR": slugVolumeMountPath,
 		},
 		fs,
+		port,
 	)
 	ps.Containers[0].Args = []string{"start", a.ProcessType}
 	ps.Containers[0].VolumeMounts = []*VolumeMounts{newSlugVolumeMount()}
 	ps.InitContainers = newInitContainers(slugURL, imgs.SlugStore, a, fs)
 
+	rhl32 := int32(rhl)
 	ds := &Deploy{
 		Description:          description,
 		SlugURL:              slugURL,
 		Pod:                  *ps,
-		RevisionHistoryLimit: rhl,
+		RevisionHistoryLimit: &rhl32,
+		ContainerPort:        int32(port),
+		Team:                 a.Team,
 	}
 
 	if tYaml != nil {
@@ -1,6 +1,7 @@
 package spec
 
 import (
+	"strconv"
 	"testing"
 
 	"github.com/luizalabs/teresa/pkg/server/app"
@@ -12,7 +13,7 @@ func TestNewDeploySpec(t *testing.T) {
 	expectedDescription := "test"
 	expectedSlugURL := "http://teresa.io/slug.tgz"
 	expectedRevisionHistoryLimit := 5
-	a := &app.App{Name: "deploy-test", ProcessType: "worker"}
+	a := &app.App{Name: "deploy-test", ProcessType: "worker", Team: "luizalabs"}
 	imgs := &Images{SlugRunner: expectedImage}
 
 	ds := NewDeploy(
@@ -41,8 +42,16 @@ func TestNewDeploySpec(t *testing.T) {
 		t.Errorf("expected %s, got %s", a.Name, ds.Pod.Name)
 	}
 
-	if ds.RevisionHistoryLimit != expectedRevisionHistoryLimit {
-		t.Errorf("expected %d, got %d", expectedRevisionHistoryLimit, ds.RevisionHistoryLimit)
+	if *ds.RevisionHistoryLimit != int32(expectedRevisionHistoryLimit) {
+		t.Errorf("expected %d, got %d", expectedRevisionHistoryLimit, *ds.RevisionHistoryLimit)
+	}
+
+	if ds.ContainerPort != DefaultPort {
+		t.Errorf("got %d; want %d", ds.ContainerPort, DefaultPort)
+	}
+
+	if ds.Team != a.Team {
+		t.Errorf("got %s; want %s", ds.Team, a.Team)
 	}
 
 	if ds.Lifecycle == nil {
@@ -72,3 +81,50 @@ func TestNewDeploySpecInitContainers(t *testing.T) {
 		t.Errorf("got %s; want %s", ds.InitContainers[0].Image, expectedImage)
 	}
 }
+
+func TestNewDeploySpecContainerPort(t *testing.T) {
+	var testCases = []struct {
+		nginx         string
+		port          int32
+		expectedPort  string
+		expectedNginx string
+	}{
+		{"", 0, "5000", ""},
+		{"", 8080, "8080", ""},
+		{"nginx", 0, "6000", "5000"},
+		{"nginx", 8080, "6000", "8080"},
+		{"nginx", 6000, "5000", "6000"},
+	}
+
+	for _, tc := range testCases {
+		imgs := &Images{Nginx: tc.nginx}
+		tYaml := &TeresaYaml{ContainerPort: tc.port}
+		ds := NewDeploy(imgs, "", "", 0, &app.App{}, tYaml, storage.NewFake())
+
+		c := ds.Containers[0]
+		if actual := c.Env["PORT"]; actual != tc.expectedPort {
+			t.Errorf("got %s; want %s", actual, tc.expectedPort)
+		}
+		if actual := strconv.Itoa(int(c.Ports[0].ContainerPort)); actual != tc.expectedPort {
+			t.Errorf("got %s; want %s", actual, tc.expectedPort)
+		}
+		exposed := tc.expectedPort
+		if tc.nginx != "" {
+			nginx := ds.Containers[1]
+			if actual := nginx.Env["NGINX_PORT"]; actual != tc.expectedNginx {
+				t.Errorf("got %s; want %s", actual, tc.expectedNginx)
+			}
+			if actual := strconv.Itoa(int(nginx.Ports[0].ContainerPort)); actual != tc.expectedNginx {
+				t.Errorf("got %s; want %s", actual, tc.expectedNginx)
+			}
+			backend := "http://localhost:" + tc.expectedPort
+			if actual := nginx.Env["NGINX_BACKEND"]; actual != backend {
+				t.Errorf("got %s; want %s", actual, backend)
+			}
+			exposed = tc.expectedNginx
+		}
+		if actual := strconv.Itoa(int(ds.ContainerPort)); actual != exposed {
+			t.Errorf("got %s; want %s", actual, exposed)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package spec
 
 import (
+	"time"
+
 	"github.com/luizalabs/teresa/pkg/server/app"
 	"github.com/luizalabs/teresa/pkg/server/storage"
 )
@@ -17,12 +19,20 @@ type Volume struct {
 	EmptyDir      bool
 }
 
+// Pod Limits and Requests apply to the main container when it doesn't set
+// its own, when unset the namespace LimitRange defaults are used.
+// RestartPolicy is Never or OnFailure (restart the failed containers until
+// they succeed or the pod times out), empty means Never
 type Pod struct {
 	Name           string
 	Namespace      string
 	Containers     []*Container
 	Volumes        []*Volume
 	InitContainers []*Container
+	Timeout        time.Duration
+	Limits         *ContainerLimits
+	Requests       *ContainerLimits
+	RestartPolicy  string
 }
 
 func newPodVolumes(appName string, fs storage.Storage, hasNginx bool) []*Volume {
@@ -45,29 +55,41 @@ func newPodVolumes(appName string, fs storage.Storage, hasNginx bool) []*Volume
 	return volumes
 }
 
-func newPodContainers(name, nginxImage, appImage string, envVars map[string]string, secrets []string) []*Container {
-	appPort := DefaultPort
-	if nginxImage != "" {
-		appPort = secondaryPort
+// appPort is the port the app listens on when port receives the service
+// traffic, behind nginx it's another one
+func appPort(nginxImage string, port int) int {
+	if nginxImage == "" {
+		return port
+	}
+	if port == secondaryPort {
+		return DefaultPort
 	}
+	return secondaryPort
+}
 
+func newPodContainers(name, nginxImage, appImage string, envVars map[string]string, secrets []string, port int) []*Container {
+	backendPort := appPort(nginxImage, port)
 	c := []*Container{
-		newAppContainer(name, appImage, envVars, appPort, secrets),
+		newAppContainer(name, appImage, envVars, backendPort, secrets),
 	}
 	if nginxImage != "" {
-		c = append(c, newNginxContainer(nginxImage))
+		c = append(c, newNginxContainer(nginxImage, port, backendPort))
 	}
 	return c
 }
 
 func NewPod(name, nginxImage, image string, a *app.App, envVars map[string]string, fs storage.Storage) *Pod {
+	return newPod(name, nginxImage, image, a, envVars, fs, DefaultPort)
+}
+
+func newPod(name, nginxImage, image string, a *app.App, envVars map[string]string, fs storage.Storage, port int) *Pod {
 	hasNginx := false
 	hasNginx = nginxImage != ""
 
 	ps := &Pod{
 		Name:       name,
 		Namespace:  a.Name,
-		Containers: newPodContainers(name, nginxImage, image, envVars, a.Secrets),
+		Containers: newPodContainers(name, nginxImage, image, envVars, a.Secrets, port),
 		Volumes:    newPodVolumes(a.Name, fs, hasNginx),
 	}
 